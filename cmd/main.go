@@ -2,25 +2,115 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/murakmii/retsu/internal"
+	"github.com/murakmii/retsu/thrift/parquet"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 )
 
 func main() {
 	inspectCmd := flag.NewFlagSet("inspect", flag.ExitOnError)
 	inspectPathArg := inspectCmd.String("path", "", "file path of parquet file to inspect")
+	inspectPageIndexArg := inspectCmd.Bool("page-index", false, "include page index(column index and offset index) of each column chunk")
+	inspectDecryptionArgs := addDecryptionFlags(inspectCmd)
 
-	sumInt64Cmd := flag.NewFlagSet("sum-int64", flag.ExitOnError)
-	sumInt64PathArg := sumInt64Cmd.String("path", "", "file path of parquet file to sum of int64 column")
-	sumInt64FieldArg := sumInt64Cmd.String("field", "", "field path of parquet file to sum of int64 column")
+	aggCmd := flag.NewFlagSet("agg", flag.ExitOnError)
+	aggPathArg := aggCmd.String("path", "", "file path of parquet file to aggregate")
+	aggFieldArg := aggCmd.String("field", "", "comma separated field paths of numeric columns to aggregate")
+	aggFuncsArg := aggCmd.String("funcs", "count,count_null,sum,min,max,avg,variance", "comma separated aggregate functions(count and min/max are answered from statistics if possible)")
+	aggFilterArg := aggCmd.String("filter", "", "filter expression to select rows to aggregate(e.g. \"id >= 100 AND name LIKE 'a%'\")")
+	aggFormatArg := aggCmd.String("format", "json", "output format(json or table)")
+	aggReadArgs := addReadFlags(aggCmd)
+	aggDecryptionArgs := addDecryptionFlags(aggCmd)
+
+	groupCmd := flag.NewFlagSet("group", flag.ExitOnError)
+	groupPathArg := groupCmd.String("path", "", "file path of parquet file to aggregate")
+	groupByArg := groupCmd.String("by", "", "comma separated field paths of group keys")
+	groupFieldArg := groupCmd.String("field", "", "comma separated field paths of numeric columns to aggregate per group")
+	groupFuncsArg := groupCmd.String("funcs", "count,sum,avg", "comma separated aggregate functions")
+	groupFilterArg := groupCmd.String("filter", "", "filter expression to select rows to aggregate")
+	groupFormatArg := groupCmd.String("format", "json", "output format(json or table)")
+	groupReadArgs := addReadFlags(groupCmd)
+	groupDecryptionArgs := addDecryptionFlags(groupCmd)
+
+	distinctCmd := flag.NewFlagSet("distinct", flag.ExitOnError)
+	distinctPathArg := distinctCmd.String("path", "", "file path of parquet file to count distinct values")
+	distinctFieldArg := distinctCmd.String("field", "", "comma separated field paths of columns to count distinct values")
+	distinctPrecisionArg := distinctCmd.Int("precision", internal.DefaultHyperLogLogPrecision, "precision of HyperLogLog(4-18, higher is more accurate and uses more memory)")
+	distinctFilterArg := distinctCmd.String("filter", "", "filter expression to select rows to count")
+	distinctFormatArg := distinctCmd.String("format", "json", "output format(json or table)")
+	distinctReadArgs := addReadFlags(distinctCmd)
+	distinctDecryptionArgs := addDecryptionFlags(distinctCmd)
+
+	distCmd := flag.NewFlagSet("dist", flag.ExitOnError)
+	distPathArg := distCmd.String("path", "", "file path of parquet file to profile")
+	distFieldArg := distCmd.String("field", "", "comma separated field paths of numeric, date or timestamp columns")
+	distQuantilesArg := distCmd.String("quantiles", "0.5,0.95,0.99", "comma separated quantiles to estimate")
+	distBucketsArg := distCmd.Int("buckets", 0, "number of equal width buckets of histogram(0 to omit histogram)")
+	distLowerArg := distCmd.String("lower", "", "lower bound of histogram in units of column values(min value of column if omitted)")
+	distUpperArg := distCmd.String("upper", "", "upper bound of histogram in units of column values(max value of column if omitted)")
+	distFilterArg := distCmd.String("filter", "", "filter expression to select rows")
+	distFormatArg := distCmd.String("format", "json", "output format(json or table)")
+	distReadArgs := addReadFlags(distCmd)
+	distDecryptionArgs := addDecryptionFlags(distCmd)
+
+	topCmd := flag.NewFlagSet("top", flag.ExitOnError)
+	topPathArg := topCmd.String("path", "", "file path of parquet file to count values")
+	topFieldArg := topCmd.String("field", "", "comma separated field paths of columns to count values")
+	topKArg := topCmd.Int("k", 10, "number of most frequent values")
+	topFilterArg := topCmd.String("filter", "", "filter expression to select rows to count")
+	topFormatArg := topCmd.String("format", "json", "output format(json or table)")
+	topReadArgs := addReadFlags(topCmd)
+	topDecryptionArgs := addDecryptionFlags(topCmd)
+
+	rowsCmd := flag.NewFlagSet("rows", flag.ExitOnError)
+	rowsPathArg := rowsCmd.String("path", "", "file path of parquet file to read rows")
+	rowsFieldArg := rowsCmd.String("field", "", "comma separated field paths of columns to read")
+	rowsLimitArg := rowsCmd.Int("limit", 0, "maximum number of rows to print(0 means all rows)")
+	rowsFilterArg := rowsCmd.String("filter", "", "filter expression to select rows to read")
+	rowsFormatArg := rowsCmd.String("format", "json", "output format(json(one object per line) or table)")
+	rowsReadArgs := addReadFlags(rowsCmd)
+	rowsDecryptionArgs := addDecryptionFlags(rowsCmd)
+
+	queryCmd := flag.NewFlagSet("query", flag.ExitOnError)
+	queryPathArg := queryCmd.String("path", "", "file path of parquet file to query")
+	querySQLArg := queryCmd.String("sql", "", "SELECT statement(e.g. \"SELECT category, count(*), avg(price) WHERE price > 10 GROUP BY category ORDER BY 2 DESC LIMIT 5\")")
+	queryFormatArg := queryCmd.String("format", "table", "output format(json or table)")
+	queryReadArgs := addReadFlags(queryCmd)
+	queryDecryptionArgs := addDecryptionFlags(queryCmd)
+
+	verifyCmd := flag.NewFlagSet("verify", flag.ExitOnError)
+	verifyPathArg := verifyCmd.String("path", "", "file path of parquet file to verify")
+	verifyDecryptionArgs := addDecryptionFlags(verifyCmd)
+
+	recoverCmd := flag.NewFlagSet("recover", flag.ExitOnError)
+	recoverPathArg := recoverCmd.String("path", "", "file path of parquet file whose footer is missing")
+	recoverSchemaArg := recoverCmd.String("schema", "", "file path of JSON array of schema elements(same as 'schema' in footer)")
+	recoverSchemaFromArg := recoverCmd.String("schema-from", "", "file path of sibling parquet file to infer schema, codec and rows per row group")
+	recoverCodecArg := recoverCmd.String("codec", "", "compression codec of pages(inferred if omitted)")
+	recoverRowsArg := recoverCmd.Int64("rows-per-group", 0, "number of rows per row group(hint to split column chunks, required when any column chunk has no dictionary page)")
+	recoverOutArg := recoverCmd.String("out", "", "file path to write repaired parquet file")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s <sub-command>\n\n", os.Args[0])
 		inspectCmd.Usage()
-		sumInt64Cmd.Usage()
+		aggCmd.Usage()
+		groupCmd.Usage()
+		distinctCmd.Usage()
+		distCmd.Usage()
+		topCmd.Usage()
+		rowsCmd.Usage()
+		queryCmd.Usage()
+		verifyCmd.Usage()
+		recoverCmd.Usage()
 	}
 
 	if len(os.Args) < 2 {
@@ -31,14 +121,74 @@ func main() {
 	switch os.Args[1] {
 	case "inspect":
 		inspectCmd.Parse(os.Args[2:])
-		if err := inspect(*inspectPathArg); err != nil {
+		if err := inspect(*inspectPathArg, *inspectPageIndexArg, inspectDecryptionArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "agg":
+		aggCmd.Parse(os.Args[2:])
+		if err := aggregate(*aggPathArg, *aggFieldArg, *aggFuncsArg, *aggFilterArg, *aggFormatArg, aggReadArgs, aggDecryptionArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "group":
+		groupCmd.Parse(os.Args[2:])
+		if err := groupBy(*groupPathArg, *groupByArg, *groupFieldArg, *groupFuncsArg, *groupFilterArg, *groupFormatArg, groupReadArgs, groupDecryptionArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "distinct":
+		distinctCmd.Parse(os.Args[2:])
+		if err := distinctCount(*distinctPathArg, *distinctFieldArg, *distinctPrecisionArg, *distinctFilterArg, *distinctFormatArg, distinctReadArgs, distinctDecryptionArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "dist":
+		distCmd.Parse(os.Args[2:])
+		if err := distribution(*distPathArg, *distFieldArg, *distQuantilesArg, *distBucketsArg, *distLowerArg, *distUpperArg, *distFilterArg, *distFormatArg, distReadArgs, distDecryptionArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "top":
+		topCmd.Parse(os.Args[2:])
+		if err := topK(*topPathArg, *topFieldArg, *topKArg, *topFilterArg, *topFormatArg, topReadArgs, topDecryptionArgs); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 
-	case "sum-int64":
-		sumInt64Cmd.Parse(os.Args[2:])
-		if err := sumInt64(*sumInt64PathArg, *sumInt64FieldArg); err != nil {
+	case "rows":
+		rowsCmd.Parse(os.Args[2:])
+		if err := readRows(*rowsPathArg, *rowsFieldArg, *rowsLimitArg, *rowsFilterArg, *rowsFormatArg, rowsReadArgs, rowsDecryptionArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "query":
+		queryCmd.Parse(os.Args[2:])
+		if err := query(*queryPathArg, *querySQLArg, *queryFormatArg, queryReadArgs, queryDecryptionArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "verify":
+		verifyCmd.Parse(os.Args[2:])
+		valid, err := verify(*verifyPathArg, verifyDecryptionArgs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !valid {
+			os.Exit(1)
+		}
+
+	case "recover":
+		recoverCmd.Parse(os.Args[2:])
+		if err := recoverFooter(*recoverPathArg, *recoverSchemaArg, *recoverSchemaFromArg, *recoverCodecArg, *recoverRowsArg, *recoverOutArg); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -49,7 +199,7 @@ func main() {
 	}
 }
 
-func inspect(path string) error {
+func inspect(path string, pageIndex bool, decryption *decryptionFlags) error {
 	if len(path) == 0 {
 		flag.Usage()
 		os.Exit(2)
@@ -61,12 +211,22 @@ func inspect(path string) error {
 	}
 	defer f.Close()
 
-	par := internal.NewParquet(f)
+	par, err := newParquet(f, decryption)
+	if err != nil {
+		return err
+	}
+
 	inspected, err := par.Inspect(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to inspect parquet file: %w", err)
 	}
 
+	if pageIndex {
+		if err := par.InspectPageIndex(context.Background(), inspected); err != nil {
+			return fmt.Errorf("failed to inspect page index: %w", err)
+		}
+	}
+
 	j, err := json.MarshalIndent(inspected, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal inspection result: %w", err)
@@ -76,8 +236,151 @@ func inspect(path string) error {
 	return nil
 }
 
-func sumInt64(path string, field string) error {
-	if len(path) == 0 || len(field) == 0 {
+func aggregate(path string, fields string, funcNames string, filter string, format string, read *readFlags, decryption *decryptionFlags) error {
+	if len(path) == 0 || len(fields) == 0 || (format != "json" && format != "table") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	funcs, err := internal.ParseAggregateFuncs(funcNames)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open parquet file: %w", err)
+	}
+	defer f.Close()
+
+	reader, err := newReader(f, filter, read, decryption)
+	if err != nil {
+		return err
+	}
+
+	var results []*internal.Aggregate
+	for _, field := range strings.Split(fields, ",") {
+		result, err := reader.Aggregate(context.Background(), field, funcs)
+		if err != nil {
+			return fmt.Errorf("failed to aggregate field '%s': %w", field, err)
+		}
+
+		results = append(results, result)
+	}
+
+	if format == "table" {
+		printAggregates(results, funcs)
+	} else {
+		j, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal aggregation result: %w", err)
+		}
+
+		fmt.Println(string(j))
+	}
+
+	return printReports(reader, format)
+}
+
+func printAggregates(results []*internal.Aggregate, funcs internal.AggregateFunc) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "field\trows\t%s\t\n", strings.Join(funcs.Names(), "\t"))
+
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%d\t", r.Path, r.Rows)
+		for fn := internal.AggregateFunc(1); fn <= internal.AggregateAll; fn <<= 1 {
+			if funcs&fn != 0 {
+				fmt.Fprintf(w, "%s\t", r.Format(fn))
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	w.Flush()
+}
+
+func groupBy(path string, keys string, fields string, funcNames string, filter string, format string, read *readFlags, decryption *decryptionFlags) error {
+	if len(path) == 0 || len(keys) == 0 || (format != "json" && format != "table") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	funcs, err := internal.ParseAggregateFuncs(funcNames)
+	if err != nil {
+		return err
+	}
+
+	var aggs []internal.GroupAggregate
+	if len(fields) > 0 {
+		for _, field := range strings.Split(fields, ",") {
+			aggs = append(aggs, internal.GroupAggregate{Path: field, Funcs: funcs})
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open parquet file: %w", err)
+	}
+	defer f.Close()
+
+	reader, err := newReader(f, filter, read, decryption)
+	if err != nil {
+		return err
+	}
+
+	result, err := reader.GroupBy(context.Background(), strings.Split(keys, ","), aggs)
+	if err != nil {
+		return fmt.Errorf("failed to aggregate groups: %w", err)
+	}
+
+	if format == "table" {
+		printGroups(result, funcs)
+	} else {
+		j, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal aggregation result: %w", err)
+		}
+
+		fmt.Println(string(j))
+	}
+
+	return printReports(reader, format)
+}
+
+func printGroups(result *internal.GroupedAggregate, funcs internal.AggregateFunc) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	header := append(append([]string{}, result.Keys...), "rows")
+	if len(result.Groups) > 0 {
+		for _, agg := range result.Groups[0].Aggregates {
+			for _, name := range funcs.Names() {
+				header = append(header, fmt.Sprintf("%s(%s)", name, agg.Path))
+			}
+		}
+	}
+	fmt.Fprintf(w, "%s\t\n", strings.Join(header, "\t"))
+
+	for _, g := range result.Groups {
+		for _, key := range g.Keys {
+			fmt.Fprintf(w, "%s\t", formatValue(key))
+		}
+
+		fmt.Fprintf(w, "%d\t", g.Rows)
+		for _, agg := range g.Aggregates {
+			for fn := internal.AggregateFunc(1); fn <= internal.AggregateAll; fn <<= 1 {
+				if funcs&fn != 0 {
+					fmt.Fprintf(w, "%s\t", agg.Format(fn))
+				}
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	w.Flush()
+}
+
+func distinctCount(path string, fields string, precision int, filter string, format string, read *readFlags, decryption *decryptionFlags) error {
+	if len(path) == 0 || len(fields) == 0 || (format != "json" && format != "table") {
 		flag.Usage()
 		os.Exit(2)
 	}
@@ -88,17 +391,729 @@ func sumInt64(path string, field string) error {
 	}
 	defer f.Close()
 
-	par := internal.NewParquet(f)
-	reader, err := internal.NewReader(context.Background(), par)
+	reader, err := newReader(f, filter, read, decryption)
 	if err != nil {
-		return fmt.Errorf("failed to create reader: %w", err)
+		return err
+	}
+
+	var results []*internal.DistinctCount
+	for _, field := range strings.Split(fields, ",") {
+		result, err := reader.DistinctCount(context.Background(), field, precision)
+		if err != nil {
+			return fmt.Errorf("failed to count distinct values of field '%s': %w", field, err)
+		}
+
+		results = append(results, result)
+	}
+
+	if format == "table" {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "field\testimate\tstandard_error\t")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%d\t%.2f%%\t\n", r.Path, r.Estimate, r.StandardError*100)
+		}
+		w.Flush()
+	} else {
+		j, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal distinct count result: %w", err)
+		}
+
+		fmt.Println(string(j))
+	}
+
+	return printReports(reader, format)
+}
+
+func distribution(path string, fields string, quantiles string, buckets int, lower string, upper string, filter string, format string, read *readFlags, decryption *decryptionFlags) error {
+	if len(path) == 0 || len(fields) == 0 || (format != "json" && format != "table") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := internal.DistributionOptions{Buckets: buckets}
+	for _, q := range strings.Split(quantiles, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(q), 64)
+		if err != nil {
+			return fmt.Errorf("invalid quantile '%s': %w", q, err)
+		}
+		opts.Quantiles = append(opts.Quantiles, v)
 	}
 
-	sum, err := reader.SumInt64(context.Background(), field)
+	var err error
+	if opts.Lower, err = parseBound(lower); err != nil {
+		return fmt.Errorf("invalid lower bound: %w", err)
+	}
+	if opts.Upper, err = parseBound(upper); err != nil {
+		return fmt.Errorf("invalid upper bound: %w", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open parquet file: %w", err)
+	}
+	defer f.Close()
+
+	reader, err := newReader(f, filter, read, decryption)
 	if err != nil {
-		return fmt.Errorf("failed to aggregate field '%s': %w", field, err)
+		return err
 	}
 
-	fmt.Printf("Sum: %d\n", sum)
+	var results []*internal.Distribution
+	for _, field := range strings.Split(fields, ",") {
+		result, err := reader.Distribution(context.Background(), field, opts)
+		if err != nil {
+			return fmt.Errorf("failed to profile field '%s': %w", field, err)
+		}
+
+		results = append(results, result)
+	}
+
+	if format == "table" {
+		printDistributions(results)
+	} else {
+		j, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal distribution: %w", err)
+		}
+
+		fmt.Println(string(j))
+	}
+
+	return printReports(reader, format)
+}
+
+func parseBound(s string) (*float64, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+func printDistributions(results []*internal.Distribution) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	header := []string{"field", "count", "min"}
+	if len(results) > 0 {
+		for _, q := range results[0].Quantiles {
+			header = append(header, "p"+strconv.FormatFloat(q.Q*100, 'f', -1, 64))
+		}
+	}
+	header = append(header, "max")
+	fmt.Fprintf(w, "%s\t\n", strings.Join(header, "\t"))
+
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%d\t%s\t", r.Path, r.Count, formatValue(r.Min))
+		for _, q := range r.Quantiles {
+			fmt.Fprintf(w, "%s\t", formatValue(q.Value))
+		}
+		fmt.Fprintf(w, "%s\t\n", formatValue(r.Max))
+	}
+	w.Flush()
+
+	for _, r := range results {
+		if r.Histogram == nil {
+			continue
+		}
+
+		fmt.Printf("\nhistogram of %s(underflow: %d, overflow: %d)\n", r.Path, r.Histogram.Underflow, r.Histogram.Overflow)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "lower\tupper\tcount\t")
+		for _, b := range r.Histogram.Buckets {
+			fmt.Fprintf(w, "%s\t%s\t%d\t\n", formatValue(b.Lower), formatValue(b.Upper), b.Count)
+		}
+		w.Flush()
+	}
+}
+
+// 論理型に従って変換した値を表示する(nilはNULL)
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case []any:
+		// 繰り返しのある列の値は、JSONの配列で表示する
+		j, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(j)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func topK(path string, fields string, k int, filter string, format string, read *readFlags, decryption *decryptionFlags) error {
+	if len(path) == 0 || len(fields) == 0 || (format != "json" && format != "table") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open parquet file: %w", err)
+	}
+	defer f.Close()
+
+	reader, err := newReader(f, filter, read, decryption)
+	if err != nil {
+		return err
+	}
+
+	var results []*internal.TopK
+	for _, field := range strings.Split(fields, ",") {
+		result, err := reader.TopK(context.Background(), field, k)
+		if err != nil {
+			return fmt.Errorf("failed to count values of field '%s': %w", field, err)
+		}
+
+		results = append(results, result)
+	}
+
+	if format == "table" {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "field\tvalue\tcount\terror\t")
+		for _, r := range results {
+			for _, v := range r.Values {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t\n", r.Path, formatValue(v.Value), v.Count, v.Error)
+			}
+		}
+		w.Flush()
+	} else {
+		j, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal top-k result: %w", err)
+		}
+
+		fmt.Println(string(j))
+	}
+
+	return printReports(reader, format)
+}
+
+// 表示する行数に達したことを表す
+var errLimitReached = errors.New("limit reached")
+
+func readRows(path string, fields string, limit int, filter string, format string, read *readFlags, decryption *decryptionFlags) error {
+	if len(path) == 0 || len(fields) == 0 || limit < 0 || (format != "json" && format != "table") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open parquet file: %w", err)
+	}
+	defer f.Close()
+
+	reader, err := newReader(f, filter, read, decryption)
+	if err != nil {
+		return err
+	}
+
+	projection, err := reader.Project(strings.Split(fields, ","))
+	if err != nil {
+		return err
+	}
+
+	paths := projection.Paths()
+	var w *tabwriter.Writer
+	if format == "table" {
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintf(w, "row\t%s\t\n", strings.Join(paths, "\t"))
+	}
+
+	printed := 0
+	err = projection.Scan(context.Background(), func(row *internal.Row) error {
+		if limit > 0 && printed >= limit {
+			return errLimitReached
+		}
+		printed++
+
+		if w != nil {
+			fmt.Fprintf(w, "%d\t", row.Index)
+			for _, v := range row.Values {
+				fmt.Fprintf(w, "%s\t", formatValue(v))
+			}
+			fmt.Fprintln(w)
+			return nil
+		}
+
+		// 列の順序を保つため、オブジェクトは1つずつ書き出す
+		var buf strings.Builder
+		buf.WriteByte('{')
+		for i, v := range row.Values {
+			j, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("failed to marshal value of row %d: %w", row.Index, err)
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(&buf, "%s:%s", strconv.Quote(paths[i]), j)
+		}
+		buf.WriteByte('}')
+		fmt.Println(buf.String())
+		return nil
+	})
+	if err != nil && !errors.Is(err, errLimitReached) {
+		return err
+	}
+
+	if w != nil {
+		w.Flush()
+	}
+
+	return printReports(reader, format)
+}
+
+func query(path string, sql string, format string, read *readFlags, decryption *decryptionFlags) error {
+	if len(path) == 0 || len(sql) == 0 || (format != "json" && format != "table") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	q, err := internal.ParseQuery(sql)
+	if err != nil {
+		return fmt.Errorf("failed to parse query: %w", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open parquet file: %w", err)
+	}
+	defer f.Close()
+
+	// 先頭にEXPLAINを付けたSQLは、--explainと同様に読み取りの記録を出力する
+	if q.Explain {
+		*read.explain = true
+	}
+
+	reader, err := newReader(f, "", read, decryption)
+	if err != nil {
+		return err
+	}
+
+	result, err := reader.Query(context.Background(), q)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	if format == "table" {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintf(w, "%s\t\n", strings.Join(result.Columns, "\t"))
+		for _, row := range result.Rows {
+			for _, v := range row {
+				fmt.Fprintf(w, "%s\t", formatValue(v))
+			}
+			fmt.Fprintln(w)
+		}
+		w.Flush()
+	} else {
+		j, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal query result: %w", err)
+		}
+
+		fmt.Println(string(j))
+	}
+
+	if err := printSalvageReport(reader); err != nil {
+		return err
+	}
+	return printExplain(result.Explain, format)
+}
+
+func verify(path string, decryption *decryptionFlags) (bool, error) {
+	if len(path) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open parquet file: %w", err)
+	}
+	defer f.Close()
+
+	par, err := newParquet(f, decryption)
+	if err != nil {
+		return false, err
+	}
+
+	report, err := par.Verify(context.Background())
+	if err != nil {
+		return false, fmt.Errorf("failed to verify parquet file: %w", err)
+	}
+
+	j, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal verification report: %w", err)
+	}
+
+	fmt.Println(string(j))
+	return report.Valid, nil
+}
+
+func recoverFooter(path, schemaPath, schemaFrom, codec string, rowsPerGroup int64, out string) error {
+	if len(path) == 0 || (len(schemaPath) == 0 && len(schemaFrom) == 0) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts, err := recoveryOptions(schemaPath, schemaFrom)
+	if err != nil {
+		return err
+	}
+
+	if len(codec) > 0 {
+		c, err := parquet.CompressionCodecFromString(codec)
+		if err != nil {
+			return fmt.Errorf("invalid codec: %w", err)
+		}
+		opts.Codec = &c
+	}
+	if rowsPerGroup > 0 {
+		opts.RowsPerGroup = rowsPerGroup
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open parquet file: %w", err)
+	}
+	defer f.Close()
+
+	par, err := openParquet(f)
+	if err != nil {
+		return err
+	}
+
+	result, err := par.Recover(context.Background(), opts)
+	if err != nil {
+		return fmt.Errorf("failed to recover footer: %w", err)
+	}
+
+	if len(out) > 0 {
+		w, err := os.Create(out)
+		if err != nil {
+			return fmt.Errorf("failed to create repaired file: %w", err)
+		}
+		defer w.Close()
+
+		if err := par.WriteRecovered(context.Background(), w, result); err != nil {
+			return fmt.Errorf("failed to write repaired file: %w", err)
+		}
+	}
+
+	j, err := json.MarshalIndent(map[string]any{
+		"row_groups":   len(result.MetaData.RowGroups),
+		"total_rows":   result.MetaData.TotalRows,
+		"data_end":     result.DataEnd,
+		"scanned_end":  result.ScannedEnd,
+		"dropped_rows": result.DroppedRows,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal recovery result: %w", err)
+	}
+
+	fmt.Println(string(j))
 	return nil
 }
+
+func recoveryOptions(schemaPath, schemaFrom string) (*internal.RecoveryOptions, error) {
+	if len(schemaFrom) > 0 {
+		f, err := os.Open(schemaFrom)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open sibling parquet file: %w", err)
+		}
+		defer f.Close()
+
+		par, err := openParquet(f)
+		if err != nil {
+			return nil, err
+		}
+
+		meta, err := par.Inspect(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect sibling parquet file: %w", err)
+		}
+
+		return internal.RecoveryOptionsFromMetaData(meta), nil
+	}
+
+	j, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema file: %w", err)
+	}
+
+	opts := &internal.RecoveryOptions{}
+	if err := json.Unmarshal(j, &opts.Schema); err != nil {
+		return nil, fmt.Errorf("failed to parse schema file: %w", err)
+	}
+
+	return opts, nil
+}
+
+// 暗号化されたファイルを読み取るための、サブコマンド共通のオプション
+type decryptionFlags struct {
+	footerKey  *string
+	columnKeys *string
+	keys       *string
+	aadPrefix  *string
+}
+
+func addDecryptionFlags(cmd *flag.FlagSet) *decryptionFlags {
+	return &decryptionFlags{
+		footerKey:  cmd.String("footer-key", "", "hex encoded footer key of encrypted parquet file"),
+		columnKeys: cmd.String("column-keys", "", "hex encoded column keys of encrypted parquet file(format: path1=key1,path2=key2)"),
+		keys:       cmd.String("keys", "", "hex encoded keys identified by key metadata(format: metadata1=key1,metadata2=key2)"),
+		aadPrefix:  cmd.String("aad-prefix", "", "AAD prefix which is not stored in encrypted parquet file"),
+	}
+}
+
+func (d *decryptionFlags) config() (*internal.DecryptionConfig, error) {
+	if len(*d.footerKey) == 0 && len(*d.columnKeys) == 0 && len(*d.keys) == 0 && len(*d.aadPrefix) == 0 {
+		return nil, nil
+	}
+
+	config := &internal.DecryptionConfig{}
+	if len(*d.footerKey) > 0 {
+		key, err := hex.DecodeString(*d.footerKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid footer key: %w", err)
+		}
+		config.FooterKey = key
+	}
+
+	columnKeys, err := parseKeys(*d.columnKeys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid column keys: %w", err)
+	}
+	config.ColumnKeys = columnKeys
+
+	keys, err := parseKeys(*d.keys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keys: %w", err)
+	}
+	config.KeyRetriever = internal.StaticKeyRetriever(keys)
+
+	if len(*d.aadPrefix) > 0 {
+		config.AADPrefix = []byte(*d.aadPrefix)
+	}
+
+	return config, nil
+}
+
+// 行を読み取るサブコマンド共通のオプション
+type readFlags struct {
+	verifyChecksum *bool
+	salvage        *bool
+	explain        *bool
+	workers        *int
+}
+
+func addReadFlags(cmd *flag.FlagSet) *readFlags {
+	return &readFlags{
+		verifyChecksum: cmd.Bool("verify-checksum", false, "verify CRC32 checksum of each page"),
+		salvage:        cmd.Bool("salvage", false, "skip corrupted pages instead of aborting(skipped pages are reported to stderr, and rows in them are left out)"),
+		explain:        cmd.Bool("explain", false, "report pruned row groups and pages, bytes read and decode time per column to stderr"),
+		workers:        cmd.Int("workers", 1, "number of workers reading row groups in parallel(0 means number of CPUs)"),
+	}
+}
+
+func parseKeys(arg string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	if len(arg) == 0 {
+		return keys, nil
+	}
+
+	for _, pair := range strings.Split(arg, ",") {
+		name, encoded, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("'%s' is not formatted as name=key", pair)
+		}
+
+		key, err := hex.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key of '%s' is not hex encoded: %w", name, err)
+		}
+		keys[name] = key
+	}
+
+	return keys, nil
+}
+
+// 行の読み取りに関するサブコマンド共通のオプションから、Readerを作る
+func newReader(f *os.File, filter string, read *readFlags, decryption *decryptionFlags) (*internal.Reader, error) {
+	par, err := newParquet(f, decryption)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []internal.ReaderOption
+	if *read.verifyChecksum {
+		opts = append(opts, internal.WithChecksumVerification())
+	}
+	if *read.salvage {
+		opts = append(opts, internal.WithSalvage())
+	}
+	if *read.explain {
+		opts = append(opts, internal.WithExplain())
+	}
+	workers := *read.workers
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > 1 {
+		opts = append(opts, internal.WithWorkers(workers))
+	}
+	if len(filter) > 0 {
+		expr, err := internal.ParseFilter(filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse filter: %w", err)
+		}
+		opts = append(opts, internal.WithFilter(expr))
+	}
+
+	reader, err := internal.NewReader(context.Background(), par, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reader: %w", err)
+	}
+
+	return reader, nil
+}
+
+// サルベージモードで読み飛ばしたデータと読み取りの記録を、標準エラー出力に出力する
+func printReports(reader *internal.Reader, format string) error {
+	if err := printSalvageReport(reader); err != nil {
+		return err
+	}
+	return printExplain(reader.Explain(), format)
+}
+
+// サルベージモードで読み飛ばしたデータを、標準エラー出力に出力する
+func printSalvageReport(reader *internal.Reader) error {
+	report := reader.SalvageReport()
+	if report == nil {
+		return nil
+	}
+
+	j, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal salvage report: %w", err)
+	}
+
+	fmt.Fprintln(os.Stderr, string(j))
+	return nil
+}
+
+// 読み取りの記録(-explain)を、標準エラー出力に出力する
+func printExplain(explain *internal.Explain, format string) error {
+	if explain == nil {
+		return nil
+	}
+
+	if format != "table" {
+		j, err := json.MarshalIndent(explain, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal explain: %w", err)
+		}
+
+		fmt.Fprintln(os.Stderr, string(j))
+		return nil
+	}
+
+	if explain.Filter != "" {
+		fmt.Fprintf(os.Stderr, "filter: %s\n\n", explain.Filter)
+	}
+
+	optional := func(v *int64) string {
+		if v == nil {
+			return "-"
+		}
+		return strconv.FormatInt(*v, 10)
+	}
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "row_group\trows\tcandidate_rows\tselected_rows\tpruned\t")
+	for _, row := range explain.RowGroups {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t\n", row.RowGroup, row.Rows, optional(row.CandidateRows), optional(row.SelectedRows), row.Pruned)
+	}
+	w.Flush()
+	fmt.Fprintln(os.Stderr)
+
+	w = tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "row_group\tpath\tpages_read\tpages_skipped\tbytes_read\tbytes_skipped\tdecode_time\t")
+	printColumn := func(rowGroup string, col *internal.ColumnChunkExplain) {
+		path := col.Path
+		if col.DictionaryOnly {
+			path += "(dictionary only)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%s\t\n", rowGroup, path, col.PagesRead, col.PagesSkipped, col.BytesRead, col.BytesSkipped, col.DecodeTime)
+	}
+	for _, row := range explain.RowGroups {
+		for _, col := range row.Columns {
+			printColumn(strconv.Itoa(row.RowGroup), col)
+		}
+	}
+	for _, col := range explain.Columns {
+		printColumn("total", col)
+	}
+	w.Flush()
+
+	skipped := false
+	w = tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, row := range explain.RowGroups {
+		for _, col := range row.Columns {
+			for _, page := range col.SkippedPages {
+				if !skipped {
+					fmt.Fprintln(os.Stderr)
+					fmt.Fprintln(w, "row_group\tpath\tpage\toffset\tbytes\treason\t")
+					skipped = true
+				}
+
+				ordinal := strconv.Itoa(page.Page)
+				if page.Page < 0 {
+					ordinal = "rest"
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%s\t\n", row.RowGroup, col.Path, ordinal, page.Offset, page.Bytes, page.Reason)
+			}
+		}
+	}
+	w.Flush()
+
+	return nil
+}
+
+func newParquet(f *os.File, decryption *decryptionFlags) (*internal.Parquet, error) {
+	config, err := decryption.config()
+	if err != nil {
+		return nil, err
+	}
+
+	par, err := openParquet(f)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return par, nil
+	}
+
+	return internal.NewEncryptedParquet(f, par.Size(), config), nil
+}
+
+func openParquet(f *os.File) (*internal.Parquet, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get size of parquet file: %w", err)
+	}
+
+	return internal.NewParquet(f, stat.Size()), nil
+}
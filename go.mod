@@ -3,6 +3,8 @@ module github.com/murakmii/retsu
 go 1.21.0
 
 require (
-	github.com/DataDog/zstd v1.5.5 // indirect
-	github.com/apache/thrift v0.20.0 // indirect
+	github.com/DataDog/zstd v1.5.5
+	github.com/andybalholm/brotli v1.1.1
+	github.com/apache/thrift v0.20.0
+	github.com/golang/snappy v1.0.0
 )
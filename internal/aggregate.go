@@ -0,0 +1,901 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+type (
+	// 数値列の集計結果
+	// Funcsに含まれない集計の値は不定で、JSONにも出力しない
+	// 値が1つも無い場合、Sum、Min、Max及びAvgはnilになる
+	Aggregate struct {
+		Path      string
+		Funcs     AggregateFunc
+		Rows      int64 // 行グループの行数の合計(count(*))
+		Count     int64 // nullでない値の数
+		CountNull int64 // nullの数(繰り返しのある列では、空のリスト等の値を持たない位置を含む)
+		Sum       *Number
+		Min       *Number
+		Max       *Number
+		Avg       *Number
+		Variance  *Number // 標本分散(値が2つ未満ならnil)
+
+		MetadataRowGroups int // ページを読まずに、統計情報のみから集計した行グループの数
+		ScannedRowGroups  int // ページを読み取って集計した行グループの数
+		PrunedRowGroups   int // 条件式を満たす行を含まないため、読み飛ばした行グループの数
+	}
+
+	// 求める集計の組み合わせ
+	AggregateFunc int
+
+	// 集計結果の数値
+	// 整数及びDECIMALの値は、誤差が生じないようにスケール付きの任意精度の整数として保持する
+	Number struct {
+		unscaled *big.Int // 浮動小数点数ならnil
+		scale    int32
+		float    float64
+	}
+
+	aggregateKind int
+
+	// 行グループ毎の集計の途中結果
+	aggregatePart struct {
+		agg    *aggregator
+		rows   int64
+		source aggregateSource
+	}
+
+	// 行グループの集計の求め方
+	aggregateSource int
+
+	// 列の値を1つずつ集計する
+	// 整数は溢れるまでint64で足し合わせ、溢れた分や64ビットに収まらない値のみ任意精度の整数で扱う
+	aggregator struct {
+		kind    aggregateKind
+		typ     parquet.Type
+		size    int // 固定長の物理型の値のバイト数
+		scale   int32
+		divisor float64 // 平均・分散の計算で、整数をスケールに従って小数に戻すための除数
+
+		count int64
+		nulls int64
+
+		hasInt   bool // int64に収まる値があるか
+		sum      int64
+		sumBig   *big.Int
+		min, max int64
+		minBig   *big.Int // int64に収まらない値の最小値(無ければnil)
+		maxBig   *big.Int
+
+		sumFloat           float64
+		minFloat, maxFloat float64 // NaNを除いた最小値・最大値
+		hasFloat           bool
+
+		// 分散はWelfordのアルゴリズムで逐次的に計算する
+		mean float64
+		m2   float64
+	}
+)
+
+const (
+	AggregateCount AggregateFunc = 1 << iota
+	AggregateCountNull
+	AggregateSum
+	AggregateMin
+	AggregateMax
+	AggregateAvg
+	AggregateVariance
+
+	AggregateAll = AggregateCount | AggregateCountNull | AggregateSum | AggregateMin | AggregateMax | AggregateAvg | AggregateVariance
+
+	// 統計情報のみから求められる集計
+	aggregateFromStatistics = AggregateCount | AggregateCountNull | AggregateMin | AggregateMax
+)
+
+var aggregateFuncNames = []struct {
+	fn   AggregateFunc
+	name string
+}{
+	{AggregateCount, "count"},
+	{AggregateCountNull, "count_null"},
+	{AggregateSum, "sum"},
+	{AggregateMin, "min"},
+	{AggregateMax, "max"},
+	{AggregateAvg, "avg"},
+	{AggregateVariance, "variance"},
+}
+
+const (
+	aggregateInt    aggregateKind = iota // 符号付き整数(INT32又はINT64のDECIMALを含む)
+	aggregateUint32                      // 符号無し整数
+	aggregateUint64
+	aggregateFloat        // FLOAT、DOUBLE及びFLOAT16
+	aggregateDecimalBytes // BYTE_ARRAY又はFIXED_LEN_BYTE_ARRAYのDECIMAL
+	aggregateValues       // 数値でない列(値の数とnullの数のみを数える)
+)
+
+const (
+	aggregatePruned   aggregateSource = iota // 条件式を満たす行が無い
+	aggregateMetadata                        // 統計情報のみから求めた
+	aggregateScanned                         // ページを読み取って求めた
+)
+
+// 数値列の値の数、nullの数、合計、最小値、最大値、平均及び分散のうち、funcsで指定したものを求める
+// 浮動小数点数のNaNは最小値・最大値の対象外とするが、合計・平均・分散はNaNになる
+// 値の数、nullの数、最小値及び最大値のみを求める場合、統計情報が正確で信用できる行グループについてはページを読み取らない
+// 値の数及びnullの数のみを求める場合は、数値でない列も集計できる
+// 条件式(WithFilter)がある場合、条件式を満たす行のみを集計する
+func (r *Reader) Aggregate(ctx context.Context, path string, funcs AggregateFunc) (*Aggregate, error) {
+	schema := r.meta.FindSchema(path)
+	if schema == nil || !schema.IsLeaf() {
+		return nil, fmt.Errorf("'%s' column does not exist", path)
+	}
+
+	agg, err := newAggregatorFuncs(schema, funcs)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := runTasks(ctx, r, len(r.meta.RowGroups), func(ctx context.Context, r *Reader, i int) (*aggregatePart, error) {
+		return r.aggregateRowGroup(ctx, i, schema, funcs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 行グループ毎の途中結果を、行グループの順にマージする
+	result := &Aggregate{Path: path, Funcs: funcs}
+	for _, part := range parts {
+		result.Rows += part.rows
+		agg.merge(part.agg)
+
+		switch part.source {
+		case aggregatePruned:
+			result.PrunedRowGroups++
+		case aggregateMetadata:
+			result.MetadataRowGroups++
+		case aggregateScanned:
+			result.ScannedRowGroups++
+		}
+	}
+
+	agg.result(result)
+	return result, nil
+}
+
+// 整数の列の値の合計を求める(値が1つも無ければ0)
+// Aggregate で合計のみを求めるのと同じで、合計がint64に収まらない場合や、整数でない列の場合はエラーを返す
+func (r *Reader) SumInt64(ctx context.Context, path string) (int64, error) {
+	agg, err := r.Aggregate(ctx, path, AggregateSum)
+	if err != nil {
+		return 0, err
+	}
+
+	if agg.Sum == nil {
+		return 0, nil
+	}
+	if agg.Sum.unscaled == nil || agg.Sum.scale != 0 {
+		return 0, fmt.Errorf("'%s' column is not integer", path)
+	}
+	if !agg.Sum.unscaled.IsInt64() {
+		return 0, fmt.Errorf("sum of '%s' column overflows int64: %s", path, agg.Sum)
+	}
+
+	return agg.Sum.unscaled.Int64(), nil
+}
+
+// 行グループ内の列の値を集計する
+func (r *Reader) aggregateRowGroup(ctx context.Context, rowGroup int, schema *Schema, funcs AggregateFunc) (*aggregatePart, error) {
+	agg, err := newAggregatorFuncs(schema, funcs)
+	if err != nil {
+		return nil, err
+	}
+
+	part := &aggregatePart{agg: agg, source: aggregatePruned}
+	ranges, err := r.RowRanges(ctx, rowGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ranges) == 0 {
+		return part, nil
+	}
+
+	sel, err := r.selectRows(ctx, rowGroup, ranges)
+	if err != nil {
+		return nil, err
+	}
+
+	if sel != nil && sel.count() == 0 {
+		return part, nil
+	}
+
+	row := r.meta.RowGroups[rowGroup]
+	col := findColumn(row, schema.Path)
+	if col == nil {
+		return nil, fmt.Errorf("'%s' column does not exist in row group", schema.Path)
+	}
+
+	if sel == nil {
+		part.rows = row.NumRows
+		if agg.addStatistics(col, schema, funcs) {
+			part.source = aggregateMetadata
+			return part, nil
+		}
+	} else {
+		part.rows = sel.count()
+	}
+
+	err = r.scanColumnChunk(ctx, col, schema, scanOptions{sel: sel}, func(page *dataPage) error {
+		agg.addPage(page.selectRows(sel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	part.source = aggregateScanned
+	return part, nil
+}
+
+// カンマ区切りの集計の名前(count,sum等)を解釈する
+func ParseAggregateFuncs(names string) (AggregateFunc, error) {
+	var funcs AggregateFunc
+
+	for _, name := range strings.Split(names, ",") {
+		found := false
+		for _, f := range aggregateFuncNames {
+			if f.name == strings.TrimSpace(name) {
+				funcs |= f.fn
+				found = true
+			}
+		}
+
+		if !found {
+			return 0, fmt.Errorf("unknown aggregate function '%s'", name)
+		}
+	}
+
+	return funcs, nil
+}
+
+// 集計の名前を、countから順に返す
+func (funcs AggregateFunc) Names() []string {
+	names := make([]string, 0)
+	for _, f := range aggregateFuncNames {
+		if funcs&f.fn != 0 {
+			names = append(names, f.name)
+		}
+	}
+
+	return names
+}
+
+// 指定した集計の値を文字列として返す(値が無ければNULL)
+func (result *Aggregate) Format(fn AggregateFunc) string {
+	switch fn {
+	case AggregateCount:
+		return strconv.FormatInt(result.Count, 10)
+	case AggregateCountNull:
+		return strconv.FormatInt(result.CountNull, 10)
+	}
+
+	if n := result.number(fn); n != nil {
+		return n.String()
+	}
+	return "NULL"
+}
+
+func (result *Aggregate) number(fn AggregateFunc) *Number {
+	switch fn {
+	case AggregateSum:
+		return result.Sum
+	case AggregateMin:
+		return result.Min
+	case AggregateMax:
+		return result.Max
+	case AggregateAvg:
+		return result.Avg
+	case AggregateVariance:
+		return result.Variance
+	default:
+		return nil
+	}
+}
+
+// Funcsに含まれる集計のみを出力する
+func (result *Aggregate) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `{"path":%s,"rows":%d`, strconv.Quote(result.Path), result.Rows)
+	if err := result.writeFuncsJSON(&buf); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(&buf, `,"metadata_row_groups":%d,"scanned_row_groups":%d,"pruned_row_groups":%d}`,
+		result.MetadataRowGroups, result.ScannedRowGroups, result.PrunedRowGroups)
+	return buf.Bytes(), nil
+}
+
+// Funcsに含まれる集計を、JSONのオブジェクトのメンバーとして書き込む(先頭にカンマを付ける)
+func (result *Aggregate) writeFuncsJSON(buf *bytes.Buffer) error {
+	for _, f := range aggregateFuncNames {
+		if result.Funcs&f.fn == 0 {
+			continue
+		}
+
+		var value []byte
+		switch n := result.number(f.fn); {
+		case f.fn == AggregateCount || f.fn == AggregateCountNull:
+			value = []byte(result.Format(f.fn))
+		case n == nil:
+			value = []byte("null")
+		default:
+			j, err := n.MarshalJSON()
+			if err != nil {
+				return err
+			}
+			value = j
+		}
+
+		fmt.Fprintf(buf, `,%s:%s`, strconv.Quote(f.name), value)
+	}
+
+	return nil
+}
+
+func newAggregator(schema *Schema) (*aggregator, error) {
+	agg := &aggregator{typ: *schema.Type, size: schema.ValueSize(), divisor: 1}
+
+	decimal := schema.LogicalType != nil && schema.LogicalType.IsSetDECIMAL() ||
+		schema.ConvertedType != nil && *schema.ConvertedType == parquet.ConvertedType_DECIMAL
+	if decimal && schema.Scale != nil {
+		agg.scale = *schema.Scale
+		agg.divisor = math.Pow10(int(agg.scale))
+	}
+
+	switch *schema.Type {
+	case parquet.Type_INT32:
+		agg.kind = aggregateInt
+		if !decimal && columnSortOrder(schema) == sortOrderUnsigned {
+			agg.kind = aggregateUint32
+		}
+
+	case parquet.Type_INT64:
+		agg.kind = aggregateInt
+		if !decimal && columnSortOrder(schema) == sortOrderUnsigned {
+			agg.kind = aggregateUint64
+		}
+
+	case parquet.Type_FLOAT, parquet.Type_DOUBLE:
+		agg.kind = aggregateFloat
+
+	case parquet.Type_BYTE_ARRAY, parquet.Type_FIXED_LEN_BYTE_ARRAY:
+		switch {
+		case decimal:
+			agg.kind = aggregateDecimalBytes
+		case schema.LogicalType != nil && schema.LogicalType.IsSetFLOAT16() && schema.ValueSize() == 2:
+			agg.kind = aggregateFloat
+		default:
+			return nil, fmt.Errorf("'%s' column(%s) is not numeric", schema.Path, schema.Type)
+		}
+
+	default:
+		return nil, fmt.Errorf("'%s' column(%s) is not numeric", schema.Path, schema.Type)
+	}
+
+	return agg, nil
+}
+
+// funcsが値の数及びnullの数のみであれば、数値でない列でも値を数えるだけの集計を返す
+func newAggregatorFuncs(schema *Schema, funcs AggregateFunc) (*aggregator, error) {
+	agg, err := newAggregator(schema)
+	if err != nil && funcs&^(AggregateCount|AggregateCountNull) == 0 {
+		return &aggregator{kind: aggregateValues, typ: *schema.Type, divisor: 1}, nil
+	}
+
+	return agg, err
+}
+
+func (agg *aggregator) addPage(page *dataPage) {
+	nulls := page.nulls()
+	agg.nulls += int64(nulls)
+	if agg.kind == aggregateValues {
+		agg.count += int64(page.numValues - nulls)
+		return
+	}
+
+	values := page.values
+
+	switch values.Type {
+	case parquet.Type_INT32:
+		for _, v := range values.Int32 {
+			if agg.kind == aggregateUint32 {
+				agg.addInt(int64(uint32(v)))
+			} else {
+				agg.addInt(int64(v))
+			}
+		}
+
+	case parquet.Type_INT64:
+		for _, v := range values.Int64 {
+			if agg.kind == aggregateUint64 && v < 0 {
+				agg.addBig(new(big.Int).SetUint64(uint64(v)))
+			} else {
+				agg.addInt(v)
+			}
+		}
+
+	case parquet.Type_FLOAT:
+		for _, v := range values.Float {
+			agg.addFloat(float64(v))
+		}
+
+	case parquet.Type_DOUBLE:
+		for _, v := range values.Double {
+			agg.addFloat(v)
+		}
+
+	default:
+		for _, v := range values.Bytes {
+			agg.addBytes(v)
+		}
+	}
+}
+
+// values中のi番目の値を1つ集計する
+func (agg *aggregator) add(values *Values, i int) {
+	if agg.kind == aggregateValues {
+		agg.count++
+		return
+	}
+
+	switch values.Type {
+	case parquet.Type_INT32:
+		if agg.kind == aggregateUint32 {
+			agg.addInt(int64(uint32(values.Int32[i])))
+		} else {
+			agg.addInt(int64(values.Int32[i]))
+		}
+
+	case parquet.Type_INT64:
+		if v := values.Int64[i]; agg.kind == aggregateUint64 && v < 0 {
+			agg.addBig(new(big.Int).SetUint64(uint64(v)))
+		} else {
+			agg.addInt(v)
+		}
+
+	case parquet.Type_FLOAT:
+		agg.addFloat(float64(values.Float[i]))
+
+	case parquet.Type_DOUBLE:
+		agg.addFloat(values.Double[i])
+
+	default:
+		agg.addBytes(values.Bytes[i])
+	}
+}
+
+// values中のi番目の値を、浮動小数点数に変換する(DECIMALはスケールに従って小数に戻す)
+func (agg *aggregator) float(values *Values, i int) float64 {
+	switch values.Type {
+	case parquet.Type_INT32:
+		if agg.kind == aggregateUint32 {
+			return float64(uint32(values.Int32[i])) / agg.divisor
+		}
+		return float64(values.Int32[i]) / agg.divisor
+
+	case parquet.Type_INT64:
+		if agg.kind == aggregateUint64 {
+			return float64(uint64(values.Int64[i])) / agg.divisor
+		}
+		return float64(values.Int64[i]) / agg.divisor
+
+	case parquet.Type_FLOAT:
+		return float64(values.Float[i])
+
+	case parquet.Type_DOUBLE:
+		return values.Double[i]
+
+	default:
+		v := values.Bytes[i]
+		switch {
+		case agg.kind == aggregateFloat:
+			return float16ToFloat64(binary.LittleEndian.Uint16(v))
+		case len(v) <= 8:
+			return float64(signedBytesToInt64(v)) / agg.divisor
+		default:
+			f, _ := new(big.Float).SetInt(signedBytesToBig(v)).Float64()
+			return f / agg.divisor
+		}
+	}
+}
+
+// FLOAT16又はDECIMALのバイト列を集計する
+func (agg *aggregator) addBytes(v []byte) {
+	switch {
+	case agg.kind == aggregateFloat:
+		agg.addFloat(float16ToFloat64(binary.LittleEndian.Uint16(v)))
+	case len(v) <= 8:
+		agg.addInt(signedBytesToInt64(v))
+	default:
+		agg.addBig(signedBytesToBig(v))
+	}
+}
+
+func (agg *aggregator) addInt(v int64) {
+	agg.rangeInt(v)
+
+	sum := agg.sum + v
+	if (v > 0 && sum < agg.sum) || (v < 0 && sum > agg.sum) {
+		// 溢れる前の合計を任意精度の整数に移してから足し直す
+		agg.flushSum()
+		sum = v
+	}
+	agg.sum = sum
+
+	agg.observe(float64(v) / agg.divisor)
+}
+
+func (agg *aggregator) addBig(v *big.Int) {
+	agg.rangeBig(v)
+
+	agg.flushSum()
+	agg.sumBig.Add(agg.sumBig, v)
+
+	f, _ := new(big.Float).SetInt(v).Float64()
+	agg.observe(f / agg.divisor)
+}
+
+func (agg *aggregator) addFloat(v float64) {
+	agg.rangeFloat(v)
+
+	agg.sumFloat += v
+	agg.observe(v)
+}
+
+func (agg *aggregator) rangeInt(v int64) {
+	if !agg.hasInt || v < agg.min {
+		agg.min = v
+	}
+	if !agg.hasInt || v > agg.max {
+		agg.max = v
+	}
+	agg.hasInt = true
+}
+
+func (agg *aggregator) rangeBig(v *big.Int) {
+	if agg.minBig == nil || v.Cmp(agg.minBig) < 0 {
+		agg.minBig = v
+	}
+	if agg.maxBig == nil || v.Cmp(agg.maxBig) > 0 {
+		agg.maxBig = v
+	}
+}
+
+func (agg *aggregator) rangeFloat(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+
+	if !agg.hasFloat || v < agg.minFloat {
+		agg.minFloat = v
+	}
+	if !agg.hasFloat || v > agg.maxFloat {
+		agg.maxFloat = v
+	}
+	agg.hasFloat = true
+}
+
+// 列チャンクの統計情報のみで集計できる場合は、統計情報を集計に加えてtrueを返す
+// 統計情報が無いか、正確でない又は信用できない場合はfalseを返し、呼び出し元はページを読み取る必要がある
+func (agg *aggregator) addStatistics(col *ColumnChunk, schema *Schema, funcs AggregateFunc) bool {
+	stats := col.Statistics
+	if stats == nil || funcs&^aggregateFromStatistics != 0 {
+		return false
+	}
+
+	// 繰り返しのある列では、統計情報のnullの数の数え方がライターによって異なる
+	nullCountKnown := stats.NullCount != nil && *stats.NullCount >= 0 && *stats.NullCount <= col.NumValues && !schema.HasRepetitionLevels()
+	if funcs&(AggregateCount|AggregateCountNull) != 0 && !nullCountKnown {
+		return false
+	}
+
+	// 全ての値がnullなら、最小値・最大値は無くて良い
+	allNull := nullCountKnown && *stats.NullCount == col.NumValues
+	if funcs&(AggregateMin|AggregateMax) != 0 && !allNull {
+		if stats.Untrusted != "" || !stats.MinExact || !stats.MaxExact || !agg.validStatistic(stats.Min) || !agg.validStatistic(stats.Max) {
+			return false
+		}
+
+		agg.rangeStatistic(stats.Min)
+		agg.rangeStatistic(stats.Max)
+	}
+
+	if nullCountKnown {
+		agg.count += col.NumValues - *stats.NullCount
+		agg.nulls += *stats.NullCount
+	}
+
+	return true
+}
+
+// 統計情報の最小値・最大値(PLAINエンコーディングされた値)として妥当か
+func (agg *aggregator) validStatistic(v []byte) bool {
+	switch {
+	case v == nil:
+		return false
+	case agg.kind == aggregateDecimalBytes && agg.typ == parquet.Type_BYTE_ARRAY:
+		return len(v) > 0
+	default:
+		return len(v) == agg.size
+	}
+}
+
+func (agg *aggregator) rangeStatistic(v []byte) {
+	switch agg.typ {
+	case parquet.Type_INT32:
+		if agg.kind == aggregateUint32 {
+			agg.rangeInt(int64(binary.LittleEndian.Uint32(v)))
+		} else {
+			agg.rangeInt(int64(int32(binary.LittleEndian.Uint32(v))))
+		}
+
+	case parquet.Type_INT64:
+		u := binary.LittleEndian.Uint64(v)
+		if agg.kind == aggregateUint64 && u > math.MaxInt64 {
+			agg.rangeBig(new(big.Int).SetUint64(u))
+		} else {
+			agg.rangeInt(int64(u))
+		}
+
+	case parquet.Type_FLOAT:
+		agg.rangeFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(v))))
+
+	case parquet.Type_DOUBLE:
+		agg.rangeFloat(math.Float64frombits(binary.LittleEndian.Uint64(v)))
+
+	default:
+		switch {
+		case agg.kind == aggregateFloat:
+			agg.rangeFloat(float16ToFloat64(binary.LittleEndian.Uint16(v)))
+		case len(v) <= 8:
+			agg.rangeInt(signedBytesToInt64(v))
+		default:
+			agg.rangeBig(signedBytesToBig(v))
+		}
+	}
+}
+
+// 別に集計した途中結果を加える
+// 平均と偏差平方和は、Chanらの方法で2つの集合のものから求める
+func (agg *aggregator) merge(other *aggregator) {
+	if other.hasInt {
+		agg.rangeInt(other.min)
+		agg.rangeInt(other.max)
+	}
+	if other.minBig != nil {
+		agg.rangeBig(other.minBig)
+		agg.rangeBig(other.maxBig)
+	}
+	if other.hasFloat {
+		agg.rangeFloat(other.minFloat)
+		agg.rangeFloat(other.maxFloat)
+	}
+
+	sum := agg.sum + other.sum
+	if (other.sum > 0 && sum < agg.sum) || (other.sum < 0 && sum > agg.sum) {
+		agg.flushSum()
+		sum = other.sum
+	}
+	agg.sum = sum
+
+	if other.sumBig != nil {
+		agg.flushSum()
+		agg.sumBig.Add(agg.sumBig, other.sumBig)
+	}
+	agg.sumFloat += other.sumFloat
+
+	switch {
+	case other.count == 0:
+	case agg.count == 0:
+		agg.mean, agg.m2 = other.mean, other.m2
+	default:
+		n := float64(agg.count + other.count)
+		delta := other.mean - agg.mean
+		agg.mean += delta * float64(other.count) / n
+		agg.m2 += other.m2 + delta*delta*float64(agg.count)*float64(other.count)/n
+	}
+
+	agg.count += other.count
+	agg.nulls += other.nulls
+}
+
+func (agg *aggregator) flushSum() {
+	if agg.sumBig == nil {
+		agg.sumBig = new(big.Int)
+	}
+
+	agg.sumBig.Add(agg.sumBig, big.NewInt(agg.sum))
+	agg.sum = 0
+}
+
+// 値の数を数え、平均と偏差平方和を更新する
+func (agg *aggregator) observe(v float64) {
+	agg.count++
+	delta := v - agg.mean
+	agg.mean += delta / float64(agg.count)
+	agg.m2 += delta * (v - agg.mean)
+}
+
+func (agg *aggregator) result(result *Aggregate) {
+	result.Count, result.CountNull = agg.count, agg.nulls
+
+	if agg.kind == aggregateFloat {
+		if agg.hasFloat {
+			result.Min = &Number{float: agg.minFloat}
+			result.Max = &Number{float: agg.maxFloat}
+		} else if agg.count > 0 {
+			// NaNのみの場合
+			result.Min = &Number{float: math.NaN()}
+			result.Max = &Number{float: math.NaN()}
+		}
+	} else {
+		min, max := agg.minBig, agg.maxBig
+		if agg.hasInt && (min == nil || big.NewInt(agg.min).Cmp(min) < 0) {
+			min = big.NewInt(agg.min)
+		}
+		if agg.hasInt && (max == nil || big.NewInt(agg.max).Cmp(max) > 0) {
+			max = big.NewInt(agg.max)
+		}
+		if min != nil {
+			result.Min = &Number{unscaled: min, scale: agg.scale}
+			result.Max = &Number{unscaled: max, scale: agg.scale}
+		}
+	}
+
+	// 統計情報のみから集計した場合、合計・平均・分散は求められていないのでここで終わる
+	if agg.count == 0 || result.Funcs&^aggregateFromStatistics == 0 {
+		return
+	}
+
+	if agg.count > 1 {
+		result.Variance = &Number{float: agg.m2 / float64(agg.count-1)}
+	}
+
+	if agg.kind == aggregateFloat {
+		result.Sum = &Number{float: agg.sumFloat}
+		result.Avg = &Number{float: agg.mean}
+		return
+	}
+
+	sum := big.NewInt(agg.sum)
+	if agg.sumBig != nil {
+		sum.Add(sum, agg.sumBig)
+	}
+	result.Sum = &Number{unscaled: sum, scale: agg.scale}
+
+	// 平均は誤差の少ないように、正確な合計から求める
+	avg, _ := new(big.Rat).SetFrac(sum, new(big.Int).Mul(big.NewInt(agg.count), pow10(agg.scale))).Float64()
+	result.Avg = &Number{float: avg}
+}
+
+// 小数として表した文字列を返す
+func (n *Number) String() string {
+	if n.unscaled == nil {
+		// encoding/jsonと同様に、極端に大きい又は小さい値のみ指数表記にする
+		if abs := math.Abs(n.float); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+			return strconv.FormatFloat(n.float, 'e', -1, 64)
+		}
+		return strconv.FormatFloat(n.float, 'f', -1, 64)
+	}
+
+	if n.scale <= 0 {
+		return new(big.Int).Mul(n.unscaled, pow10(-n.scale)).String()
+	}
+
+	digits := new(big.Int).Abs(n.unscaled).String()
+	if len(digits) <= int(n.scale) {
+		digits = strings.Repeat("0", int(n.scale)-len(digits)+1) + digits
+	}
+
+	point := len(digits) - int(n.scale)
+	s := digits[:point] + "." + digits[point:]
+	if n.unscaled.Sign() < 0 {
+		s = "-" + s
+	}
+
+	return s
+}
+
+// 浮動小数点数に変換する(整数・DECIMALでは誤差が生じ得る)
+func (n *Number) Float64() float64 {
+	if n.unscaled == nil {
+		return n.float
+	}
+
+	f, _ := new(big.Rat).SetFrac(n.unscaled, pow10(n.scale)).Float64()
+	return f
+}
+
+// 数値の大小を比較する(NaNは他のどの値よりも大きいものとする)
+// 整数・DECIMAL同士は誤差無く比較し、浮動小数点数を含む場合は浮動小数点数として比較する
+func (n *Number) compare(other *Number) int {
+	if n.unscaled != nil && other.unscaled != nil {
+		a, b := n.unscaled, other.unscaled
+		if n.scale != other.scale {
+			a = new(big.Int).Mul(a, pow10(other.scale-n.scale))
+			b = new(big.Int).Mul(b, pow10(n.scale-other.scale))
+		}
+		return a.Cmp(b)
+	}
+
+	a, b := n.Float64(), other.Float64()
+	switch {
+	case math.IsNaN(a) && math.IsNaN(b):
+		return 0
+	case math.IsNaN(a):
+		return 1
+	case math.IsNaN(b):
+		return -1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// JSONの数値として出力する
+// JSONで表現できないNaN及び無限大は文字列として出力する
+func (n *Number) MarshalJSON() ([]byte, error) {
+	if n.unscaled == nil && (math.IsNaN(n.float) || math.IsInf(n.float, 0)) {
+		return []byte(strconv.Quote(n.String())), nil
+	}
+
+	return []byte(n.String()), nil
+}
+
+// 10のn乗(nが負なら1)
+func pow10(n int32) *big.Int {
+	if n <= 0 {
+		return big.NewInt(1)
+	}
+
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// ビッグエンディアンの2の補数で表現された、8バイト以下の整数を変換する
+func signedBytesToInt64(v []byte) int64 {
+	if len(v) == 0 {
+		return 0
+	}
+
+	var u uint64
+	for _, b := range v {
+		u = u<<8 | uint64(b)
+	}
+
+	// 符号拡張する
+	shift := 64 - 8*len(v)
+	return int64(u<<shift) >> shift
+}
+
+// ビッグエンディアンの2の補数で表現された、任意の長さの整数を変換する
+func signedBytesToBig(v []byte) *big.Int {
+	n := new(big.Int).SetBytes(v)
+	if len(v) > 0 && v[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(8*len(v))))
+	}
+
+	return n
+}
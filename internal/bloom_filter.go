@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+type (
+	// Split Block Bloom Filter
+	// https://github.com/apache/parquet-format/blob/master/BloomFilter.md
+	BloomFilter struct {
+		blocks [][8]uint32 // 256ビットのブロックの列
+	}
+)
+
+// ブロック内の各ワードでビット位置を決めるためのソルト
+var bloomFilterSalt = [8]uint32{
+	0x47b6137b, 0x44974d91, 0x8824ad5b, 0xa2b7289d,
+	0x705495c7, 0x2df1424b, 0x9efc4947, 0x5c6bfb31,
+}
+
+// 列チャンクのブルームフィルタを読み取る
+// ブルームフィルタを持たない列チャンクの場合はnilを返す
+func (par *Parquet) ReadBloomFilter(ctx context.Context, col *ColumnChunk) (*BloomFilter, error) {
+	if !col.HasBloomFilter() {
+		return nil, nil
+	}
+
+	cur := par.cursorAt(*col.BloomFilterOffset)
+
+	header := &parquet.BloomFilterHeader{}
+	if err := cur.readColumnThrift(ctx, col, moduleBloomFilterHeader, -1, header); err != nil {
+		return nil, fmt.Errorf("failed to read bloom filter header: %w", err)
+	}
+
+	if !header.Algorithm.IsSetBLOCK() {
+		return nil, fmt.Errorf("unsupported bloom filter algorithm: %s", header.Algorithm)
+	}
+	if !header.Hash.IsSetXXHASH() {
+		return nil, fmt.Errorf("unsupported bloom filter hash: %s", header.Hash)
+	}
+	if !header.Compression.IsSetUNCOMPRESSED() {
+		return nil, fmt.Errorf("unsupported bloom filter compression: %s", header.Compression)
+	}
+	if header.NumBytes <= 0 || header.NumBytes%32 != 0 {
+		return nil, fmt.Errorf("invalid bloom filter size: %d", header.NumBytes)
+	}
+
+	bitset, err := cur.readColumnBytes(col, moduleBloomFilterBitset, -1, int64(header.NumBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bloom filter bitset: %w", err)
+	}
+	if len(bitset) != int(header.NumBytes) {
+		return nil, fmt.Errorf("bloom filter bitset has %d bytes, but header says %d bytes", len(bitset), header.NumBytes)
+	}
+
+	return newBloomFilter(bitset), nil
+}
+
+func newBloomFilter(bitset []byte) *BloomFilter {
+	bf := &BloomFilter{blocks: make([][8]uint32, len(bitset)/32)}
+	for i := range bf.blocks {
+		for j := 0; j < 8; j++ {
+			bf.blocks[i][j] = binary.LittleEndian.Uint32(bitset[i*32+j*4:])
+		}
+	}
+
+	return bf
+}
+
+// PLAINエンコーディングされた値が含まれている可能性があるかどうかを返す
+// falseの場合は確実に含まれていない
+func (bf *BloomFilter) MightContain(plain []byte) bool {
+	return bf.check(xxHash64(plain))
+}
+
+func (bf *BloomFilter) check(hash uint64) bool {
+	// ハッシュ値の上位32ビットでブロックを、下位32ビットでブロック内のビットを決定する
+	block := bf.blocks[((hash>>32)*uint64(len(bf.blocks)))>>32]
+	key := uint32(hash)
+
+	for i, salt := range bloomFilterSalt {
+		mask := uint32(1) << ((key * salt) >> 27)
+		if block[i]&mask == 0 {
+			return false
+		}
+	}
+
+	return true
+}
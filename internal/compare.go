@@ -0,0 +1,266 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+type (
+	// 列のソート順に従って、PLAINエンコーディングされた値同士を比較する
+	// BYTE_ARRAYの値は長さを含まない値そのもののバイト列とする(統計情報やページインデックスと同じ表現)
+	Comparator struct {
+		path   string
+		kind   compareKind
+		length int // 値のバイト数(可変長なら0)
+	}
+
+	compareKind int
+)
+
+const (
+	compareBoolean compareKind = iota
+	compareInt32               // 符号付き整数(DECIMAL、日付・時刻を含む)
+	compareUint32              // 符号無し整数
+	compareInt64
+	compareUint64
+	compareFloat // 浮動小数点数(-0.0と+0.0は等しく、NaNは他のどの値よりも大きい)
+	compareDouble
+	compareFloat16       // FIXED_LEN_BYTE_ARRAY(2)に格納された半精度浮動小数点数
+	compareUnsignedBytes // バイト列の辞書順(文字列等)
+	compareDecimalBytes  // ビッグエンディアンの2の補数で表現された、符号付き整数としてのバイト列
+)
+
+// 列の値を比較するComparatorを返す
+// フッターのcolumn_ordersで列のソート順が未定義とされている場合はエラーを返す
+func (meta *MetaData) Comparator(path string) (*Comparator, error) {
+	schema := meta.FindSchema(path)
+	if schema == nil || !schema.IsLeaf() {
+		return nil, fmt.Errorf("'%s' column does not exist", path)
+	}
+
+	if !meta.columnOrderDefined(schema) {
+		return nil, fmt.Errorf("sort order of '%s' column is undefined in column orders", path)
+	}
+
+	return NewComparator(schema)
+}
+
+// スキーマの物理型と論理型からComparatorを作る
+// INT96やINTERVAL等、ソート順が定義されていない型の場合はエラーを返す
+func NewComparator(schema *Schema) (*Comparator, error) {
+	c := &Comparator{path: schema.Path, length: schema.ValueSize()}
+	order := columnSortOrder(schema)
+	if order == sortOrderUnknown {
+		return nil, fmt.Errorf("sort order of '%s' column(%s) is unknown", schema.Path, schema.Type)
+	}
+
+	switch *schema.Type {
+	case parquet.Type_BOOLEAN:
+		c.kind = compareBoolean
+
+	case parquet.Type_INT32:
+		c.kind = compareInt32
+		if order == sortOrderUnsigned {
+			c.kind = compareUint32
+		}
+
+	case parquet.Type_INT64:
+		c.kind = compareInt64
+		if order == sortOrderUnsigned {
+			c.kind = compareUint64
+		}
+
+	case parquet.Type_FLOAT:
+		c.kind = compareFloat
+
+	case parquet.Type_DOUBLE:
+		c.kind = compareDouble
+
+	case parquet.Type_BYTE_ARRAY, parquet.Type_FIXED_LEN_BYTE_ARRAY:
+		switch {
+		case schema.LogicalType != nil && schema.LogicalType.IsSetFLOAT16():
+			c.kind = compareFloat16
+		case order == sortOrderSigned:
+			// バイト列で符号付きのソート順を持つのはDECIMALのみ
+			c.kind = compareDecimalBytes
+		default:
+			c.kind = compareUnsignedBytes
+		}
+
+	default:
+		return nil, fmt.Errorf("'%s' column(%s) can not be compared", schema.Path, schema.Type)
+	}
+
+	return c, nil
+}
+
+// a < bなら負、a == bなら0、a > bなら正の値を返す
+func (c *Comparator) Compare(a, b []byte) (int, error) {
+	if err := c.check(a); err != nil {
+		return 0, err
+	}
+	if err := c.check(b); err != nil {
+		return 0, err
+	}
+
+	switch c.kind {
+	case compareBoolean:
+		return compareOrdered(a[0]&1, b[0]&1), nil
+
+	case compareInt32:
+		return compareOrdered(int32(binary.LittleEndian.Uint32(a)), int32(binary.LittleEndian.Uint32(b))), nil
+
+	case compareUint32:
+		return compareOrdered(binary.LittleEndian.Uint32(a), binary.LittleEndian.Uint32(b)), nil
+
+	case compareInt64:
+		return compareOrdered(int64(binary.LittleEndian.Uint64(a)), int64(binary.LittleEndian.Uint64(b))), nil
+
+	case compareUint64:
+		return compareOrdered(binary.LittleEndian.Uint64(a), binary.LittleEndian.Uint64(b)), nil
+
+	case compareFloat, compareDouble, compareFloat16:
+		return compareFloats(c.float(a), c.float(b)), nil
+
+	case compareDecimalBytes:
+		return compareSignedBytes(a, b), nil
+
+	default:
+		return bytes.Compare(a, b), nil
+	}
+}
+
+// 値がNaNかどうか
+// 浮動小数点数以外の列では常にfalseを返す
+func (c *Comparator) IsNaN(v []byte) bool {
+	return c.isFloat() && c.check(v) == nil && math.IsNaN(c.float(v))
+}
+
+func (c *Comparator) isFloat() bool {
+	return c.kind == compareFloat || c.kind == compareDouble || c.kind == compareFloat16
+}
+
+func (c *Comparator) check(v []byte) error {
+	if c.kind == compareUnsignedBytes || c.kind == compareDecimalBytes {
+		if c.length > 0 && len(v) != c.length {
+			return fmt.Errorf("value of '%s' column must be %d bytes, but got %d bytes", c.path, c.length, len(v))
+		}
+		return nil
+	}
+
+	length := c.length
+	if c.kind == compareFloat16 {
+		length = 2
+	}
+
+	if len(v) != length {
+		return fmt.Errorf("value of '%s' column must be %d bytes, but got %d bytes", c.path, length, len(v))
+	}
+
+	return nil
+}
+
+func (c *Comparator) float(v []byte) float64 {
+	switch c.kind {
+	case compareFloat:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(v)))
+	case compareFloat16:
+		return float16ToFloat64(binary.LittleEndian.Uint16(v))
+	default:
+		return math.Float64frombits(binary.LittleEndian.Uint64(v))
+	}
+}
+
+func compareOrdered[T uint8 | int32 | uint32 | int64 | uint64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// -0.0と+0.0は等しいものとして扱い、NaNは他のどの値よりも大きいものとする
+func compareFloats(a, b float64) int {
+	switch aNaN, bNaN := math.IsNaN(a), math.IsNaN(b); {
+	case aNaN && bNaN:
+		return 0
+	case aNaN:
+		return 1
+	case bNaN:
+		return -1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// 長さの異なるバイト列同士は、符号拡張して同じ長さに揃えてから比較する
+func compareSignedBytes(a, b []byte) int {
+	negativeA := len(a) > 0 && a[0]&0x80 != 0
+	negativeB := len(b) > 0 && b[0]&0x80 != 0
+	if negativeA != negativeB {
+		if negativeA {
+			return -1
+		}
+		return 1
+	}
+
+	// 符号が同じなら、符号拡張したバイト列の大小は符号無しで比較できる
+	var pad byte
+	if negativeA {
+		pad = 0xFF
+	}
+
+	n := max(len(a), len(b))
+	for i := 0; i < n; i++ {
+		x, y := signExtendedByte(a, n, i, pad), signExtendedByte(b, n, i, pad)
+		if x != y {
+			return compareOrdered(x, y)
+		}
+	}
+
+	return 0
+}
+
+func signExtendedByte(v []byte, n int, i int, pad byte) byte {
+	if i < n-len(v) {
+		return pad
+	}
+	return v[i-(n-len(v))]
+}
+
+// IEEE 754の半精度浮動小数点数を変換する
+func float16ToFloat64(h uint16) float64 {
+	exp := int(h>>10) & 0x1F
+	frac := float64(h & 0x3FF)
+
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(frac, -24)
+	case 0x1F:
+		if frac == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(frac+0x400, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		v = -v
+	}
+
+	return v
+}
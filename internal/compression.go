@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/DataDog/zstd"
+	"github.com/andybalholm/brotli"
+	"github.com/golang/snappy"
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+// 解凍できる圧縮形式
+// 圧縮形式の推測(ファイルの復元時)では、誤認しにくいものから順に試す
+var supportedCodecs = []parquet.CompressionCodec{
+	parquet.CompressionCodec_UNCOMPRESSED,
+	parquet.CompressionCodec_ZSTD,
+	parquet.CompressionCodec_GZIP,
+	parquet.CompressionCodec_SNAPPY,
+	parquet.CompressionCodec_LZ4_RAW,
+	parquet.CompressionCodec_LZ4,
+	parquet.CompressionCodec_BROTLI,
+}
+
+// sizeは解凍後のサイズ(ページヘッダのuncompressed_page_size)
+func decompress(codec parquet.CompressionCodec, data []byte, size int) ([]byte, error) {
+	switch codec {
+	case parquet.CompressionCodec_UNCOMPRESSED:
+		return data, nil
+
+	case parquet.CompressionCodec_ZSTD:
+		return zstd.Decompress(nil, data)
+
+	case parquet.CompressionCodec_SNAPPY:
+		return snappy.Decode(nil, data)
+
+	case parquet.CompressionCodec_GZIP:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return readAllSized(r, size)
+
+	case parquet.CompressionCodec_BROTLI:
+		return readAllSized(brotli.NewReader(bytes.NewReader(data)), size)
+
+	case parquet.CompressionCodec_LZ4_RAW:
+		return decompressLZ4Block(data, size)
+
+	case parquet.CompressionCodec_LZ4:
+		// 非推奨のLZ4は、Hadoopのフレーム形式で書き込むライターと、LZ4_RAWと同じ形式で書き込むライターがある
+		if decompressed, err := decompressHadoopLZ4(data, size); err == nil {
+			return decompressed, nil
+		}
+		return decompressLZ4Block(data, size)
+
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %s", codec)
+	}
+}
+
+func readAllSized(r io.Reader, size int) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Hadoopのフレーム形式では、ビッグエンディアンの解凍後のサイズ及び圧縮後のサイズに続いてLZ4のブロックが並ぶ
+func decompressHadoopLZ4(data []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, errors.New("hadoop lz4 frame is truncated")
+		}
+
+		frameSize := int(binary.BigEndian.Uint32(data))
+		blockSize := int(binary.BigEndian.Uint32(data[4:]))
+		data = data[8:]
+		if blockSize > len(data) || len(out)+frameSize > size {
+			return nil, errors.New("invalid hadoop lz4 frame")
+		}
+
+		block, err := decompressLZ4Block(data[:blockSize], frameSize)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, block...)
+		data = data[blockSize:]
+	}
+
+	if len(out) != size {
+		return nil, fmt.Errorf("hadoop lz4 frames have %d bytes, but %d bytes are expected", len(out), size)
+	}
+
+	return out, nil
+}
+
+// LZ4のブロック形式を解凍する
+// ブロックはリテラルと、既に出力したバイト列への参照の組(シーケンス)の繰り返しで構成される
+func decompressLZ4Block(data []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+
+	for i := 0; i < len(data); {
+		token := data[i]
+		i++
+
+		literals, n, err := lz4Length(data[i:], int(token>>4))
+		if err != nil {
+			return nil, err
+		}
+		i += n
+
+		if literals > len(data)-i || len(out)+literals > size {
+			return nil, errors.New("lz4 literals are truncated")
+		}
+		out = append(out, data[i:i+literals]...)
+		i += literals
+
+		// 最後のシーケンスはリテラルのみを持つ
+		if i == len(data) {
+			break
+		}
+
+		if len(data)-i < 2 {
+			return nil, errors.New("lz4 match offset is truncated")
+		}
+		offset := int(binary.LittleEndian.Uint16(data[i:]))
+		i += 2
+		if offset == 0 || offset > len(out) {
+			return nil, fmt.Errorf("invalid lz4 match offset(%d)", offset)
+		}
+
+		match, n, err := lz4Length(data[i:], int(token&0x0F))
+		if err != nil {
+			return nil, err
+		}
+		i += n
+		match += 4
+
+		if len(out)+match > size {
+			return nil, errors.New("lz4 block exceeds uncompressed size")
+		}
+
+		// 参照先と出力先は重なり得るので、1バイトずつコピーする
+		start := len(out) - offset
+		for j := 0; j < match; j++ {
+			out = append(out, out[start+j])
+		}
+	}
+
+	if len(out) != size {
+		return nil, fmt.Errorf("lz4 block has %d bytes, but %d bytes are expected", len(out), size)
+	}
+
+	return out, nil
+}
+
+// トークン内の長さが15の場合は、255未満のバイトが現れるまで後続のバイトを足し合わせる
+func lz4Length(data []byte, length int) (int, int, error) {
+	if length != 15 {
+		return length, 0, nil
+	}
+
+	for i, b := range data {
+		length += int(b)
+		if b != 255 {
+			return length, i + 1, nil
+		}
+	}
+
+	return 0, 0, errors.New("lz4 length is truncated")
+}
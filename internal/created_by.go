@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+type (
+	// フッターのcreated_byから読み取った、ファイルを書き込んだアプリケーションとそのバージョン
+	// 特定のバージョンのライターが持つ不具合を回避するために用いる
+	CreatedBy struct {
+		Raw         string `json:"raw"`
+		Application string `json:"application"`
+		Version     string `json:"version,omitempty"`
+		Build       string `json:"build,omitempty"`
+
+		version    [3]int // 数値として解釈したバージョン(parsedがtrueの場合のみ有効)
+		parsed     bool
+		prerelease bool // "1.8.0-SNAPSHOT" のようなリリース前のバージョン
+	}
+
+	// 既知のライターの不具合
+	writerDefect struct {
+		id          string
+		application string
+		fixedIn     [3]int // 不具合が修正されたバージョン
+	}
+)
+
+// 既知のライターの不具合
+const (
+	// parquet-mr 1.8.0より前は、BYTE_ARRAY及びFIXED_LEN_BYTE_ARRAYの統計情報の最小値・最大値が壊れている
+	defectCorruptBinaryStatistics = "PARQUET-251"
+
+	// parquet-mr 1.10.0より前は、統計情報の最小値・最大値を、列の型に関わらず符号付きで比較して求めている
+	defectSignedMinMaxMR = "PARQUET-686"
+
+	// parquet-cpp 1.3.0より前も同様に、統計情報の最小値・最大値を符号付きで比較して求めている
+	defectSignedMinMaxCPP = "PARQUET-1025"
+
+	// parquet-mr 1.2.9より前は、列チャンクのサイズに辞書ページのヘッダのサイズを含めていない
+	defectDictPageHeaderSize = "PARQUET-816"
+
+	// parquet-mr 1.11.1より前は、辞書ページがあってもdictionary_page_offsetを書き込まないことがある
+	defectDictPageOffsetUnset = "PARQUET-1850"
+)
+
+var writerDefects = []*writerDefect{
+	{id: defectCorruptBinaryStatistics, application: "parquet-mr", fixedIn: [3]int{1, 8, 0}},
+	{id: defectSignedMinMaxMR, application: "parquet-mr", fixedIn: [3]int{1, 10, 0}},
+	{id: defectSignedMinMaxCPP, application: "parquet-cpp", fixedIn: [3]int{1, 3, 0}},
+	{id: defectDictPageHeaderSize, application: "parquet-mr", fixedIn: [3]int{1, 2, 9}},
+	{id: defectDictPageOffsetUnset, application: "parquet-mr", fixedIn: [3]int{1, 11, 1}},
+}
+
+// "parquet-mr version 1.2.8 (build 0123abcd)" のような形式
+// バージョンやビルドを持たないもの("DuckDB" 等)もある
+var createdByPattern = regexp.MustCompile(`^(.+?)\s+version\s+(\S+)(?:\s+\(build\s+([^)]*)\))?`)
+
+// created_byを解析する
+// created_byが無い場合はnilを返す
+func ParseCreatedBy(createdBy *string) *CreatedBy {
+	if createdBy == nil || len(strings.TrimSpace(*createdBy)) == 0 {
+		return nil
+	}
+
+	c := &CreatedBy{Raw: *createdBy}
+
+	m := createdByPattern.FindStringSubmatch(strings.TrimSpace(*createdBy))
+	if m == nil {
+		c.Application = strings.TrimSpace(*createdBy)
+		return c
+	}
+
+	c.Application, c.Version, c.Build = m[1], m[2], m[3]
+
+	version, pre, _ := strings.Cut(c.Version, "-")
+	c.prerelease = len(pre) > 0
+
+	parts := strings.Split(version, ".")
+	if len(parts) > 3 {
+		return c
+	}
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return c
+		}
+		c.version[i] = n
+	}
+
+	c.parsed = true
+	return c
+}
+
+// 指定したアプリケーションの、指定したバージョンより前のものかどうか
+// バージョンが不明な場合はfalseを返す
+// リリース前のバージョンは、そのバージョンより前のものとして扱う
+func (c *CreatedBy) lessThan(application string, version [3]int) bool {
+	if c == nil || !c.parsed || c.Application != application {
+		return false
+	}
+
+	if c.version == version {
+		return c.prerelease
+	}
+
+	for i := range version {
+		if c.version[i] != version[i] {
+			return c.version[i] < version[i]
+		}
+	}
+
+	return false
+}
+
+// ファイルを書き込んだライターに該当する既知の不具合の一覧
+func (c *CreatedBy) defects() []string {
+	defects := make([]string, 0)
+	for _, defect := range writerDefects {
+		if c.lessThan(defect.application, defect.fixedIn) {
+			defects = append(defects, defect.id)
+		}
+	}
+
+	return defects
+}
+
+// 統計情報の最小値・最大値を信用できるかどうかを判定し、信用できない場合はその理由を返す
+// 最小値・最大値のうち、min_value/max_valueは列のソート順で、非推奨のmin/maxは符号付きで比較されている
+// created_byが無い場合は、PARQUET-251の不具合を持つparquet-mrによって書き込まれた可能性があるので、
+// バイト列の統計情報は信用しない(PARQUET-297)
+func (meta *MetaData) untrustedStatistics(schema *Schema, stats *parquet.Statistics) string {
+	order := columnSortOrder(schema)
+	if order == sortOrderUnknown {
+		return "unknown sort order"
+	}
+	if !meta.columnOrderDefined(schema) {
+		return "undefined column order"
+	}
+
+	binary := *schema.Type == parquet.Type_BYTE_ARRAY || *schema.Type == parquet.Type_FIXED_LEN_BYTE_ARRAY
+
+	if binary && meta.CreatedBy == nil {
+		return "PARQUET-297"
+	}
+	if binary && meta.hasDefect(defectCorruptBinaryStatistics) {
+		return defectCorruptBinaryStatistics
+	}
+
+	// 最小値と最大値が等しければ、比較の仕方に関わらず正しい
+	min, max := stats.MinValue, stats.MaxValue
+	legacy := !stats.IsSetMinValue() && !stats.IsSetMaxValue()
+	if legacy {
+		min, max = stats.Min, stats.Max
+	}
+
+	if order != sortOrderSigned && !bytes.Equal(min, max) {
+		if legacy {
+			return "deprecated min/max with non-signed sort order"
+		}
+
+		for _, id := range []string{defectSignedMinMaxMR, defectSignedMinMaxCPP} {
+			if meta.hasDefect(id) {
+				return id
+			}
+		}
+	}
+
+	return ""
+}
+
+func (meta *MetaData) hasDefect(id string) bool {
+	for _, defect := range meta.KnownDefects {
+		if defect == id {
+			return true
+		}
+	}
+
+	return false
+}
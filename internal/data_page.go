@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+type (
+	// デコードしたデータページ
+	dataPage struct {
+		numValues int      // nullを含む値の数(レベルの数)
+		repLevels []int32  // 繰り返しレベル(最大繰り返しレベルが0ならnil)
+		defLevels []int32  // 定義レベル(最大定義レベルが0ならnil)
+		values    *Values  // nullでない値(辞書のインデックスのまま読み取った場合はnil)
+		indices   []uint32 // 辞書のインデックスのまま読み取った場合の、nullでない値のインデックス
+		matched   bitset   // 辞書のビットセットを引いて読み取った場合の、インデックスがビットセットに含まれる値の位置
+		nonNulls  int      // nullでない値の数(valuesがnilの場合に用いる)
+		dict      *Values
+		maxDef    int32 // 値が存在する(nullでない)ことを表す定義レベル
+		firstRow  int64 // ページの先頭の、行グループ内での行の位置
+		header    *parquet.PageHeader
+	}
+)
+
+// 辞書ページをデコードする
+func decodeDictPage(header *parquet.PageHeader, data []byte, schema *Schema) (*Values, error) {
+	if header.Type != parquet.PageType_DICTIONARY_PAGE || header.DictionaryPageHeader == nil {
+		return nil, fmt.Errorf("page is not dictionary page: %s", header.Type)
+	}
+
+	dict := header.DictionaryPageHeader
+	if dict.Encoding != parquet.Encoding_PLAIN && dict.Encoding != parquet.Encoding_PLAIN_DICTIONARY {
+		return nil, fmt.Errorf("unsupported dictionary encoding: %s", dict.Encoding)
+	}
+	if dict.NumValues < 0 {
+		return nil, fmt.Errorf("invalid number of dictionary values: %d", dict.NumValues)
+	}
+
+	return decodePlain(schema, data, int(dict.NumValues))
+}
+
+// データページ(v1又はv2)をデコードする
+// dataは解凍済みのページ本体(v2の場合は、圧縮されていないレベルと解凍済みの値を連結したもの)
+// 辞書エンコーディングされた値は、optsに従いインデックスのまま、又は辞書のビットセットを引いた結果として返す
+func decodeDataPage(header *parquet.PageHeader, data []byte, schema *Schema, dict *Values, opts scanOptions) (*dataPage, error) {
+	page := &dataPage{header: header, maxDef: int32(schema.MaxDefinitionLevel)}
+	var encoding parquet.Encoding
+	var err error
+
+	switch {
+	case header.Type == parquet.PageType_DATA_PAGE && header.DataPageHeader != nil:
+		v1 := header.DataPageHeader
+		page.numValues = int(v1.NumValues)
+		encoding = v1.Encoding
+
+		if schema.HasRepetitionLevels() {
+			if page.repLevels, data, err = readLevelsV1(data, v1.RepetitionLevelEncoding, schema.MaxRepetitionLevel, page.numValues); err != nil {
+				return nil, fmt.Errorf("failed to read repetition levels: %w", err)
+			}
+		}
+		if schema.HasDefinitionLevels() {
+			if page.defLevels, data, err = readLevelsV1(data, v1.DefinitionLevelEncoding, schema.MaxDefinitionLevel, page.numValues); err != nil {
+				return nil, fmt.Errorf("failed to read definition levels: %w", err)
+			}
+		}
+
+	case header.Type == parquet.PageType_DATA_PAGE_V2 && header.DataPageHeaderV2 != nil:
+		// v2のレベルは長さを持たないRLE/ビットパッキングのハイブリッドで、長さはページヘッダにある
+		v2 := header.DataPageHeaderV2
+		page.numValues = int(v2.NumValues)
+		encoding = v2.Encoding
+
+		if _, err := levelsLength(v2, len(data)); err != nil {
+			return nil, err
+		}
+		repLen, defLen := int(v2.RepetitionLevelsByteLength), int(v2.DefinitionLevelsByteLength)
+
+		if schema.HasRepetitionLevels() {
+			if page.repLevels, err = decodeLevelsExactly(data[:repLen], schema.MaxRepetitionLevel, page.numValues); err != nil {
+				return nil, fmt.Errorf("failed to read repetition levels: %w", err)
+			}
+		}
+		if schema.HasDefinitionLevels() {
+			if page.defLevels, err = decodeLevelsExactly(data[repLen:repLen+defLen], schema.MaxDefinitionLevel, page.numValues); err != nil {
+				return nil, fmt.Errorf("failed to read definition levels: %w", err)
+			}
+		}
+		data = data[repLen+defLen:]
+
+	default:
+		return nil, fmt.Errorf("unsupported page type: %s", header.Type)
+	}
+
+	if page.numValues < 0 {
+		return nil, fmt.Errorf("invalid number of values: %d", page.numValues)
+	}
+
+	dictEncoded := encoding == parquet.Encoding_PLAIN_DICTIONARY || encoding == parquet.Encoding_RLE_DICTIONARY
+	if dictEncoded && dict != nil && opts.dictMatch != nil {
+		page.nonNulls = page.nonNullValues()
+		if page.matched, err = matchDictIndices(data, page.nonNulls, dict.Len(), *opts.dictMatch); err != nil {
+			return nil, fmt.Errorf("failed to read dictionary indices: %w", err)
+		}
+		page.dict = dict
+		return page, nil
+	}
+
+	if dictEncoded && dict != nil && opts.dictIndices {
+		if page.indices, err = decodeDictIndices(data, page.nonNullValues(), dict.Len()); err != nil {
+			return nil, fmt.Errorf("failed to read dictionary indices: %w", err)
+		}
+		page.nonNulls = len(page.indices)
+		page.dict = dict
+		return page, nil
+	}
+
+	if page.values, err = decodeValues(schema, encoding, data, page.nonNullValues(), dict); err != nil {
+		return nil, fmt.Errorf("failed to read values: %w", err)
+	}
+
+	return page, nil
+}
+
+// nullでない値の数
+func (page *dataPage) nonNullValues() int {
+	if page.defLevels == nil {
+		return page.numValues
+	}
+
+	n := 0
+	for _, level := range page.defLevels {
+		if level == page.maxDef {
+			n++
+		}
+	}
+
+	return n
+}
+
+// nullの数
+func (page *dataPage) nulls() int {
+	if page.values == nil {
+		return page.numValues - page.nonNulls
+	}
+	return page.numValues - page.values.Len()
+}
+
+// データページv1のレベルを読み取り、残りのバイト列と共に返す
+func readLevelsV1(data []byte, encoding parquet.Encoding, maxLevel int, num int) ([]int32, []byte, error) {
+	switch encoding {
+	case parquet.Encoding_RLE:
+		levels, rest, err := readLevels(data, maxLevel, num)
+		if err == nil && len(levels) < num {
+			err = fmt.Errorf("%d levels are encoded, but %d levels are expected", len(levels), num)
+		}
+		return levels, rest, err
+
+	case parquet.Encoding_BIT_PACKED:
+		return decodeBitPackedLevels(data, maxLevel, num)
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported level encoding: %s", encoding)
+	}
+}
+
+func decodeLevelsExactly(data []byte, maxLevel int, num int) ([]int32, error) {
+	levels, err := decodeLevels(data, maxLevel, num)
+	if err != nil {
+		return nil, err
+	}
+	if len(levels) < num {
+		return nil, fmt.Errorf("%d levels are encoded, but %d levels are expected", len(levels), num)
+	}
+
+	return levels, nil
+}
+
+// ページに含まれる行の数
+// 繰り返しのある列では、繰り返しレベルが0の位置を行の先頭とする
+func (page *dataPage) rows() int64 {
+	if page.repLevels == nil {
+		return int64(page.numValues)
+	}
+
+	var rows int64
+	for _, level := range page.repLevels {
+		if level == 0 {
+			rows++
+		}
+	}
+
+	return rows
+}
+
+// 選択した行の値のみを残したページを返す(selがnilならページをそのまま返す)
+// 繰り返しのある列で、ページの先頭が前のページから続く行の途中である場合、その位置はfirstRow-1行目として扱う
+func (page *dataPage) selectRows(sel *rowSelection) *dataPage {
+	if sel == nil {
+		return page
+	}
+
+	keep := make([]bool, page.numValues)
+	keepValues := make([]bool, 0, page.numValues-page.nulls())
+	row, kept := page.firstRow-1, 0
+
+	for i := range keep {
+		if page.repLevels == nil || page.repLevels[i] == 0 {
+			row++
+		}
+
+		keep[i] = sel.has(row)
+
+		if page.defLevels == nil || page.defLevels[i] == page.maxDef {
+			keepValues = append(keepValues, keep[i])
+		}
+		if keep[i] {
+			kept++
+		}
+	}
+
+	if kept == page.numValues {
+		return page
+	}
+
+	selected := &dataPage{numValues: kept, maxDef: page.maxDef, firstRow: page.firstRow, header: page.header, dict: page.dict}
+	if page.values != nil {
+		selected.values = page.values.filter(keepValues)
+	} else if page.matched != nil {
+		selected.matched = newBitset(len(keepValues))
+		for i, keep := range keepValues {
+			if keep && page.matched.has(i) {
+				selected.matched.set(selected.nonNulls)
+			}
+			if keep {
+				selected.nonNulls++
+			}
+		}
+	} else {
+		selected.indices = filterSlice(page.indices, keepValues)
+		selected.nonNulls = len(selected.indices)
+	}
+	if page.repLevels != nil {
+		selected.repLevels = filterSlice(page.repLevels, keep)
+	}
+	if page.defLevels != nil {
+		selected.defLevels = filterSlice(page.defLevels, keep)
+	}
+
+	return selected
+}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+)
+
+type (
+	// 列の値の種類数の推定結果(nullは数えない)
+	DistinctCount struct {
+		Path          string       `json:"path"`
+		Estimate      uint64       `json:"estimate"`
+		StandardError float64      `json:"standard_error"` // 推定値の相対標準誤差
+		Sketch        *HyperLogLog `json:"-"`              // 全ての行グループをマージしたスケッチ
+
+		DictionaryRowGroups int `json:"dictionary_row_groups"` // データページを読まずに、辞書ページのみから求めた行グループの数
+		ScannedRowGroups    int `json:"scanned_row_groups"`    // データページを読み取って求めた行グループの数
+		PrunedRowGroups     int `json:"pruned_row_groups"`     // 条件式を満たす行を含まないため、読み飛ばした行グループの数
+	}
+
+	// 行グループのスケッチの求め方
+	sketchSource int
+)
+
+const (
+	sketchPruned sketchSource = iota
+	sketchDictionary
+	sketchScanned
+)
+
+// 列の値の種類数を、HyperLogLogで推定する
+// 統計情報のdistinct_countはほとんどのライターが書き込まないので用いず、行グループ毎に求めたスケッチをマージする
+// 繰り返しのある列では、全ての位置の値を対象とする
+// 条件式(WithFilter)がある場合、条件式を満たす行の値のみを対象とする
+func (r *Reader) DistinctCount(ctx context.Context, path string, precision int) (*DistinctCount, error) {
+	sketch, err := NewHyperLogLog(precision)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]sketchSource, len(r.meta.RowGroups))
+	sketches, err := runTasks(ctx, r, len(r.meta.RowGroups), func(ctx context.Context, r *Reader, i int) (*HyperLogLog, error) {
+		rowSketch, source, err := r.sketchRowGroup(ctx, i, path, precision)
+		sources[i] = source
+		return rowSketch, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DistinctCount{Path: path, Sketch: sketch}
+	for i, rowSketch := range sketches {
+		switch sources[i] {
+		case sketchPruned:
+			result.PrunedRowGroups++
+		case sketchDictionary:
+			result.DictionaryRowGroups++
+		default:
+			result.ScannedRowGroups++
+		}
+
+		if err := sketch.Merge(rowSketch); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Estimate, result.StandardError = sketch.Estimate(), sketch.StandardError()
+	return result, nil
+}
+
+// 行グループ内の列の値のスケッチを求める
+// 行グループ毎にシリアライズして保存しておき、後でマージすることで再計算を避けられる
+func (r *Reader) RowGroupSketch(ctx context.Context, rowGroup int, path string, precision int) (*HyperLogLog, error) {
+	sketch, _, err := r.sketchRowGroup(ctx, rowGroup, path, precision)
+	return sketch, err
+}
+
+// 全てのデータページが辞書エンコーディングされている列チャンクでは、辞書の値が列チャンクの値の全てなので、
+// 条件式が無ければ辞書ページのみを読み取り、データページは読まない
+// 条件式がある場合も、辞書エンコーディングされたページについては出現した辞書のインデックスのみを記録し、その辞書の値を最後に1度ずつ加える
+func (r *Reader) sketchRowGroup(ctx context.Context, rowGroup int, path string, precision int) (*HyperLogLog, sketchSource, error) {
+	sketch, err := NewHyperLogLog(precision)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	schema := r.meta.FindSchema(path)
+	if schema == nil || !schema.IsLeaf() {
+		return nil, 0, fmt.Errorf("'%s' column does not exist", path)
+	}
+
+	ranges, err := r.RowRanges(ctx, rowGroup)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(ranges) == 0 {
+		return sketch, sketchPruned, nil
+	}
+
+	sel, err := r.selectRows(ctx, rowGroup, ranges)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if sel != nil && sel.count() == 0 {
+		return sketch, sketchPruned, nil
+	}
+
+	row := r.meta.RowGroups[rowGroup]
+	col := findColumn(row, path)
+	if col == nil {
+		return nil, 0, fmt.Errorf("'%s' column does not exist in row group", path)
+	}
+
+	var dict *Values
+	var used bitset // 出現した辞書のインデックス
+	source := sketchScanned
+
+	opts := scanOptions{
+		sel:         sel,
+		dictIndices: true,
+		onDict: func(d *Values) bool {
+			if sel == nil && col.AllPagesDictEncoded() {
+				for i := 0; i < d.Len(); i++ {
+					sketch.Add(d.plain(i))
+				}
+				source = sketchDictionary
+				return false
+			}
+
+			dict, used = d, newBitset(d.Len())
+			return true
+		},
+	}
+
+	err = r.scanColumnChunk(ctx, col, schema, opts, func(page *dataPage) error {
+		page = page.selectRows(sel)
+		if page.values == nil {
+			for _, index := range page.indices {
+				used.set(int(index))
+			}
+			return nil
+		}
+
+		for i := 0; i < page.values.Len(); i++ {
+			sketch.Add(page.values.plain(i))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count distinct values of '%s': %w", path, err)
+	}
+
+	for i := 0; dict != nil && i < dict.Len(); i++ {
+		if used.has(i) {
+			sketch.Add(dict.plain(i))
+		}
+	}
+
+	return sketch, source, nil
+}
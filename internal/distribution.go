@@ -0,0 +1,328 @@
+package internal
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+type (
+	// 数値列(日付・時刻を含む)の値の分布
+	// 値は論理型に従って変換し、日付・時刻は書式化した文字列、それ以外は数値になる
+	Distribution struct {
+		Path      string      `json:"path"`
+		Count     int64       `json:"count"` // NaNを除いた、nullでない値の数
+		Min       any         `json:"min"`   // 値が無ければnil
+		Max       any         `json:"max"`
+		Quantiles []*Quantile `json:"quantiles"`
+		Histogram *Histogram  `json:"histogram,omitempty"`
+
+		ScannedRowGroups int `json:"scanned_row_groups"` // ページを読み取った行グループの数
+		PrunedRowGroups  int `json:"pruned_row_groups"`  // 条件式を満たす行を含まないため、読み飛ばした行グループの数
+	}
+
+	// t-digestで推定した分位数
+	Quantile struct {
+		Q     float64 `json:"q"`
+		Value any     `json:"value"` // 値が無ければnil
+	}
+
+	// 範囲を等しい幅に分けたヒストグラム
+	Histogram struct {
+		Buckets   []*HistogramBucket `json:"buckets"`
+		Underflow int64              `json:"underflow"` // 範囲の下限より小さい値の数
+		Overflow  int64              `json:"overflow"`  // 範囲の上限より大きい値の数
+	}
+
+	// [Lower, Upper)の範囲の値の数(最後のバケットのみUpperを含む)
+	HistogramBucket struct {
+		Lower any   `json:"lower"`
+		Upper any   `json:"upper"`
+		Count int64 `json:"count"`
+	}
+
+	// 分布の求め方
+	// Lower及びUpperは列の値と同じ単位で指定する(DECIMALは小数、日付・時刻はエポックからの日数や単位時間の数)
+	DistributionOptions struct {
+		Quantiles   []float64 // 求める分位数(0以上1以下、省略時は0.5, 0.95, 0.99)
+		Buckets     int       // ヒストグラムのバケットの数(0ならヒストグラムを求めない)
+		Lower       *float64  // ヒストグラムの範囲の下限(省略時は列の最小値)
+		Upper       *float64  // ヒストグラムの範囲の上限(省略時は列の最大値)
+		Compression float64   // t-digestの圧縮率(省略時はDefaultTDigestCompression)
+	}
+)
+
+var defaultQuantiles = []float64{0.5, 0.95, 0.99}
+
+// 数値列の分位数とヒストグラムを求める
+// 分位数はt-digestによる推定値で、NaNは分位数・ヒストグラムのいずれにも含めない
+// 行グループ毎に求めたt-digest・ヒストグラムをマージするので、行グループを並列に読み取れる
+// ヒストグラムの範囲を省略した場合は、先に最小値・最大値を(統計情報から求められなければ列を読み取って)求める
+// 条件式(WithFilter)がある場合、条件式を満たす行の値のみを対象とする
+func (r *Reader) Distribution(ctx context.Context, path string, opts DistributionOptions) (*Distribution, error) {
+	schema := r.meta.FindSchema(path)
+	if schema == nil || !schema.IsLeaf() {
+		return nil, fmt.Errorf("'%s' column does not exist", path)
+	}
+
+	agg, err := newAggregator(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	quantiles := opts.Quantiles
+	if len(quantiles) == 0 {
+		quantiles = defaultQuantiles
+	}
+	for _, q := range quantiles {
+		if !(q >= 0 && q <= 1) {
+			return nil, fmt.Errorf("quantile must be in [0, 1], but got %v", q)
+		}
+	}
+
+	compression := opts.Compression
+	if compression == 0 {
+		compression = DefaultTDigestCompression
+	}
+
+	var hist *histogramBuilder
+	if opts.Buckets > 0 {
+		if hist, err = r.newHistogramBuilder(ctx, path, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// ワーカーの数に依らず同じ結果になるよう、行グループの順にマージする
+	parts, err := runTasks(ctx, r, len(r.meta.RowGroups), func(ctx context.Context, r *Reader, i int) (*distributionPart, error) {
+		return r.distributeRowGroup(ctx, i, schema, agg, compression, hist.empty())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digest := NewTDigest(compression)
+	result := &Distribution{Path: path}
+	for _, part := range parts {
+		if part == nil {
+			result.PrunedRowGroups++
+			continue
+		}
+		result.ScannedRowGroups++
+
+		digest.Merge(part.digest)
+		hist.merge(part.hist)
+	}
+
+	result.Count = digest.Count()
+	if result.Count > 0 {
+		result.Min, result.Max = formatNumericValue(schema, digest.min), formatNumericValue(schema, digest.max)
+	}
+
+	result.Quantiles = make([]*Quantile, len(quantiles))
+	for i, q := range quantiles {
+		result.Quantiles[i] = &Quantile{Q: q}
+		if result.Count > 0 {
+			result.Quantiles[i].Value = formatNumericValue(schema, digest.Quantile(q))
+		}
+	}
+
+	if hist != nil {
+		result.Histogram = hist.histogram(schema)
+	}
+
+	return result, nil
+}
+
+// 行グループ毎に求めた分布
+type distributionPart struct {
+	digest *TDigest
+	hist   *histogramBuilder // ヒストグラムを求めなければnil
+}
+
+// 行グループ内の選択した行について、列の値をt-digest及びヒストグラムに加える
+// 条件式を満たす行が無ければnilを返す
+func (r *Reader) distributeRowGroup(ctx context.Context, rowGroup int, schema *Schema, agg *aggregator, compression float64, hist *histogramBuilder) (*distributionPart, error) {
+	ranges, err := r.RowRanges(ctx, rowGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+
+	sel, err := r.selectRows(ctx, rowGroup, ranges)
+	if err != nil {
+		return nil, err
+	}
+
+	if sel != nil && sel.count() == 0 {
+		return nil, nil
+	}
+
+	path := schema.Path
+	col := findColumn(r.meta.RowGroups[rowGroup], path)
+	if col == nil {
+		return nil, fmt.Errorf("'%s' column does not exist in row group", path)
+	}
+
+	part := &distributionPart{digest: NewTDigest(compression), hist: hist}
+	err = r.scanColumnChunk(ctx, col, schema, scanOptions{sel: sel}, func(page *dataPage) error {
+		values := page.selectRows(sel).values
+		for j := 0; j < values.Len(); j++ {
+			v := agg.float(values, j)
+			if math.IsNaN(v) {
+				continue
+			}
+
+			part.digest.Add(v)
+			if part.hist != nil {
+				part.hist.add(v)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+
+	return part, nil
+}
+
+type histogramBuilder struct {
+	lower, upper float64
+	counts       []int64
+	underflow    int64
+	overflow     int64
+}
+
+// ヒストグラムの範囲を決める
+// 範囲を省略した場合は列の最小値・最大値を用い、値が無ければバケットの無いヒストグラムになる
+func (r *Reader) newHistogramBuilder(ctx context.Context, path string, opts DistributionOptions) (*histogramBuilder, error) {
+	h := &histogramBuilder{counts: make([]int64, opts.Buckets)}
+
+	if opts.Lower == nil || opts.Upper == nil {
+		result, err := r.Aggregate(ctx, path, AggregateMin|AggregateMax)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Min == nil || math.IsNaN(result.Min.Float64()) {
+			h.counts = nil
+			return h, nil
+		}
+		h.lower, h.upper = result.Min.Float64(), result.Max.Float64()
+	}
+
+	if opts.Lower != nil {
+		h.lower = *opts.Lower
+	}
+	if opts.Upper != nil {
+		h.upper = *opts.Upper
+	}
+
+	if !(h.lower <= h.upper) {
+		return nil, fmt.Errorf("lower bound(%v) of histogram must not be greater than upper bound(%v)", h.lower, h.upper)
+	}
+
+	return h, nil
+}
+
+// 同じ範囲で、値を加えていないヒストグラムを返す(hがnilならnil)
+func (h *histogramBuilder) empty() *histogramBuilder {
+	if h == nil {
+		return nil
+	}
+
+	empty := &histogramBuilder{lower: h.lower, upper: h.upper}
+	if h.counts != nil {
+		empty.counts = make([]int64, len(h.counts))
+	}
+	return empty
+}
+
+// 同じ範囲のヒストグラムに加えた値を、このヒストグラムにも加えたことにする
+func (h *histogramBuilder) merge(other *histogramBuilder) {
+	if h == nil || other == nil {
+		return
+	}
+
+	for i, count := range other.counts {
+		h.counts[i] += count
+	}
+	h.underflow += other.underflow
+	h.overflow += other.overflow
+}
+
+func (h *histogramBuilder) add(v float64) {
+	switch {
+	case v < h.lower:
+		h.underflow++
+	case v > h.upper:
+		h.overflow++
+	case len(h.counts) == 0:
+		// 値が無いはずの列
+	case h.upper == h.lower || v == h.upper:
+		h.counts[len(h.counts)-1]++
+	default:
+		bucket := int((v - h.lower) / (h.upper - h.lower) * float64(len(h.counts)))
+		h.counts[min(bucket, len(h.counts)-1)]++
+	}
+}
+
+func (h *histogramBuilder) histogram(schema *Schema) *Histogram {
+	hist := &Histogram{Buckets: make([]*HistogramBucket, len(h.counts)), Underflow: h.underflow, Overflow: h.overflow}
+
+	for i, count := range h.counts {
+		hist.Buckets[i] = &HistogramBucket{
+			Lower: formatNumericValue(schema, h.bound(i)),
+			Upper: formatNumericValue(schema, h.bound(i+1)),
+			Count: count,
+		}
+	}
+
+	return hist
+}
+
+// i番目のバケットの下限(i+1番目のバケットの上限)
+func (h *histogramBuilder) bound(i int) float64 {
+	if i == len(h.counts) {
+		return h.upper
+	}
+	return h.lower + (h.upper-h.lower)*float64(i)/float64(len(h.counts))
+}
+
+// 集計で浮動小数点数として扱った値を、列の論理型に従って変換する
+// 日付・時刻は最も近い整数に丸めて書式化し、それ以外は数値のまま返す
+func formatNumericValue(schema *Schema, v float64) any {
+	if !isTemporal(schema) || math.IsNaN(v) || math.IsInf(v, 0) {
+		return &Number{float: v}
+	}
+
+	if *schema.Type == parquet.Type_INT32 {
+		return formatPlainValue(schema, binary.LittleEndian.AppendUint32(nil, uint32(int32(math.Round(v)))))
+	}
+	return formatPlainValue(schema, binary.LittleEndian.AppendUint64(nil, uint64(int64(math.Round(v)))))
+}
+
+// 日付・時刻の列かどうか
+func isTemporal(schema *Schema) bool {
+	if logical := schema.LogicalType; logical != nil {
+		return logical.IsSetDATE() || logical.IsSetTIME() || logical.IsSetTIMESTAMP()
+	}
+
+	if schema.ConvertedType == nil {
+		return false
+	}
+
+	switch *schema.ConvertedType {
+	case parquet.ConvertedType_DATE, parquet.ConvertedType_TIME_MILLIS, parquet.ConvertedType_TIME_MICROS,
+		parquet.ConvertedType_TIMESTAMP_MILLIS, parquet.ConvertedType_TIMESTAMP_MICROS:
+		return true
+	default:
+		return false
+	}
+}
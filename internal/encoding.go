@@ -0,0 +1,459 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+// エンコーディングに従ってnum個の値を読み取る
+// 辞書エンコーディングの場合はdictから値を引く
+func decodeValues(schema *Schema, encoding parquet.Encoding, data []byte, num int, dict *Values) (*Values, error) {
+	switch encoding {
+	case parquet.Encoding_PLAIN:
+		return decodePlain(schema, data, num)
+
+	case parquet.Encoding_PLAIN_DICTIONARY, parquet.Encoding_RLE_DICTIONARY:
+		if dict == nil {
+			return nil, fmt.Errorf("dictionary page is missing")
+		}
+
+		indices, err := decodeDictIndices(data, num, -1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dictionary indices: %w", err)
+		}
+
+		return dict.lookup(indices)
+
+	case parquet.Encoding_RLE:
+		// 値に対するRLEはBOOLEANのみで、先頭に長さを持つ
+		if *schema.Type != parquet.Type_BOOLEAN {
+			break
+		}
+		if len(data) < 4 {
+			return nil, fmt.Errorf("rle encoded values are truncated")
+		}
+
+		length := binary.LittleEndian.Uint32(data)
+		if int(length) > len(data)-4 {
+			return nil, fmt.Errorf("rle encoded values are truncated(length: %d, remaining: %d)", length, len(data)-4)
+		}
+
+		booleans, err := decodeRLEHybrid(data[4:4+length], 1, num)
+		if err != nil {
+			return nil, err
+		}
+
+		values := newValues(parquet.Type_BOOLEAN, num)
+		for _, b := range booleans {
+			values.Boolean = append(values.Boolean, b == 1)
+		}
+		return values, nil
+
+	case parquet.Encoding_DELTA_BINARY_PACKED:
+		if *schema.Type != parquet.Type_INT32 && *schema.Type != parquet.Type_INT64 {
+			break
+		}
+
+		deltas, _, err := decodeDeltaBinaryPacked(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(deltas) < num {
+			return nil, fmt.Errorf("delta binary packed values has %d values, but %d values are expected", len(deltas), num)
+		}
+
+		values := newValues(*schema.Type, num)
+		for _, v := range deltas[:num] {
+			if *schema.Type == parquet.Type_INT32 {
+				values.Int32 = append(values.Int32, int32(v))
+			} else {
+				values.Int64 = append(values.Int64, v)
+			}
+		}
+		return values, nil
+
+	case parquet.Encoding_DELTA_LENGTH_BYTE_ARRAY:
+		if *schema.Type != parquet.Type_BYTE_ARRAY {
+			break
+		}
+
+		arrays, err := decodeDeltaLengthByteArray(data, num)
+		if err != nil {
+			return nil, err
+		}
+		return &Values{Type: *schema.Type, Bytes: arrays}, nil
+
+	case parquet.Encoding_DELTA_BYTE_ARRAY:
+		if *schema.Type != parquet.Type_BYTE_ARRAY && *schema.Type != parquet.Type_FIXED_LEN_BYTE_ARRAY {
+			break
+		}
+
+		arrays, err := decodeDeltaByteArray(data, num)
+		if err != nil {
+			return nil, err
+		}
+		return &Values{Type: *schema.Type, Bytes: arrays}, nil
+
+	case parquet.Encoding_BYTE_STREAM_SPLIT:
+		return decodeByteStreamSplit(schema, data, num)
+	}
+
+	return nil, fmt.Errorf("unsupported encoding %s for %s column", encoding, schema.Type)
+}
+
+// PLAINエンコーディングされたnum個の値を読み取る
+func decodePlain(schema *Schema, data []byte, num int) (*Values, error) {
+	values := newValues(*schema.Type, num)
+
+	switch *schema.Type {
+	case parquet.Type_BOOLEAN:
+		if len(data)*8 < num {
+			return nil, fmt.Errorf("plain encoded values are truncated")
+		}
+
+		// 1ビットずつ、下位ビットから順に詰められている
+		for i := 0; i < num; i++ {
+			values.Boolean = append(values.Boolean, data[i/8]>>(i%8)&1 == 1)
+		}
+		return values, nil
+
+	case parquet.Type_BYTE_ARRAY:
+		for i := 0; i < num; i++ {
+			if len(data) < 4 {
+				return nil, fmt.Errorf("plain encoded values are truncated")
+			}
+
+			length := binary.LittleEndian.Uint32(data)
+			if int(length) > len(data)-4 {
+				return nil, fmt.Errorf("plain encoded values are truncated(length: %d, remaining: %d)", length, len(data)-4)
+			}
+
+			values.Bytes = append(values.Bytes, data[4:4+length])
+			data = data[4+length:]
+		}
+		return values, nil
+	}
+
+	size := schema.ValueSize()
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid value size(%d) of %s column", size, schema.Type)
+	}
+	if len(data) < size*num {
+		return nil, fmt.Errorf("plain encoded values are truncated(expected: %d bytes, actual: %d bytes)", size*num, len(data))
+	}
+
+	for i := 0; i < num; i++ {
+		v := data[i*size : (i+1)*size]
+
+		switch *schema.Type {
+		case parquet.Type_INT32:
+			values.Int32 = append(values.Int32, int32(binary.LittleEndian.Uint32(v)))
+		case parquet.Type_INT64:
+			values.Int64 = append(values.Int64, int64(binary.LittleEndian.Uint64(v)))
+		case parquet.Type_FLOAT:
+			values.Float = append(values.Float, math.Float32frombits(binary.LittleEndian.Uint32(v)))
+		case parquet.Type_DOUBLE:
+			values.Double = append(values.Double, math.Float64frombits(binary.LittleEndian.Uint64(v)))
+		default:
+			values.Bytes = append(values.Bytes, v)
+		}
+	}
+
+	return values, nil
+}
+
+// 先頭にビット幅を持つ、辞書のインデックスをnum個分読み取る
+// dictSizeが0以上なら、インデックスが辞書の範囲内であることも確かめる
+func decodeDictIndices(data []byte, num int, dictSize int) ([]uint32, error) {
+	if len(data) == 0 {
+		if num == 0 {
+			return []uint32{}, nil
+		}
+		return nil, fmt.Errorf("bit width of dictionary indices is missing")
+	}
+
+	indices, err := decodeRLEHybrid(data[1:], int(data[0]), num)
+	if err != nil {
+		return nil, err
+	}
+
+	if dictSize >= 0 {
+		for _, index := range indices {
+			if int(index) >= dictSize {
+				return nil, fmt.Errorf("dictionary index(%d) is out of range(dictionary size: %d)", index, dictSize)
+			}
+		}
+	}
+
+	return indices, nil
+}
+
+// 先頭にビット幅を持つ、辞書のインデックスをnum個分読み取り、インデックスがmatchに含まれる値の位置をビットセットで返す
+// インデックスは配列に展開せず、readRLEのコールバックでmatchを引く(RLEのランは長さに依らず一度だけ引く)
+func matchDictIndices(data []byte, num int, dictSize int, match bitset) (bitset, error) {
+	if len(data) == 0 {
+		if num == 0 {
+			return newBitset(0), nil
+		}
+		return nil, fmt.Errorf("bit width of dictionary indices is missing")
+	}
+	if data[0] > 32 {
+		return nil, fmt.Errorf("bit width(%d) is too large", data[0])
+	}
+
+	matched := newBitset(num)
+	n := 0
+	var rangeErr error
+
+	err := readRLE(data[1:], uint32(data[0]), func(index uint32, repeated uint64) {
+		if rangeErr != nil || n >= num || repeated == 0 {
+			return
+		}
+		if int(index) >= dictSize {
+			rangeErr = fmt.Errorf("dictionary index(%d) is out of range(dictionary size: %d)", index, dictSize)
+			return
+		}
+
+		end := n + int(min(repeated, uint64(num-n)))
+		if match.has(int(index)) {
+			for i := n; i < end; i++ {
+				matched.set(i)
+			}
+		}
+		n = end
+	})
+	if err == nil {
+		err = rangeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if n < num {
+		return nil, fmt.Errorf("rle encoded data has %d values, but %d values are expected", n, num)
+	}
+
+	return matched, nil
+}
+
+// RLE/ビットパッキングのハイブリッドでエンコーディングされた値をnum個分読み取る
+func decodeRLEHybrid(data []byte, bitWidth int, num int) ([]uint32, error) {
+	if bitWidth > 32 {
+		return nil, fmt.Errorf("bit width(%d) is too large", bitWidth)
+	}
+
+	values := make([]uint32, 0, num)
+	err := readRLE(data, uint32(bitWidth), func(v uint32, repeated uint64) {
+		for i := uint64(0); i < repeated && len(values) < num; i++ {
+			values = append(values, v)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) < num {
+		return nil, fmt.Errorf("rle encoded data has %d values, but %d values are expected", len(values), num)
+	}
+
+	return values, nil
+}
+
+// 非推奨のBIT_PACKEDエンコーディングでエンコーディングされたレベルをnum個分読み取り、残りのバイト列と共に返す
+// RLE/ビットパッキングのハイブリッドとは異なり、上位ビットから順に詰められている
+func decodeBitPackedLevels(data []byte, maxLevel int, num int) ([]int32, []byte, error) {
+	bitWidth := bits.Len(uint(maxLevel))
+	size := (num*bitWidth + 7) / 8
+	if len(data) < size {
+		return nil, nil, fmt.Errorf("bit packed levels are truncated")
+	}
+
+	levels := make([]int32, num)
+	for i := range levels {
+		var level int32
+		for j := 0; j < bitWidth; j++ {
+			bit := i*bitWidth + j
+			level = level<<1 | int32(data[bit/8]>>(7-bit%8)&1)
+		}
+		levels[i] = level
+	}
+
+	return levels, data[size:], nil
+}
+
+// DELTA_BINARY_PACKEDでエンコーディングされた値を全て読み取り、残りのバイト列と共に返す
+func decodeDeltaBinaryPacked(data []byte) ([]int64, []byte, error) {
+	var header [4]uint64
+	var err error
+	for i := range header {
+		if header[i], data, err = readULEB128(data); err != nil {
+			return nil, nil, fmt.Errorf("failed to read delta header: %w", err)
+		}
+	}
+
+	blockSize, miniBlocks, total := header[0], header[1], header[2]
+	if blockSize == 0 || blockSize%128 != 0 || miniBlocks == 0 || blockSize%miniBlocks != 0 || (blockSize/miniBlocks)%32 != 0 {
+		return nil, nil, fmt.Errorf("invalid delta header(block size: %d, miniblocks: %d)", blockSize, miniBlocks)
+	}
+
+	// ブロック毎に最低でも最小の差分とビット幅の分のバイト数は必要なので、それより多い値の数は壊れている
+	if maxTotal := (uint64(len(data))/(1+miniBlocks)+1)*blockSize + 1; total > maxTotal {
+		return nil, nil, fmt.Errorf("invalid delta header(total values: %d)", total)
+	}
+
+	valuesPerMiniBlock := blockSize / miniBlocks
+	values := make([]int64, 0, total)
+	value := zigzag(header[3])
+	if total > 0 {
+		values = append(values, value)
+	}
+
+	for uint64(len(values)) < total {
+		var minDelta uint64
+		if minDelta, data, err = readULEB128(data); err != nil {
+			return nil, nil, fmt.Errorf("failed to read min delta: %w", err)
+		}
+
+		if uint64(len(data)) < miniBlocks {
+			return nil, nil, fmt.Errorf("bit widths of miniblocks are truncated")
+		}
+		widths := data[:miniBlocks]
+		data = data[miniBlocks:]
+
+		// 値が尽きた後のミニブロックは書き込まれていない
+		for _, width := range widths {
+			if uint64(len(values)) >= total {
+				break
+			}
+			if width > 64 {
+				return nil, nil, fmt.Errorf("bit width(%d) of miniblock is too large", width)
+			}
+
+			size := valuesPerMiniBlock * uint64(width) / 8
+			if uint64(len(data)) < size {
+				return nil, nil, fmt.Errorf("miniblock is truncated")
+			}
+
+			for i := uint64(0); i < valuesPerMiniBlock && uint64(len(values)) < total; i++ {
+				// 差分の計算は桁あふれを許容する
+				delta := readBitsLE(data, i*uint64(width), uint(width)) + uint64(zigzag(minDelta))
+				value = int64(uint64(value) + delta)
+				values = append(values, value)
+			}
+
+			data = data[size:]
+		}
+	}
+
+	return values, data, nil
+}
+
+// DELTA_LENGTH_BYTE_ARRAYでエンコーディングされたnum個の値を読み取る
+func decodeDeltaLengthByteArray(data []byte, num int) ([][]byte, error) {
+	arrays, _, err := decodeDeltaLengthByteArrayRest(data, num)
+	return arrays, err
+}
+
+func decodeDeltaLengthByteArrayRest(data []byte, num int) ([][]byte, []byte, error) {
+	lengths, data, err := decodeDeltaBinaryPacked(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read lengths: %w", err)
+	}
+	if len(lengths) < num {
+		return nil, nil, fmt.Errorf("%d lengths are encoded, but %d values are expected", len(lengths), num)
+	}
+
+	arrays := make([][]byte, num)
+	for i, length := range lengths[:num] {
+		if length < 0 || length > int64(len(data)) {
+			return nil, nil, fmt.Errorf("byte array is truncated(length: %d, remaining: %d)", length, len(data))
+		}
+
+		arrays[i] = data[:length]
+		data = data[length:]
+	}
+
+	return arrays, data, nil
+}
+
+// DELTA_BYTE_ARRAYでエンコーディングされたnum個の値を読み取る
+// 各値は、直前の値と共通する接頭辞の長さと、それ以降の接尾辞で表現されている
+func decodeDeltaByteArray(data []byte, num int) ([][]byte, error) {
+	prefixes, data, err := decodeDeltaBinaryPacked(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prefix lengths: %w", err)
+	}
+	if len(prefixes) < num {
+		return nil, fmt.Errorf("%d prefix lengths are encoded, but %d values are expected", len(prefixes), num)
+	}
+
+	suffixes, _, err := decodeDeltaLengthByteArrayRest(data, num)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read suffixes: %w", err)
+	}
+
+	arrays := make([][]byte, num)
+	var prev []byte
+	for i := range arrays {
+		prefix := prefixes[i]
+		if prefix < 0 || prefix > int64(len(prev)) {
+			return nil, fmt.Errorf("prefix length(%d) exceeds previous value length(%d)", prefix, len(prev))
+		}
+
+		v := make([]byte, 0, int(prefix)+len(suffixes[i]))
+		v = append(v, prev[:prefix]...)
+		v = append(v, suffixes[i]...)
+		arrays[i] = v
+		prev = v
+	}
+
+	return arrays, nil
+}
+
+// BYTE_STREAM_SPLITでエンコーディングされたnum個の値を読み取る
+// 値のi番目のバイトが、i番目のストリームにまとめて格納されている
+func decodeByteStreamSplit(schema *Schema, data []byte, num int) (*Values, error) {
+	switch *schema.Type {
+	case parquet.Type_INT32, parquet.Type_INT64, parquet.Type_FLOAT, parquet.Type_DOUBLE, parquet.Type_FIXED_LEN_BYTE_ARRAY:
+	default:
+		return nil, fmt.Errorf("unsupported encoding %s for %s column", parquet.Encoding_BYTE_STREAM_SPLIT, schema.Type)
+	}
+
+	size := schema.ValueSize()
+	if size <= 0 || len(data)%size != 0 || len(data)/size < num {
+		return nil, fmt.Errorf("byte stream split values are truncated(value size: %d, data size: %d)", size, len(data))
+	}
+
+	streamLen := len(data) / size
+	plain := make([]byte, num*size)
+	for i := 0; i < num; i++ {
+		for j := 0; j < size; j++ {
+			plain[i*size+j] = data[j*streamLen+i]
+		}
+	}
+
+	return decodePlain(schema, plain, num)
+}
+
+// 下位ビットから順に詰められたビット列の、offsetビット目からwidthビットを読み取る
+func readBitsLE(data []byte, offset uint64, width uint) uint64 {
+	var v uint64
+	for read := uint(0); read < width; {
+		shift := uint(offset % 8)
+		take := min(8-shift, width-read)
+		b := uint64(data[offset/8]>>shift) & (1<<take - 1)
+		v |= b << read
+		read += take
+		offset += uint64(take)
+	}
+
+	return v
+}
+
+func zigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
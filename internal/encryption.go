@@ -0,0 +1,278 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+// Parquet Modular Encryption
+// https://github.com/apache/parquet-format/blob/master/Encryption.md
+type (
+	// 鍵メタデータから鍵を取得する
+	// 鍵管理サービスとの連携等、鍵の解決方法は利用者側で実装する
+	KeyRetriever interface {
+		RetrieveKey(keyMetadata []byte) ([]byte, error)
+	}
+
+	// 鍵メタデータをそのまま鍵のIDとして扱い、対応する鍵を返すKeyRetriever
+	StaticKeyRetriever map[string][]byte
+
+	// 暗号化されたParquetファイルを復号するための設定
+	DecryptionConfig struct {
+		FooterKey    []byte            // フッター(及びフッターの鍵で暗号化された列)の鍵
+		ColumnKeys   map[string][]byte // 列のパス毎の鍵
+		KeyRetriever KeyRetriever      // 上記で鍵が指定されていない場合に、鍵メタデータから鍵を解決する
+		AADPrefix    []byte            // ファイル内に保存されていないAADプレフィックス
+	}
+
+	// ファイル単位の復号情報
+	fileDecryptor struct {
+		config            *DecryptionConfig
+		aadPrefix         []byte
+		aadFileUnique     []byte
+		ctr               bool   // AES_GCM_CTR_V1ならtrue(ページ本体のみCTRモードで暗号化される)
+		footerKeyMetadata []byte // フッターの鍵の鍵メタデータ
+	}
+
+	// 列チャンク単位の復号情報
+	columnDecryptor struct {
+		file     *fileDecryptor
+		key      []byte
+		rowGroup int16
+		column   int16
+	}
+
+	moduleType byte
+)
+
+// モジュール種別
+// AADの一部として用いられ、暗号文が別のモジュールとして復号されることを防ぐ
+const (
+	moduleFooter moduleType = iota
+	moduleColumnMetaData
+	moduleDataPage
+	moduleDictionaryPage
+	moduleDataPageHeader
+	moduleDictionaryPageHeader
+	moduleColumnIndex
+	moduleOffsetIndex
+	moduleBloomFilterHeader
+	moduleBloomFilterBitset
+)
+
+const (
+	gcmNonceLen = 12
+	gcmTagLen   = 16
+)
+
+func (keys StaticKeyRetriever) RetrieveKey(keyMetadata []byte) ([]byte, error) {
+	key, ok := keys[string(keyMetadata)]
+	if !ok {
+		return nil, fmt.Errorf("key for key metadata '%s' is not found", keyMetadata)
+	}
+
+	return key, nil
+}
+
+func newFileDecryptor(config *DecryptionConfig, algorithm *parquet.EncryptionAlgorithm) (*fileDecryptor, error) {
+	if config == nil {
+		config = &DecryptionConfig{}
+	}
+
+	var aadPrefix, aadFileUnique []byte
+	var supplyAADPrefix bool
+	dec := &fileDecryptor{config: config}
+
+	switch {
+	case algorithm.IsSetAES_GCM_V1():
+		aadPrefix = algorithm.AES_GCM_V1.AadPrefix
+		aadFileUnique = algorithm.AES_GCM_V1.AadFileUnique
+		supplyAADPrefix = algorithm.AES_GCM_V1.GetSupplyAadPrefix()
+
+	case algorithm.IsSetAES_GCM_CTR_V1():
+		aadPrefix = algorithm.AES_GCM_CTR_V1.AadPrefix
+		aadFileUnique = algorithm.AES_GCM_CTR_V1.AadFileUnique
+		supplyAADPrefix = algorithm.AES_GCM_CTR_V1.GetSupplyAadPrefix()
+		dec.ctr = true
+
+	default:
+		return nil, fmt.Errorf("unsupported encryption algorithm: %s", algorithm)
+	}
+
+	// AADプレフィックスがファイルに保存されていない場合は、利用者から与えられたものを用いる
+	// 保存されている場合に異なるものが与えられたら、利用者の意図とは別のファイルである可能性があるのでエラーにする
+	switch {
+	case supplyAADPrefix || aadPrefix == nil:
+		aadPrefix = config.AADPrefix
+	case config.AADPrefix != nil && !bytes.Equal(config.AADPrefix, aadPrefix):
+		return nil, fmt.Errorf("given AAD prefix(%q) differs from the one stored in parquet file(%q)", config.AADPrefix, aadPrefix)
+	}
+	if supplyAADPrefix && aadPrefix == nil {
+		return nil, errors.New("AAD prefix must be supplied to decrypt parquet file")
+	}
+
+	dec.aadPrefix = aadPrefix
+	dec.aadFileUnique = aadFileUnique
+	return dec, nil
+}
+
+// フッターの鍵を取得する
+func (dec *fileDecryptor) footerKey(keyMetadata []byte) ([]byte, error) {
+	if dec.config.FooterKey != nil {
+		return dec.config.FooterKey, nil
+	}
+
+	if dec.config.KeyRetriever != nil && keyMetadata != nil {
+		return dec.config.KeyRetriever.RetrieveKey(keyMetadata)
+	}
+
+	return nil, errors.New("footer key is not given")
+}
+
+// 列の鍵を取得する
+func (dec *fileDecryptor) columnKey(path string, keyMetadata []byte) ([]byte, error) {
+	if key, ok := dec.config.ColumnKeys[path]; ok {
+		return key, nil
+	}
+
+	if dec.config.KeyRetriever != nil && keyMetadata != nil {
+		return dec.config.KeyRetriever.RetrieveKey(keyMetadata)
+	}
+
+	return nil, fmt.Errorf("key for column '%s' is not given", path)
+}
+
+// モジュールのAADを構築する
+// 行グループ、列、ページの序数は、それぞれ負の値であればAADに含めない
+func (dec *fileDecryptor) aad(module moduleType, rowGroup, column, page int16) []byte {
+	aad := make([]byte, 0, len(dec.aadPrefix)+len(dec.aadFileUnique)+7)
+	aad = append(aad, dec.aadPrefix...)
+	aad = append(aad, dec.aadFileUnique...)
+	aad = append(aad, byte(module))
+
+	for _, ordinal := range []int16{rowGroup, column, page} {
+		if ordinal < 0 {
+			break
+		}
+		aad = binary.LittleEndian.AppendUint16(aad, uint16(ordinal))
+	}
+
+	return aad
+}
+
+// フッターを復号する
+func (dec *fileDecryptor) decryptFooter(key []byte, module []byte) ([]byte, error) {
+	return decryptGCM(key, module, dec.aad(moduleFooter, -1, -1, -1))
+}
+
+// 平文フッターモードにおける、フッターの署名(nonce及びGCMのタグ)を検証する
+func (dec *fileDecryptor) verifyFooterSignature(key []byte, footer []byte, signature []byte) error {
+	if len(signature) != gcmNonceLen+gcmTagLen {
+		return fmt.Errorf("invalid footer signature length: %d", len(signature))
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	// フッターを同じnonceで暗号化し、得られたタグが署名と一致するかどうかを確認する
+	nonce, tag := signature[:gcmNonceLen], signature[gcmNonceLen:]
+	sealed := aead.Seal(nil, nonce, footer, dec.aad(moduleFooter, -1, -1, -1))
+	if subtle.ConstantTimeCompare(sealed[len(sealed)-gcmTagLen:], tag) != 1 {
+		return errors.New("footer signature is not matched")
+	}
+
+	return nil
+}
+
+// 列チャンク内のモジュールを復号する
+// AES_GCM_CTR_V1の場合、ページ本体はCTRモードで、それ以外はGCMモードで復号する
+func (dec *columnDecryptor) decrypt(module moduleType, page int16, data []byte) ([]byte, error) {
+	if dec.file.ctr && (module == moduleDataPage || module == moduleDictionaryPage) {
+		return decryptCTR(dec.key, data)
+	}
+
+	return decryptGCM(dec.key, data, dec.file.aad(module, dec.rowGroup, dec.column, page))
+}
+
+// 長さ(4バイト)を先頭に持つ暗号化モジュールを読み取る
+// モジュール全体(長さを含む)がlimitバイトを超える場合は、読み取る前にエラーにする
+func readModule(r io.Reader, limit int64) ([]byte, error) {
+	lenBuf := make([]byte, 4)
+	if _, err := io.ReadFull(r, lenBuf); err != nil {
+		return nil, fmt.Errorf("failed to read length of encrypted module: %w", err)
+	}
+
+	size := 4 + int64(binary.LittleEndian.Uint32(lenBuf))
+	if size > limit {
+		return nil, fmt.Errorf("encrypted module length exceeds its bounds(length: %d, limit: %d)", size, limit)
+	}
+
+	module := make([]byte, size)
+	copy(module, lenBuf)
+	if _, err := io.ReadFull(r, module[4:]); err != nil {
+		return nil, fmt.Errorf("failed to read encrypted module: %w", err)
+	}
+
+	return module, nil
+}
+
+// AES-GCMで暗号化されたモジュール(長さ、nonce、暗号文、タグ)を復号する
+func decryptGCM(key []byte, module []byte, aad []byte) ([]byte, error) {
+	if len(module) < 4+gcmNonceLen+gcmTagLen {
+		return nil, fmt.Errorf("encrypted module is too short: %d bytes", len(module))
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	module = module[4:]
+	plain, err := aead.Open(nil, module[:gcmNonceLen], module[gcmNonceLen:], aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt module(wrong key or AAD?): %w", err)
+	}
+
+	return plain, nil
+}
+
+// AES-CTRで暗号化されたモジュール(長さ、nonce、暗号文)を復号する
+func decryptCTR(key []byte, module []byte) ([]byte, error) {
+	if len(module) < 4+gcmNonceLen {
+		return nil, fmt.Errorf("encrypted module is too short: %d bytes", len(module))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+
+	// IVはnonceの後ろに、1から始まる4バイトのカウンタを続けたもの
+	module = module[4:]
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, module[:gcmNonceLen])
+	iv[aes.BlockSize-1] = 1
+
+	plain := make([]byte, len(module)-gcmNonceLen)
+	cipher.NewCTR(block, iv).XORKeyStream(plain, module[gcmNonceLen:])
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,332 @@
+package internal
+
+import (
+	"sync"
+	"time"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+type (
+	// WithExplainを指定したReaderでの読み取りの記録
+	// 行グループ毎に条件式で読み飛ばしたかどうかとその理由を、列チャンク毎に読み取った・読み飛ばしたページ及びバイト数と、デコードにかかった時間を記録する
+	// 同じ列チャンクを複数回読み取った場合(条件式の列を集計する場合等)は、その合計になる
+	// 複数のgoroutineが同じReaderで読み取っている場合があるので、記録は全てExplain全体で共有するロックを取って行う
+	// Queryの読み取りは、WHERE句毎に別の記録としてQueryResultに返す
+	Explain struct {
+		Filter    string                `json:"filter,omitempty"`
+		RowGroups []*RowGroupExplain    `json:"row_groups"`
+		Columns   []*ColumnChunkExplain `json:"columns"` // 列毎の全ての行グループの合計(読み取った順)
+
+		mu *sync.Mutex
+	}
+
+	RowGroupExplain struct {
+		RowGroup      int                   `json:"row_group"`
+		Rows          int64                 `json:"rows"`
+		Pruned        string                `json:"pruned,omitempty"`         // 条件式を満たす行が無いと判定した理由(行グループを読み取った場合は空)
+		CandidateRows *int64                `json:"candidate_rows,omitempty"` // 統計情報・ブルームフィルタ・ColumnIndexで絞り込んだ、条件式を満たし得る行の数
+		SelectedRows  *int64                `json:"selected_rows,omitempty"`  // 条件式の列をデコードして判定した、条件式を満たす行の数
+		Columns       []*ColumnChunkExplain `json:"columns"`                  // 読み取った順
+
+		mu *sync.Mutex
+	}
+
+	ColumnChunkExplain struct {
+		Path           string        `json:"path"`
+		PagesRead      int           `json:"pages_read"` // 辞書ページを含む
+		PagesSkipped   int           `json:"pages_skipped"`
+		BytesRead      int64         `json:"bytes_read"` // ページヘッダを含む
+		BytesSkipped   int64         `json:"bytes_skipped"`
+		DictionaryOnly bool          `json:"dictionary_only,omitempty"` // 辞書ページのみで済ませ、データページを読まなかった(辞書に条件を満たす値が無い場合等)
+		DecodeTime     time.Duration `json:"decode_time_ns"`            // ページのデコード(解凍を除く)にかかった時間
+
+		SkippedPages []*SkippedPageExplain `json:"skipped_pages,omitempty"` // 読み飛ばしたデータページ(行グループ毎の記録のみ)
+
+		mu *sync.Mutex
+	}
+
+	// 読み飛ばしたデータページ
+	SkippedPageExplain struct {
+		Page   int    `json:"page"`   // 列チャンク内でのデータページの序数(OffsetIndexが無く、辞書ページのみで済ませた場合は-1で、残りのデータページ全体を表す)
+		Offset int64  `json:"offset"` // ページヘッダのファイル内オフセット
+		Bytes  int64  `json:"bytes"`
+		Reason string `json:"reason"` // page_index、rows又はdictionary
+	}
+)
+
+// 行グループ又はデータページを読み飛ばした理由
+const (
+	prunedByStatistics  = "statistics"   // 列チャンクの統計情報
+	prunedByBloomFilter = "bloom_filter" // ブルームフィルタに等しい値が含まれていない
+	prunedByPageIndex   = "page_index"   // ColumnIndexで全てのページを除外した
+	prunedByDictionary  = "dictionary"   // 辞書に条件を満たす値が無く、データページを読まなかった
+	prunedByRows        = "rows"         // 条件式の列をデコードして1行ずつ判定した結果、満たす行が無かった
+)
+
+// 読み取りの記録を取る
+// 記録は Explain で確認できる
+func WithExplain() ReaderOption {
+	return func(r *Reader) {
+		r.explain = &Explain{}
+	}
+}
+
+// 読み取りの記録を返す(WithExplainを指定していなければnil)
+func (r *Reader) Explain() *Explain {
+	if r.explain == nil {
+		return nil
+	}
+
+	return r.explain.summarize()
+}
+
+// 列毎の全ての行グループの合計を求めて返す
+func (e *Explain) summarize() *Explain {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.Columns = make([]*ColumnChunkExplain, 0)
+	totals := make(map[string]*ColumnChunkExplain)
+	for _, row := range e.RowGroups {
+		for _, col := range row.Columns {
+			total, ok := totals[col.Path]
+			if !ok {
+				total = &ColumnChunkExplain{Path: col.Path, mu: e.mu}
+				totals[col.Path] = total
+				e.Columns = append(e.Columns, total)
+			}
+
+			total.PagesRead += col.PagesRead
+			total.PagesSkipped += col.PagesSkipped
+			total.BytesRead += col.BytesRead
+			total.BytesSkipped += col.BytesSkipped
+			total.DecodeTime += col.DecodeTime
+		}
+	}
+
+	return e
+}
+
+func newExplain(meta *MetaData, filter Expr) *Explain {
+	e := &Explain{RowGroups: make([]*RowGroupExplain, len(meta.RowGroups)), mu: &sync.Mutex{}}
+	for i, row := range meta.RowGroups {
+		e.RowGroups[i] = &RowGroupExplain{RowGroup: i, Rows: row.NumRows, Columns: make([]*ColumnChunkExplain, 0), mu: e.mu}
+	}
+
+	if filter != nil {
+		e.Filter = filter.String()
+	}
+
+	return e
+}
+
+// 並列に読み取るタスクのための、空の記録を返す
+// 行グループの記録は、タスクが読み取った行グループについてのみ作る
+func (e *Explain) fork() *Explain {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return &Explain{Filter: e.Filter, RowGroups: make([]*RowGroupExplain, len(e.RowGroups)), mu: &sync.Mutex{}}
+}
+
+// 並列に読み取ったタスクの記録を加える
+func (e *Explain) merge(other *Explain) {
+	if e == nil || other == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, row := range other.RowGroups {
+		if row == nil {
+			continue
+		}
+
+		target := e.RowGroups[i]
+		if row.Pruned != "" {
+			target.Pruned = row.Pruned
+		}
+		if row.CandidateRows != nil {
+			target.CandidateRows = row.CandidateRows
+		}
+		if row.SelectedRows != nil {
+			target.SelectedRows = row.SelectedRows
+		}
+
+		for _, col := range row.Columns {
+			c := target.column(col.Path)
+			c.PagesRead += col.PagesRead
+			c.BytesRead += col.BytesRead
+			c.PagesSkipped += col.PagesSkipped
+			c.BytesSkipped += col.BytesSkipped
+			c.DictionaryOnly = c.DictionaryOnly || col.DictionaryOnly
+			c.DecodeTime += col.DecodeTime
+			c.SkippedPages = append(c.SkippedPages, col.SkippedPages...)
+		}
+	}
+}
+
+// 行グループの記録(記録を取っていなければnil)
+func (r *Reader) explainRowGroup(rowGroup int) *RowGroupExplain {
+	if r.explain == nil {
+		return nil
+	}
+
+	r.explain.mu.Lock()
+	defer r.explain.mu.Unlock()
+
+	row := r.explain.RowGroups[rowGroup]
+	if row == nil {
+		meta := r.meta.RowGroups[rowGroup]
+		row = &RowGroupExplain{RowGroup: rowGroup, Rows: meta.NumRows, Columns: make([]*ColumnChunkExplain, 0), mu: r.explain.mu}
+		r.explain.RowGroups[rowGroup] = row
+	}
+	return row
+}
+
+// 列チャンクの記録(記録を取っていなければnil)
+func (r *Reader) explainColumnChunk(col *ColumnChunk) *ColumnChunkExplain {
+	row := r.explainRowGroup(int(col.RowGroupOrdinal))
+	if row == nil {
+		return nil
+	}
+
+	row.mu.Lock()
+	defer row.mu.Unlock()
+
+	return row.column(col.Path)
+}
+
+// 列チャンクの記録を返す(無ければ作る)
+// ロックを取った上で呼ぶこと
+func (e *RowGroupExplain) column(path string) *ColumnChunkExplain {
+	for _, c := range e.Columns {
+		if c.Path == path {
+			return c
+		}
+	}
+
+	c := &ColumnChunkExplain{Path: path, mu: e.mu}
+	e.Columns = append(e.Columns, c)
+	return c
+}
+
+func (e *RowGroupExplain) prune(reason string) {
+	if e != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		e.Pruned = reason
+	}
+}
+
+func (e *RowGroupExplain) candidates(rows int64) {
+	if e != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		e.CandidateRows = &rows
+	}
+}
+
+// 条件式を満たす行を記録し、1行も無ければ読み飛ばした理由も記録する
+func (e *RowGroupExplain) selected(rows int64) {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.SelectedRows = &rows
+	if rows > 0 {
+		return
+	}
+
+	e.Pruned = prunedByRows
+	for _, c := range e.Columns {
+		if c.DictionaryOnly {
+			e.Pruned = prunedByDictionary
+		}
+	}
+}
+
+func (e *ColumnChunkExplain) read(pages int, bytes int64) {
+	if e != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		e.PagesRead += pages
+		e.BytesRead += bytes
+	}
+}
+
+// データページを読み飛ばしたことを、その理由と共に記録する
+func (e *ColumnChunkExplain) skip(page int, offset int64, bytes int64, reason string) {
+	if e != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		e.PagesSkipped++
+		e.BytesSkipped += bytes
+		e.SkippedPages = append(e.SkippedPages, &SkippedPageExplain{Page: page, Offset: offset, Bytes: bytes, Reason: reason})
+	}
+}
+
+func (e *ColumnChunkExplain) decoded(start time.Time) {
+	if e != nil {
+		elapsed := time.Since(start)
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		e.DecodeTime += elapsed
+	}
+}
+
+// 辞書ページのみを読み取って、列チャンクの残りを読み飛ばしたことを記録する
+// OffsetIndexがあればデータページ毎に記録し、無ければ残り全体を1つのページとして記録する
+// 読み飛ばしたデータページの数は、OffsetIndex又はencoding_statsから分かる場合のみ数える
+func (e *ColumnChunkExplain) skipDataPages(col *ColumnChunk, offset int64) {
+	if e == nil {
+		return
+	}
+
+	col.cacheMu.Lock()
+	index := col.PageIndex
+	col.cacheMu.Unlock()
+
+	skipped := make([]*SkippedPageExplain, 0)
+	pages := 0
+	switch {
+	case index != nil:
+		pages = len(index.Pages)
+		for i, loc := range index.Pages {
+			skipped = append(skipped, &SkippedPageExplain{Page: i, Offset: loc.Offset, Bytes: int64(loc.CompressedPageSize), Reason: prunedByDictionary})
+		}
+	case col.encodingStats != nil:
+		for _, stats := range col.encodingStats {
+			if stats.PageType == parquet.PageType_DATA_PAGE || stats.PageType == parquet.PageType_DATA_PAGE_V2 {
+				pages += int(stats.Count)
+			}
+		}
+	}
+
+	bytes := max(col.PageTailOffset()-offset, 0)
+	if index == nil {
+		skipped = append(skipped, &SkippedPageExplain{Page: -1, Offset: offset, Bytes: bytes, Reason: prunedByDictionary})
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.PagesSkipped += pages
+	e.BytesSkipped += bytes
+	e.SkippedPages = append(e.SkippedPages, skipped...)
+	e.DictionaryOnly = true
+}
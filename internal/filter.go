@@ -0,0 +1,979 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+type (
+	// 行を絞り込むための条件式
+	// 値との比較はSQLと同様に、nullに対しては成り立たないものとする
+	// 浮動小数点数のNaNはIEEE 754と同様に、!=(及びNOT IN)のみが成り立つ
+	// NOTは葉の条件の否定に置き換えるので、例えばNOT (f < 1)はf >= 1と同じになりNaNには成り立たない
+	Expr interface {
+		String() string
+
+		// NOTを葉まで押し下げるための、否定した条件式
+		negate() Expr
+
+		// 条件式中の列をスキーマと対応付ける
+		bind(meta *MetaData) (predicate, error)
+	}
+
+	CompareOp int
+
+	// 列の値と定数の比較
+	Compare struct {
+		Path  string
+		Op    CompareOp
+		Value any
+	}
+
+	// 列の値が定数のいずれかに等しいか(NotならNOT IN)
+	In struct {
+		Path   string
+		Values []any
+		Not    bool
+	}
+
+	// 列の値がnullか(NotならIS NOT NULL)
+	IsNull struct {
+		Path string
+		Not  bool
+	}
+
+	// 文字列の列の値がLIKEのパターンに一致するか(NotならNOT LIKE)
+	// %は0文字以上、_は1文字の任意の文字列に一致し、\を前に置くとこれらの文字そのものに一致する
+	Like struct {
+		Path    string
+		Pattern string
+		Not     bool
+	}
+
+	// 文字列の列の値が正規表現(RE2の構文)に一致するか(NotならNOT REGEXP)
+	// LIKEと異なり、値の一部に一致すれば成り立つ
+	Regexp struct {
+		Path    string
+		Pattern string
+		Not     bool
+	}
+
+	And struct {
+		Exprs []Expr
+	}
+
+	Or struct {
+		Exprs []Expr
+	}
+
+	Not struct {
+		Expr Expr
+	}
+
+	// スキーマと対応付けた条件式
+	predicate interface {
+		// 行グループ内に条件を満たす行が存在し得るかどうかを、統計情報から判定する
+		mightMatch(row *RowGroup) bool
+
+		// 行グループ内に条件を満たす行が存在し得るかどうかを、列チャンクのブルームフィルタから判定する
+		mightContain(ctx context.Context, r *Reader, row *RowGroup) (bool, error)
+
+		// 行グループ内で条件を満たす行が存在し得る範囲を、列毎のページインデックスから求める
+		rowRanges(row *RowGroup, indexes map[string]*PageIndex) RowRanges
+
+		// 条件式が参照する列のパス
+		paths() []string
+
+		// 選択した行のうち条件を満たす行を、列の値をデコードして1行ずつ判定する
+		filterRows(ctx context.Context, r *Reader, row *RowGroup, sel *rowSelection) (*rowSelection, error)
+	}
+
+	// 条件式が参照する列
+	filterColumn struct {
+		path       string
+		schema     *Schema
+		comparator *Comparator
+		meta       *MetaData
+	}
+
+	// 比較する値はPLAINエンコーディングした値で持ち、列のComparatorで比較する
+	comparePredicate struct {
+		*filterColumn
+		op    CompareOp
+		value []byte
+	}
+
+	inPredicate struct {
+		*filterColumn
+		values [][]byte
+		not    bool
+	}
+
+	nullPredicate struct {
+		*filterColumn
+		not bool
+	}
+
+	// LIKE及びREGEXPは正規表現に変換して判定する
+	patternPredicate struct {
+		*filterColumn
+		re     *regexp.Regexp
+		prefix []byte // 一致する値が必ず持つ接頭辞(統計情報による判定に用いる)
+		not    bool
+	}
+
+	andPredicate []predicate
+	orPredicate  []predicate
+)
+
+const (
+	OpEq CompareOp = iota
+	OpNe
+	OpLt
+	OpLe
+	OpGt
+	OpGe
+)
+
+var compareOpSymbols = map[CompareOp]string{OpEq: "=", OpNe: "!=", OpLt: "<", OpLe: "<=", OpGt: ">", OpGe: ">="}
+
+// 比較の否定(nullに対してはどちらも成り立たないので、IS NULLは加えなくて良い)
+var negatedCompareOps = map[CompareOp]CompareOp{OpEq: OpNe, OpNe: OpEq, OpLt: OpGe, OpLe: OpGt, OpGt: OpLe, OpGe: OpLt}
+
+func Eq(path string, value any) Expr { return &Compare{Path: path, Op: OpEq, Value: value} }
+func Ne(path string, value any) Expr { return &Compare{Path: path, Op: OpNe, Value: value} }
+func Lt(path string, value any) Expr { return &Compare{Path: path, Op: OpLt, Value: value} }
+func Le(path string, value any) Expr { return &Compare{Path: path, Op: OpLe, Value: value} }
+func Gt(path string, value any) Expr { return &Compare{Path: path, Op: OpGt, Value: value} }
+func Ge(path string, value any) Expr { return &Compare{Path: path, Op: OpGe, Value: value} }
+
+func InValues(path string, values ...any) Expr { return &In{Path: path, Values: values} }
+func NotInValues(path string, values ...any) Expr {
+	return &In{Path: path, Values: values, Not: true}
+}
+
+func Null(path string) Expr    { return &IsNull{Path: path} }
+func NotNull(path string) Expr { return &IsNull{Path: path, Not: true} }
+
+func MatchLike(path, pattern string) Expr   { return &Like{Path: path, Pattern: pattern} }
+func MatchRegexp(path, pattern string) Expr { return &Regexp{Path: path, Pattern: pattern} }
+
+// 値が接頭辞から始まるか
+func HasPrefix(path, prefix string) Expr {
+	return &Like{Path: path, Pattern: escapeLikePattern(prefix) + "%"}
+}
+
+func AllOf(exprs ...Expr) Expr { return &And{Exprs: exprs} }
+func AnyOf(exprs ...Expr) Expr { return &Or{Exprs: exprs} }
+func Negate(expr Expr) Expr    { return &Not{Expr: expr} }
+
+func (op CompareOp) String() string {
+	return compareOpSymbols[op]
+}
+
+func (e *Compare) String() string {
+	return fmt.Sprintf("%s %s %s", e.Path, e.Op, formatLiteral(e.Value))
+}
+
+func (e *In) String() string {
+	values := make([]string, len(e.Values))
+	for i, v := range e.Values {
+		values[i] = formatLiteral(v)
+	}
+
+	op := "IN"
+	if e.Not {
+		op = "NOT IN"
+	}
+	return fmt.Sprintf("%s %s (%s)", e.Path, op, strings.Join(values, ", "))
+}
+
+func (e *IsNull) String() string {
+	if e.Not {
+		return e.Path + " IS NOT NULL"
+	}
+	return e.Path + " IS NULL"
+}
+
+func (e *Like) String() string {
+	if e.Not {
+		return e.Path + " NOT LIKE " + formatLiteral(e.Pattern)
+	}
+	return e.Path + " LIKE " + formatLiteral(e.Pattern)
+}
+
+func (e *Regexp) String() string {
+	if e.Not {
+		return e.Path + " NOT REGEXP " + formatLiteral(e.Pattern)
+	}
+	return e.Path + " REGEXP " + formatLiteral(e.Pattern)
+}
+
+func (e *And) String() string { return joinExprs(e.Exprs, " AND ") }
+func (e *Or) String() string  { return joinExprs(e.Exprs, " OR ") }
+func (e *Not) String() string { return "NOT (" + e.Expr.String() + ")" }
+
+func joinExprs(exprs []Expr, sep string) string {
+	s := make([]string, len(exprs))
+	for i, e := range exprs {
+		s[i] = "(" + e.String() + ")"
+	}
+	return strings.Join(s, sep)
+}
+
+func formatLiteral(v any) string {
+	switch v := v.(type) {
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case []byte:
+		return fmt.Sprintf("X'%x'", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (e *Compare) negate() Expr {
+	return &Compare{Path: e.Path, Op: negatedCompareOps[e.Op], Value: e.Value}
+}
+
+func (e *In) negate() Expr     { return &In{Path: e.Path, Values: e.Values, Not: !e.Not} }
+func (e *IsNull) negate() Expr { return &IsNull{Path: e.Path, Not: !e.Not} }
+func (e *Not) negate() Expr    { return e.Expr }
+
+func (e *Like) negate() Expr {
+	return &Like{Path: e.Path, Pattern: e.Pattern, Not: !e.Not}
+}
+
+func (e *Regexp) negate() Expr {
+	return &Regexp{Path: e.Path, Pattern: e.Pattern, Not: !e.Not}
+}
+
+func (e *And) negate() Expr {
+	negated := make([]Expr, len(e.Exprs))
+	for i, expr := range e.Exprs {
+		negated[i] = expr.negate()
+	}
+	return &Or{Exprs: negated}
+}
+
+func (e *Or) negate() Expr {
+	negated := make([]Expr, len(e.Exprs))
+	for i, expr := range e.Exprs {
+		negated[i] = expr.negate()
+	}
+	return &And{Exprs: negated}
+}
+
+func (e *Compare) bind(meta *MetaData) (predicate, error) {
+	column, err := bindColumn(meta, e.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := encodeFilterValue(column.schema, e.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value of '%s': %w", e.String(), err)
+	}
+
+	return &comparePredicate{filterColumn: column, op: e.Op, value: value}, nil
+}
+
+func (e *In) bind(meta *MetaData) (predicate, error) {
+	column, err := bindColumn(meta, e.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &inPredicate{filterColumn: column, not: e.Not, values: make([][]byte, len(e.Values))}
+	for i, v := range e.Values {
+		if p.values[i], err = encodeFilterValue(column.schema, v); err != nil {
+			return nil, fmt.Errorf("invalid value of '%s': %w", e.String(), err)
+		}
+	}
+
+	return p, nil
+}
+
+func (e *IsNull) bind(meta *MetaData) (predicate, error) {
+	column, err := bindColumn(meta, e.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &nullPredicate{filterColumn: column, not: e.Not}, nil
+}
+
+func (e *Like) bind(meta *MetaData) (predicate, error) {
+	column, err := bindStringColumn(meta, e.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	expr, prefix, err := likeToRegexp(e.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern of '%s': %w", e.String(), err)
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern of '%s': %w", e.String(), err)
+	}
+
+	return &patternPredicate{filterColumn: column, re: re, prefix: prefix, not: e.Not}, nil
+}
+
+func (e *Regexp) bind(meta *MetaData) (predicate, error) {
+	column, err := bindStringColumn(meta, e.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(e.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern of '%s': %w", e.String(), err)
+	}
+
+	return &patternPredicate{filterColumn: column, re: re, not: e.Not}, nil
+}
+
+func (e *And) bind(meta *MetaData) (predicate, error) {
+	p := make(andPredicate, len(e.Exprs))
+	for i, expr := range e.Exprs {
+		bound, err := expr.bind(meta)
+		if err != nil {
+			return nil, err
+		}
+		p[i] = bound
+	}
+
+	return p, nil
+}
+
+func (e *Or) bind(meta *MetaData) (predicate, error) {
+	p := make(orPredicate, len(e.Exprs))
+	for i, expr := range e.Exprs {
+		bound, err := expr.bind(meta)
+		if err != nil {
+			return nil, err
+		}
+		p[i] = bound
+	}
+
+	return p, nil
+}
+
+func (e *Not) bind(meta *MetaData) (predicate, error) {
+	return e.Expr.negate().bind(meta)
+}
+
+func bindColumn(meta *MetaData, path string) (*filterColumn, error) {
+	schema := meta.FindSchema(path)
+	if schema == nil || !schema.IsLeaf() {
+		return nil, fmt.Errorf("'%s' column does not exist", path)
+	}
+
+	if schema.HasRepetitionLevels() {
+		return nil, fmt.Errorf("filtering by repeated column '%s' is not supported", path)
+	}
+
+	comparator, err := NewComparator(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return &filterColumn{path: path, schema: schema, comparator: comparator, meta: meta}, nil
+}
+
+// パターンで判定できる、バイト列の辞書順で比較する列(文字列等)を対応付ける
+func bindStringColumn(meta *MetaData, path string) (*filterColumn, error) {
+	column, err := bindColumn(meta, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if column.comparator.kind != compareUnsignedBytes {
+		return nil, fmt.Errorf("pattern matching on '%s' column is not supported", path)
+	}
+
+	return column, nil
+}
+
+// LIKEのパターンを、値全体に一致する正規表現とワイルドカードより前の接頭辞に変換する
+func likeToRegexp(pattern string) (string, []byte, error) {
+	var expr strings.Builder
+	var prefix []byte
+	literal := true // ワイルドカードより前かどうか
+
+	expr.WriteString(`(?s)^`)
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '%':
+			expr.WriteString(`.*`)
+			literal = false
+		case '_':
+			expr.WriteString(`.`)
+			literal = false
+		case '\\':
+			if i+1 >= len(pattern) {
+				return "", nil, fmt.Errorf("pattern ends with escape character")
+			}
+			i++
+			fallthrough
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			if literal {
+				prefix = append(prefix, pattern[i])
+			}
+		}
+	}
+	expr.WriteString(`$`)
+
+	return expr.String(), prefix, nil
+}
+
+// LIKEのパターンで、文字列そのものに一致するようにワイルドカードを打ち消す
+func escapeLikePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// 条件式の定数を、列の値と比較できるPLAINエンコーディングした値に変換する
+// DECIMALの列については、定数を小数として扱いスケールに従って整数に変換する
+func encodeFilterValue(schema *Schema, value any) ([]byte, error) {
+	if schema.LogicalType != nil && schema.LogicalType.IsSetFLOAT16() {
+		return nil, fmt.Errorf("filtering by FLOAT16 column is not supported")
+	}
+
+	decimal := schema.LogicalType != nil && schema.LogicalType.IsSetDECIMAL() ||
+		schema.ConvertedType != nil && *schema.ConvertedType == parquet.ConvertedType_DECIMAL
+	if !decimal || schema.Scale == nil {
+		return encodePlainValue(schema, value)
+	}
+
+	var r *big.Rat
+	if i, ok := toInt64(value); ok {
+		r = new(big.Rat).SetInt64(i)
+	} else if f, ok := toFloat64(value); ok {
+		// 2進数の誤差を含まないように、10進数の表記から変換する
+		r, _ = new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	} else if s, ok := value.(string); ok {
+		if r, ok = new(big.Rat).SetString(s); !ok {
+			return nil, fmt.Errorf("'%s' is not decimal", s)
+		}
+	} else {
+		return nil, fmt.Errorf("unsupported value %v(%T) for DECIMAL column", value, value)
+	}
+
+	unscaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(*schema.Scale)))
+	if !unscaled.IsInt() {
+		return nil, fmt.Errorf("value %v has more digits than scale(%d) of DECIMAL column", value, *schema.Scale)
+	}
+	n := unscaled.Num()
+
+	switch *schema.Type {
+	case parquet.Type_INT32, parquet.Type_INT64:
+		if !n.IsInt64() {
+			return nil, fmt.Errorf("value %v overflows %s", value, schema.Type)
+		}
+		return encodePlainValue(schema, n.Int64())
+
+	default:
+		size := (n.BitLen() + 8) / 8 // 符号ビットの分を含めたバイト数
+		if *schema.Type == parquet.Type_FIXED_LEN_BYTE_ARRAY {
+			if size > schema.ValueSize() {
+				return nil, fmt.Errorf("value %v overflows FIXED_LEN_BYTE_ARRAY(%d)", value, schema.ValueSize())
+			}
+			size = schema.ValueSize()
+		}
+		return signedBigToBytes(n, size), nil
+	}
+}
+
+// 任意精度の整数を、sizeバイトのビッグエンディアンの2の補数に変換する
+func signedBigToBytes(n *big.Int, size int) []byte {
+	m := new(big.Int).Set(n)
+	if m.Sign() < 0 {
+		m.Add(m, new(big.Int).Lsh(big.NewInt(1), uint(8*size)))
+	}
+
+	return m.FillBytes(make([]byte, size))
+}
+
+// 行グループ内の列チャンクを探す
+func findColumn(row *RowGroup, path string) *ColumnChunk {
+	for _, col := range row.Columns {
+		if col.Path == path {
+			return col
+		}
+	}
+
+	return nil
+}
+
+// 列チャンクの全ての値がnullであることが統計情報から分かるか
+func allNull(col *ColumnChunk) bool {
+	stats := col.Statistics
+	return stats != nil && stats.NullCount != nil && *stats.NullCount == col.NumValues
+}
+
+// 列チャンクの統計情報から、行グループ内に条件を満たす値が存在し得るかを判定する
+func (c *filterColumn) mightMatchChunk(row *RowGroup, match func(stats *Statistics, allNull bool) bool) bool {
+	col := findColumn(row, c.path)
+	if col == nil {
+		return true
+	}
+
+	return match(col.Statistics, allNull(col))
+}
+
+// 列チャンクのブルームフィルタに、いずれかの値が含まれ得るかを判定する
+// バイト列として等しいことと値として等しいことが一致しない列(浮動小数点数等)や、ブルームフィルタが無い列チャンクでは常にtrueを返す
+func (c *filterColumn) mightContainAny(ctx context.Context, r *Reader, row *RowGroup, values [][]byte) (bool, error) {
+	switch c.comparator.kind {
+	case compareInt32, compareUint32, compareInt64, compareUint64, compareUnsignedBytes:
+	default:
+		return true, nil
+	}
+
+	col := findColumn(row, c.path)
+	if col == nil {
+		return true, nil
+	}
+
+	bf, err := r.bloomFilter(ctx, col)
+	if err != nil || bf == nil {
+		return true, err
+	}
+
+	for _, v := range values {
+		if bf.MightContain(v) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ColumnIndexの各ページについてmatchで判定し、条件を満たす値が存在し得るページの行の範囲を返す
+// ColumnIndexが無い場合は、行グループの全ての行を返す
+func (c *filterColumn) pageRowRanges(row *RowGroup, index *PageIndex, match func(stats *Statistics, allNull bool) bool) RowRanges {
+	if index == nil || index.BoundaryOrder == nil {
+		return allRows(row.NumRows)
+	}
+
+	ranges := make(RowRanges, 0)
+	for i, page := range index.Pages {
+		to := row.NumRows
+		if i+1 < len(index.Pages) {
+			to = index.Pages[i+1].FirstRowIndex
+		}
+
+		if match(c.pageStatistics(page), page.NullPage) {
+			ranges = ranges.add(page.FirstRowIndex, to)
+		}
+	}
+
+	return ranges
+}
+
+// ColumnIndexのページの最小値・最大値を、列チャンクの統計情報と同様に扱えるようにする
+// ColumnIndexのバイト列の最小値・最大値は切り詰められていることがあるので、正確な値とはみなさない
+func (c *filterColumn) pageStatistics(page *PageIndexEntry) *Statistics {
+	stats := &Statistics{NullCount: page.NullCount}
+	if page.NullPage || c.comparator.IsNaN(page.Min) || c.comparator.IsNaN(page.Max) {
+		return stats
+	}
+
+	if reason := c.meta.untrustedStatistics(c.schema, &parquet.Statistics{MinValue: page.Min, MaxValue: page.Max}); reason != "" {
+		stats.Untrusted = reason
+		return stats
+	}
+
+	binary := *c.schema.Type == parquet.Type_BYTE_ARRAY || *c.schema.Type == parquet.Type_FIXED_LEN_BYTE_ARRAY
+	stats.Min, stats.Max = page.Min, page.Max
+	stats.MinExact, stats.MaxExact = !binary, !binary
+	return stats
+}
+
+// 選択した行について列の値をデコードし、matchが成り立つ行を選択する
+// matchには値をPLAINエンコーディングしたバイト列を渡す(nullならnil)
+// 辞書エンコーディングされたページについては、辞書の値毎に一度だけmatchを呼んでインデックスのビットセットを作り、
+// インデックスを読み取るreadRLEのコールバックでそれを引く(インデックスの配列は作らない)
+// 辞書のいずれの値もmatchを満たさず、全てのデータページが辞書エンコーディングされている場合はデータページを読まない
+func (c *filterColumn) scanRows(ctx context.Context, r *Reader, row *RowGroup, sel *rowSelection, match func(v []byte) bool) (*rowSelection, error) {
+	col := findColumn(row, c.path)
+	if col == nil {
+		return nil, fmt.Errorf("'%s' column does not exist in row group", c.path)
+	}
+
+	out := newRowSelection(sel.numRows)
+	out.ranges = sel.ranges
+	matchNull := match(nil)
+
+	var matchedIndices bitset
+	opts := scanOptions{
+		sel:       sel,
+		dictMatch: &matchedIndices,
+		onDict: func(dict *Values) bool {
+			matchedIndices = newBitset(dict.Len())
+			for i := 0; i < dict.Len(); i++ {
+				if match(dict.plain(i)) {
+					matchedIndices.set(i)
+				}
+			}
+			return matchNull || matchedIndices.any() || !col.AllPagesDictEncoded()
+		},
+	}
+
+	err := r.scanColumnChunk(ctx, col, c.schema, opts, func(page *dataPage) error {
+		// 繰り返しの無い列なので、レベルの位置がそのまま行の位置になる
+		value := 0
+		for i := 0; i < page.numValues; i++ {
+			matched := matchNull
+			if page.defLevels == nil || page.defLevels[i] == page.maxDef {
+				if page.values == nil {
+					matched = page.matched.has(value)
+				} else {
+					matched = match(page.values.plain(value))
+				}
+				value++
+			}
+
+			if row := page.firstRow + int64(i); matched && sel.has(row) {
+				out.set(row)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter rows by '%s': %w", c.path, err)
+	}
+
+	return out, nil
+}
+
+func (c *filterColumn) paths() []string {
+	return []string{c.path}
+}
+
+func (p *comparePredicate) mightMatch(row *RowGroup) bool {
+	return p.mightMatchChunk(row, p.match)
+}
+
+func (p *comparePredicate) mightContain(ctx context.Context, r *Reader, row *RowGroup) (bool, error) {
+	if p.op != OpEq {
+		return true, nil
+	}
+	return p.mightContainAny(ctx, r, row, [][]byte{p.value})
+}
+
+func (p *comparePredicate) rowRanges(row *RowGroup, indexes map[string]*PageIndex) RowRanges {
+	return p.pageRowRanges(row, indexes[p.path], p.match)
+}
+
+func (p *comparePredicate) filterRows(ctx context.Context, r *Reader, row *RowGroup, sel *rowSelection) (*rowSelection, error) {
+	return p.scanRows(ctx, r, row, sel, p.matchValue)
+}
+
+func (p *comparePredicate) matchValue(v []byte) bool {
+	return v != nil && compareValue(v, p.op, p.value, p.comparator)
+}
+
+// 値と定数の比較が成り立つかどうか
+// NaNとの比較は、IEEE 754と同様に!=のみが成り立つ
+func compareValue(v []byte, op CompareOp, value []byte, comparator *Comparator) bool {
+	if comparator.IsNaN(v) || comparator.IsNaN(value) {
+		return op == OpNe
+	}
+
+	c, err := comparator.Compare(v, value)
+	if err != nil {
+		return false
+	}
+
+	switch op {
+	case OpEq:
+		return c == 0
+	case OpNe:
+		return c != 0
+	case OpLt:
+		return c < 0
+	case OpLe:
+		return c <= 0
+	case OpGt:
+		return c > 0
+	case OpGe:
+		return c >= 0
+	default:
+		return false
+	}
+}
+
+func (p *comparePredicate) match(stats *Statistics, allNull bool) bool {
+	return !allNull && mightCompare(stats, p.op, p.value, p.comparator)
+}
+
+// 最小値・最大値の範囲に、値との比較が成り立つ値が存在し得るか
+// 最小値・最大値は切り詰められていても範囲の境界としては正しいので、正確でなくても用いる
+// ただし!=については、全ての値が比較する値と等しいことを確かめるために正確な値が必要になる
+func mightCompare(stats *Statistics, op CompareOp, value []byte, comparator *Comparator) bool {
+	if stats == nil || stats.Min == nil || stats.Max == nil {
+		return true
+	}
+
+	min, err := comparator.Compare(stats.Min, value)
+	if err != nil {
+		return true
+	}
+	max, err := comparator.Compare(stats.Max, value)
+	if err != nil {
+		return true
+	}
+
+	switch op {
+	case OpEq:
+		return min <= 0 && max >= 0
+	case OpNe:
+		// NaNは統計情報に含まれないので、浮動小数点数では判定できない
+		return comparator.isFloat() || !stats.MinExact || !stats.MaxExact || min != 0 || max != 0
+	case OpLt:
+		return min < 0
+	case OpLe:
+		return min <= 0
+	case OpGt:
+		return max > 0
+	case OpGe:
+		return max >= 0
+	default:
+		return true
+	}
+}
+
+func (p *inPredicate) mightMatch(row *RowGroup) bool {
+	return p.mightMatchChunk(row, p.match)
+}
+
+func (p *inPredicate) mightContain(ctx context.Context, r *Reader, row *RowGroup) (bool, error) {
+	if p.not {
+		return true, nil
+	}
+	return p.mightContainAny(ctx, r, row, p.values)
+}
+
+func (p *inPredicate) rowRanges(row *RowGroup, indexes map[string]*PageIndex) RowRanges {
+	return p.pageRowRanges(row, indexes[p.path], p.match)
+}
+
+func (p *inPredicate) filterRows(ctx context.Context, r *Reader, row *RowGroup, sel *rowSelection) (*rowSelection, error) {
+	return p.scanRows(ctx, r, row, sel, p.matchValue)
+}
+
+func (p *inPredicate) matchValue(v []byte) bool {
+	if v == nil {
+		return false
+	}
+
+	for _, value := range p.values {
+		if compareValue(v, OpEq, value, p.comparator) {
+			return !p.not
+		}
+	}
+	return p.not
+}
+
+func (p *inPredicate) match(stats *Statistics, allNull bool) bool {
+	if allNull {
+		return false
+	}
+
+	if p.not {
+		// NOT INは全ての値の!=が成り立つ行を求めるので、いずれかの値について成り立ち得なければ除外できる
+		for _, v := range p.values {
+			if !mightCompare(stats, OpNe, v, p.comparator) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, v := range p.values {
+		if mightCompare(stats, OpEq, v, p.comparator) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *nullPredicate) mightMatch(row *RowGroup) bool {
+	return p.mightMatchChunk(row, p.match)
+}
+
+func (p *nullPredicate) mightContain(ctx context.Context, r *Reader, row *RowGroup) (bool, error) {
+	return true, nil
+}
+
+func (p *nullPredicate) rowRanges(row *RowGroup, indexes map[string]*PageIndex) RowRanges {
+	return p.pageRowRanges(row, indexes[p.path], p.match)
+}
+
+func (p *nullPredicate) filterRows(ctx context.Context, r *Reader, row *RowGroup, sel *rowSelection) (*rowSelection, error) {
+	return p.scanRows(ctx, r, row, sel, func(v []byte) bool {
+		return (v == nil) != p.not
+	})
+}
+
+func (p *nullPredicate) match(stats *Statistics, allNull bool) bool {
+	if p.not {
+		return !allNull
+	}
+	return allNull || stats == nil || stats.NullCount == nil || *stats.NullCount > 0
+}
+
+func (p *patternPredicate) mightMatch(row *RowGroup) bool {
+	return p.mightMatchChunk(row, p.match)
+}
+
+func (p *patternPredicate) mightContain(ctx context.Context, r *Reader, row *RowGroup) (bool, error) {
+	return true, nil
+}
+
+func (p *patternPredicate) rowRanges(row *RowGroup, indexes map[string]*PageIndex) RowRanges {
+	return p.pageRowRanges(row, indexes[p.path], p.match)
+}
+
+func (p *patternPredicate) filterRows(ctx context.Context, r *Reader, row *RowGroup, sel *rowSelection) (*rowSelection, error) {
+	return p.scanRows(ctx, r, row, sel, func(v []byte) bool {
+		return v != nil && p.re.Match(v) != p.not
+	})
+}
+
+// 否定や接頭辞の無いパターンでは、全ての値がnullである場合のみ除外できる
+// 接頭辞を持つ値は[prefix, 接頭辞を持たずprefixより大きい値)の範囲にあるので、最小値・最大値の範囲と重なるか判定する
+func (p *patternPredicate) match(stats *Statistics, allNull bool) bool {
+	if allNull {
+		return false
+	}
+	if p.not || len(p.prefix) == 0 || stats == nil || stats.Min == nil || stats.Max == nil {
+		return true
+	}
+
+	return bytes.Compare(stats.Max, p.prefix) >= 0 &&
+		(bytes.Compare(stats.Min, p.prefix) <= 0 || bytes.HasPrefix(stats.Min, p.prefix))
+}
+
+func (p andPredicate) mightMatch(row *RowGroup) bool {
+	for _, child := range p {
+		if !child.mightMatch(row) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p orPredicate) mightMatch(row *RowGroup) bool {
+	for _, child := range p {
+		if child.mightMatch(row) {
+			return true
+		}
+	}
+	return len(p) == 0
+}
+
+func (p andPredicate) mightContain(ctx context.Context, r *Reader, row *RowGroup) (bool, error) {
+	for _, child := range p {
+		ok, err := child.mightContain(ctx, r, row)
+		if err != nil || !ok {
+			return ok, err
+		}
+	}
+	return true, nil
+}
+
+func (p orPredicate) mightContain(ctx context.Context, r *Reader, row *RowGroup) (bool, error) {
+	for _, child := range p {
+		ok, err := child.mightContain(ctx, r, row)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return len(p) == 0, nil
+}
+
+func (p andPredicate) rowRanges(row *RowGroup, indexes map[string]*PageIndex) RowRanges {
+	ranges := allRows(row.NumRows)
+	for _, child := range p {
+		ranges = ranges.intersect(child.rowRanges(row, indexes))
+	}
+	return ranges
+}
+
+func (p orPredicate) rowRanges(row *RowGroup, indexes map[string]*PageIndex) RowRanges {
+	if len(p) == 0 {
+		return allRows(row.NumRows)
+	}
+
+	ranges := make(RowRanges, 0)
+	for _, child := range p {
+		ranges = ranges.union(child.rowRanges(row, indexes))
+	}
+	return ranges
+}
+
+// 前の条件を満たす行についてのみ、次の条件の列をデコードする
+func (p andPredicate) filterRows(ctx context.Context, r *Reader, row *RowGroup, sel *rowSelection) (*rowSelection, error) {
+	var err error
+	for _, child := range p {
+		if sel.count() == 0 {
+			break
+		}
+
+		if sel, err = child.filterRows(ctx, r, row, sel); err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
+
+// 前の条件を満たさなかった行についてのみ、次の条件の列をデコードする
+func (p orPredicate) filterRows(ctx context.Context, r *Reader, row *RowGroup, sel *rowSelection) (*rowSelection, error) {
+	if len(p) == 0 {
+		return sel, nil
+	}
+
+	out := newRowSelection(sel.numRows)
+	out.ranges = sel.ranges
+	for _, child := range p {
+		rest := sel.andNot(out)
+		if rest.count() == 0 {
+			break
+		}
+
+		matched, err := child.filterRows(ctx, r, row, rest)
+		if err != nil {
+			return nil, err
+		}
+		out = out.or(matched)
+	}
+	return out, nil
+}
+
+func (p andPredicate) paths() []string {
+	return predicatePaths(p)
+}
+
+func (p orPredicate) paths() []string {
+	return predicatePaths(p)
+}
+
+func predicatePaths(predicates []predicate) []string {
+	var paths []string
+	for _, child := range predicates {
+		paths = append(paths, child.paths()...)
+	}
+	return paths
+}
@@ -0,0 +1,387 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type (
+	// 条件式の字句
+	filterToken struct {
+		kind  filterTokenKind
+		text  string // 識別子・キーワード・記号はそのまま、文字列リテラルは引用符を除いた値
+		value any    // リテラルの値
+		pos   int
+	}
+
+	filterTokenKind int
+
+	filterParser struct {
+		tokens []filterToken
+		pos    int
+	}
+)
+
+const (
+	tokenEOF filterTokenKind = iota
+	tokenIdent
+	tokenKeyword
+	tokenLiteral
+	tokenSymbol
+)
+
+var filterKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "IN": true, "IS": true, "NULL": true, "LIKE": true, "REGEXP": true,
+}
+
+var filterCompareOps = map[string]CompareOp{
+	"=": OpEq, "==": OpEq, "!=": OpNe, "<>": OpNe, "<": OpLt, "<=": OpLe, ">": OpGt, ">=": OpGe,
+}
+
+// SQLのWHERE句と同様の表記の条件式を解析する
+//
+//	amount >= 100 AND category IN ('a', 'b')
+//	NOT (price < 1.5 OR "user.name" IS NULL)
+//	name LIKE 'a%' OR name REGEXP '^[0-9]+$'
+//
+// 列のパスはドット区切りで、記号を含む場合はダブルクォートで囲む
+// リテラルは整数・小数・シングルクォートで囲んだ文字列・TRUE/FALSEのいずれか
+// キーワードの大文字・小文字は区別しない
+func ParseFilter(s string) (Expr, error) {
+	tokens, err := tokenize(s, filterKeywords, "end of filter")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected '%s' at %d", t.text, t.pos)
+	}
+
+	return expr, nil
+}
+
+// keywordsに含まれる語(大文字)はキーワード、それ以外の語は識別子として字句に分ける
+func tokenize(s string, keywords map[string]bool, eof string) ([]filterToken, error) {
+	var tokens []filterToken
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '\'' || c == '"':
+			// 引用符自体は、2つ重ねることで表す
+			var b strings.Builder
+			j := i + 1
+			for ; ; j++ {
+				if j >= len(s) {
+					return nil, fmt.Errorf("unterminated quote at %d", i)
+				}
+				if s[j] == c {
+					if j+1 < len(s) && s[j+1] == c {
+						b.WriteByte(c)
+						j++
+						continue
+					}
+					break
+				}
+				b.WriteByte(s[j])
+			}
+
+			if c == '\'' {
+				tokens = append(tokens, filterToken{kind: tokenLiteral, text: b.String(), value: b.String(), pos: i})
+			} else {
+				tokens = append(tokens, filterToken{kind: tokenIdent, text: b.String(), pos: i})
+			}
+			i = j + 1
+
+		case c >= '0' && c <= '9' || (c == '-' || c == '+' || c == '.') && i+1 < len(s) && (s[i+1] >= '0' && s[i+1] <= '9' || s[i+1] == '.'):
+			j := i + 1
+			for j < len(s) && (isNumberByte(s[j]) || (s[j] == '-' || s[j] == '+') && (s[j-1] == 'e' || s[j-1] == 'E')) {
+				j++
+			}
+
+			value, err := parseNumberLiteral(s[i:j])
+			if err != nil {
+				return nil, fmt.Errorf("invalid number '%s' at %d", s[i:j], i)
+			}
+			tokens = append(tokens, filterToken{kind: tokenLiteral, text: s[i:j], value: value, pos: i})
+			i = j
+
+		case c == '_' || unicode.IsLetter(rune(c)) || c >= 0x80:
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] == '.' || s[j] >= 0x80 || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+
+			word := s[i:j]
+			upper := strings.ToUpper(word)
+			switch {
+			case upper == "TRUE" || upper == "FALSE":
+				tokens = append(tokens, filterToken{kind: tokenLiteral, text: word, value: upper == "TRUE", pos: i})
+			case keywords[upper]:
+				tokens = append(tokens, filterToken{kind: tokenKeyword, text: upper, pos: i})
+			default:
+				tokens = append(tokens, filterToken{kind: tokenIdent, text: word, pos: i})
+			}
+			i = j
+
+		default:
+			symbol := ""
+			for _, candidate := range []string{"<=", ">=", "<>", "!=", "==", "=", "<", ">", "(", ")", ",", "*"} {
+				if strings.HasPrefix(s[i:], candidate) {
+					symbol = candidate
+					break
+				}
+			}
+
+			if symbol == "" {
+				return nil, fmt.Errorf("unexpected character '%c' at %d", c, i)
+			}
+			tokens = append(tokens, filterToken{kind: tokenSymbol, text: symbol, pos: i})
+			i += len(symbol)
+		}
+	}
+
+	return append(tokens, filterToken{kind: tokenEOF, text: eof, pos: len(s)}), nil
+}
+
+func isNumberByte(c byte) bool {
+	return c >= '0' && c <= '9' || c == '.' || c == 'e' || c == 'E'
+}
+
+// 整数はint64、int64に収まらない正の整数はuint64、それ以外はfloat64として扱う
+func parseNumberLiteral(s string) (any, error) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if u, err := strconv.ParseUint(strings.TrimPrefix(s, "+"), 10, 64); err == nil {
+		return u, nil
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// 次の字句が指定したキーワード又は記号なら読み進める
+func (p *filterParser) accept(text string) bool {
+	if t := p.peek(); (t.kind == tokenKeyword || t.kind == tokenSymbol) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.accept(text) {
+		t := p.peek()
+		return fmt.Errorf("expected '%s', but got '%s' at %d", text, t.text, t.pos)
+	}
+	return nil
+}
+
+// 優先順位はOR < AND < NOT < 比較の順
+func (p *filterParser) parseOr() (Expr, error) {
+	expr, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	exprs := []Expr{expr}
+	for p.accept("OR") {
+		if expr, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return AnyOf(exprs...), nil
+}
+
+func (p *filterParser) parseAnd() (Expr, error) {
+	expr, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	exprs := []Expr{expr}
+	for p.accept("AND") {
+		if expr, err = p.parseNot(); err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return AllOf(exprs...), nil
+}
+
+func (p *filterParser) parseNot() (Expr, error) {
+	if p.accept("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return Negate(expr), nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (Expr, error) {
+	if p.accept("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	t := p.next()
+	if t.kind != tokenIdent {
+		return nil, fmt.Errorf("expected column path, but got '%s' at %d", t.text, t.pos)
+	}
+	path := t.text
+
+	switch {
+	case p.accept("IS"):
+		not := p.accept("NOT")
+		if err := p.expect("NULL"); err != nil {
+			return nil, err
+		}
+		return &IsNull{Path: path, Not: not}, nil
+
+	case p.accept("IN"):
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &In{Path: path, Values: values}, nil
+
+	case p.accept("LIKE"):
+		pattern, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &Like{Path: path, Pattern: pattern}, nil
+
+	case p.accept("REGEXP"):
+		pattern, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &Regexp{Path: path, Pattern: pattern}, nil
+
+	case p.accept("NOT"):
+		switch {
+		case p.accept("LIKE"):
+			pattern, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			return &Like{Path: path, Pattern: pattern, Not: true}, nil
+
+		case p.accept("REGEXP"):
+			pattern, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			return &Regexp{Path: path, Pattern: pattern, Not: true}, nil
+		}
+
+		if err := p.expect("IN"); err != nil {
+			return nil, err
+		}
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &In{Path: path, Values: values, Not: true}, nil
+	}
+
+	op := p.next()
+	compareOp, ok := filterCompareOps[op.text]
+	if op.kind != tokenSymbol || !ok {
+		return nil, fmt.Errorf("expected operator after '%s', but got '%s' at %d", path, op.text, op.pos)
+	}
+
+	value, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Compare{Path: path, Op: compareOp, Value: value}, nil
+}
+
+func (p *filterParser) parseList() ([]any, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var values []any
+	for {
+		value, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// LIKE及びREGEXPのパターン(文字列リテラル)
+func (p *filterParser) parseString() (string, error) {
+	t := p.next()
+	s, ok := t.value.(string)
+	if t.kind != tokenLiteral || !ok {
+		return "", fmt.Errorf("expected pattern string, but got '%s' at %d", t.text, t.pos)
+	}
+
+	return s, nil
+}
+
+func (p *filterParser) parseLiteral() (any, error) {
+	t := p.next()
+	if t.kind != tokenLiteral {
+		return nil, fmt.Errorf("expected literal, but got '%s' at %d", t.text, t.pos)
+	}
+
+	return t.value, nil
+}
@@ -0,0 +1,425 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+type (
+	// GROUP BYで集計する列と、求める集計の組み合わせ
+	GroupAggregate struct {
+		Path  string
+		Funcs AggregateFunc
+	}
+
+	// GROUP BYの集計結果
+	GroupedAggregate struct {
+		Keys   []string `json:"keys"`   // キーの列のパス
+		Groups []*Group `json:"groups"` // キーの値の昇順(nullは最後)
+
+		ScannedRowGroups int `json:"scanned_row_groups"` // ページを読み取って集計した行グループの数
+		PrunedRowGroups  int `json:"pruned_row_groups"`  // 条件式を満たす行を含まないため、読み飛ばした行グループの数
+	}
+
+	// キーの値の組み合わせ毎の集計結果
+	Group struct {
+		Keys       []any        // 論理型に従って変換したキーの値(nullはnil)
+		Rows       int64        // 行の数(count(*))
+		Aggregates []*Aggregate // GroupAggregateと同じ順
+
+		keys        [][]byte // PLAINエンコーディングしたキーの値(ソートに用いる)
+		aggregators []*aggregator
+	}
+
+	// キーの列の値を、行グループ内で通しの番号に置き換える
+	// 行毎の比較やグループの検索は、値ではなく番号で行う
+	groupKey struct {
+		path       string
+		schema     *Schema
+		comparator *Comparator // ソート順が定義されていない列ならnil
+		ids        map[string]int32
+		values     [][]byte // 番号毎の値
+	}
+)
+
+const (
+	// キーの値がnullであることを表す番号
+	nullGroupKey = -1
+
+	// キーの値を読み取っていないことを表す番号(サルベージモードで読み飛ばしたページの行など)
+	unreadGroupKey = -2
+)
+
+// keysの列の値の組み合わせ毎に、aggsの列を集計する
+// ファイルを1度だけ走査し、全てのキー・集計を同時に求める
+// キーの列が辞書エンコーディングされていれば、辞書の値毎に行グループにつき1度だけキーの値を引き、行毎には辞書のインデックスから番号を得る
+// 行グループ毎に集計したグループを、キーの値が等しいもの同士でマージする
+// キー及び集計する列は繰り返しの無い列に限る
+// 条件式(WithFilter)がある場合、条件式を満たす行のみを集計する
+func (r *Reader) GroupBy(ctx context.Context, keys []string, aggs []GroupAggregate) (*GroupedAggregate, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no group keys are specified")
+	}
+
+	groupKeys := make([]*groupKey, len(keys))
+	for i, path := range keys {
+		schema, err := r.groupColumnSchema(path)
+		if err != nil {
+			return nil, err
+		}
+
+		// INT96等のソート順が無い列は、バイト列の順にソートする
+		comparator, _ := NewComparator(schema)
+		groupKeys[i] = &groupKey{path: path, schema: schema, comparator: comparator}
+	}
+
+	schemas := make([]*Schema, len(aggs))
+	for i, agg := range aggs {
+		schema, err := r.groupColumnSchema(agg.Path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := newAggregatorFuncs(schema, agg.Funcs); err != nil {
+			return nil, err
+		}
+		schemas[i] = schema
+	}
+
+	parts, err := runTasks(ctx, r, len(r.meta.RowGroups), func(ctx context.Context, r *Reader, i int) ([]*Group, error) {
+		return r.groupRowGroup(ctx, i, groupKeys, aggs, schemas)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 行グループ毎のグループを、行グループの順にキーの値が等しいもの同士でマージする
+	result := &GroupedAggregate{Keys: keys, Groups: make([]*Group, 0)}
+	groups := make(map[string]*Group)
+
+	for _, part := range parts {
+		if part == nil {
+			result.PrunedRowGroups++
+			continue
+		}
+		result.ScannedRowGroups++
+
+		for _, g := range part {
+			composite := g.compositeKey()
+			merged, ok := groups[composite]
+			if !ok {
+				groups[composite] = g
+				result.Groups = append(result.Groups, g)
+				continue
+			}
+
+			merged.Rows += g.Rows
+			for j, agg := range g.aggregators {
+				merged.aggregators[j].merge(agg)
+			}
+		}
+	}
+
+	for _, g := range result.Groups {
+		g.Keys = make([]any, len(groupKeys))
+		for k, key := range groupKeys {
+			g.Keys[k] = formatPlainValue(key.schema, g.keys[k])
+		}
+
+		g.Aggregates = make([]*Aggregate, len(aggs))
+		for j, agg := range aggs {
+			g.Aggregates[j] = &Aggregate{Path: agg.Path, Funcs: agg.Funcs, Rows: g.Rows}
+			g.aggregators[j].result(g.Aggregates[j])
+		}
+	}
+
+	sort.SliceStable(result.Groups, func(a, b int) bool {
+		for k, key := range groupKeys {
+			if c := key.compare(result.Groups[a].keys[k], result.Groups[b].keys[k]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	return result, nil
+}
+
+// 行グループ内の選択した行を、キーの値の組み合わせ毎にグループに分けて集計する
+// キーの値の番号は行グループ毎に振り直すので、groupKeysは複製して用いる
+// 条件式を満たす行が無ければnilを返す
+func (r *Reader) groupRowGroup(ctx context.Context, rowGroup int, groupKeys []*groupKey, aggs []GroupAggregate, schemas []*Schema) ([]*Group, error) {
+	ranges, err := r.RowRanges(ctx, rowGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+
+	sel, err := r.selectRows(ctx, rowGroup, ranges)
+	if err != nil {
+		return nil, err
+	}
+
+	if sel != nil && sel.count() == 0 {
+		return nil, nil
+	}
+
+	row := r.meta.RowGroups[rowGroup]
+	ids := make([][]int32, len(groupKeys))
+	keys := make([]*groupKey, len(groupKeys))
+	for k, key := range groupKeys {
+		keys[k] = &groupKey{path: key.path, schema: key.schema, comparator: key.comparator, ids: make(map[string]int32)}
+		if ids[k], err = keys[k].scan(ctx, r, row, sel); err != nil {
+			return nil, err
+		}
+	}
+
+	// 選択した行毎に、キーの番号の組み合わせからグループを決める
+	// サルベージモードでキーを読み取れなかった行は、nullのグループに入れず選択から外す
+	// 読み飛ばしたページの後も行の位置は保たれる(保てない場合は列チャンクの残りが読み取れなかった行になる)ので、
+	// キーの番号と集計する値は同じ行同士で対応する
+	groups := make([]*Group, 0)
+	byIDs := make(map[string]*Group)
+	composite := make([]byte, 4*len(keys))
+	rowGroups := make([]*Group, row.NumRows)
+
+	for n := int64(0); n < row.NumRows; n++ {
+		if sel != nil && !sel.has(n) {
+			continue
+		}
+
+		unread := false
+		for k := range keys {
+			unread = unread || ids[k][n] == unreadGroupKey
+			binary.LittleEndian.PutUint32(composite[4*k:], uint32(ids[k][n]))
+		}
+		if unread {
+			continue
+		}
+
+		g, ok := byIDs[string(composite)]
+		if !ok {
+			if g, err = newGroup(keys, ids, n, aggs, schemas); err != nil {
+				return nil, err
+			}
+			byIDs[string(composite)] = g
+			groups = append(groups, g)
+		}
+
+		g.Rows++
+		rowGroups[n] = g
+	}
+
+	for j, agg := range aggs {
+		col := findColumn(row, agg.Path)
+		if col == nil {
+			return nil, fmt.Errorf("'%s' column does not exist in row group", agg.Path)
+		}
+
+		err := r.scanColumnChunk(ctx, col, schemas[j], scanOptions{sel: sel}, func(page *dataPage) error {
+			// 繰り返しの無い列なので、レベルの位置がそのまま行の位置になる
+			value := 0
+			for v := 0; v < page.numValues; v++ {
+				nonNull := page.defLevels == nil || page.defLevels[v] == page.maxDef
+
+				if n := page.firstRow + int64(v); n < int64(len(rowGroups)) && rowGroups[n] != nil {
+					if nonNull {
+						rowGroups[n].aggregators[j].add(page.values, value)
+					} else {
+						rowGroups[n].aggregators[j].nulls++
+					}
+				}
+
+				if nonNull {
+					value++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to aggregate '%s': %w", agg.Path, err)
+		}
+	}
+
+	return groups, nil
+}
+
+// キーの値の組み合わせを、グループを引くための文字列にする(各値の前に、nullかどうかと長さを置く)
+func (g *Group) compositeKey() string {
+	var buf []byte
+	for _, key := range g.keys {
+		if key == nil {
+			buf = append(buf, 0)
+			continue
+		}
+
+		buf = append(buf, 1)
+		buf = binary.AppendUvarint(buf, uint64(len(key)))
+		buf = append(buf, key...)
+	}
+
+	return string(buf)
+}
+
+// GROUP BYのキー又は集計に用いる、繰り返しの無い列のスキーマを返す
+func (r *Reader) groupColumnSchema(path string) (*Schema, error) {
+	schema := r.meta.FindSchema(path)
+	if schema == nil || !schema.IsLeaf() {
+		return nil, fmt.Errorf("'%s' column does not exist", path)
+	}
+
+	if schema.HasRepetitionLevels() {
+		return nil, fmt.Errorf("grouping by repeated column '%s' is not supported", path)
+	}
+
+	return schema, nil
+}
+
+func newGroup(keys []*groupKey, ids [][]int32, row int64, aggs []GroupAggregate, schemas []*Schema) (*Group, error) {
+	g := &Group{keys: make([][]byte, len(keys)), aggregators: make([]*aggregator, len(schemas))}
+	for k, key := range keys {
+		if id := ids[k][row]; id != nullGroupKey {
+			g.keys[k] = key.values[id]
+		}
+	}
+
+	for j, schema := range schemas {
+		agg, err := newAggregatorFuncs(schema, aggs[j].Funcs)
+		if err != nil {
+			return nil, err
+		}
+		g.aggregators[j] = agg
+	}
+
+	return g, nil
+}
+
+// 値の番号を返す(初めて現れた値には新しい番号を振る)
+func (key *groupKey) id(v []byte) int32 {
+	if id, ok := key.ids[string(v)]; ok {
+		return id
+	}
+
+	// 値はページのバッファを参照しているので、コピーして保持する
+	s := string(v)
+	id := int32(len(key.values))
+	key.ids[s] = id
+	key.values = append(key.values, []byte(s))
+	return id
+}
+
+// 行グループ内の選択した行について、キーの値の番号を求める(nullの行はnullGroupKey、選択していない行や読み取れなかった行はunreadGroupKey)
+// 辞書エンコーディングされたページでは、辞書の値毎に1度だけ番号を引き、行毎には辞書のインデックスから番号を得る
+func (key *groupKey) scan(ctx context.Context, r *Reader, row *RowGroup, sel *rowSelection) ([]int32, error) {
+	col := findColumn(row, key.path)
+	if col == nil {
+		return nil, fmt.Errorf("'%s' column does not exist in row group", key.path)
+	}
+
+	ids := make([]int32, row.NumRows)
+	for i := range ids {
+		ids[i] = unreadGroupKey
+	}
+
+	var dictIDs []int32
+	opts := scanOptions{
+		sel:         sel,
+		dictIndices: true,
+		onDict: func(dict *Values) bool {
+			dictIDs = make([]int32, dict.Len())
+			for i := range dictIDs {
+				dictIDs[i] = key.id(dict.plain(i))
+			}
+			return true
+		},
+	}
+
+	err := r.scanColumnChunk(ctx, col, key.schema, opts, func(page *dataPage) error {
+		value := 0
+		for i := 0; i < page.numValues; i++ {
+			n := page.firstRow + int64(i)
+			selected := n < row.NumRows && (sel == nil || sel.has(n))
+
+			if page.defLevels != nil && page.defLevels[i] != page.maxDef {
+				if selected {
+					ids[n] = nullGroupKey
+				}
+				continue
+			}
+
+			if selected {
+				if page.values == nil {
+					ids[n] = dictIDs[page.indices[value]]
+				} else {
+					ids[n] = key.id(page.values.plain(value))
+				}
+			}
+			value++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read group key '%s': %w", key.path, err)
+	}
+
+	return ids, nil
+}
+
+// キーの値を比較する(nullは最後)
+func (key *groupKey) compare(a, b []byte) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	return comparePlainValues(key.comparator, a, b)
+}
+
+// PLAINエンコーディングされた値を列のソート順で比較する
+// ソート順が定義されていない列(comparatorがnil)や比較できない値は、バイト列の順で比較する
+func comparePlainValues(comparator *Comparator, a, b []byte) int {
+	if comparator != nil {
+		if c, err := comparator.Compare(a, b); err == nil {
+			return c
+		}
+	}
+
+	return bytes.Compare(a, b)
+}
+
+// キーの値、行の数及びGroupAggregate毎の集計を出力する
+func (g *Group) MarshalJSON() ([]byte, error) {
+	keys, err := json.Marshal(g.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `{"keys":%s,"rows":%d,"aggregates":[`, keys, g.Rows)
+
+	for i, result := range g.Aggregates {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		fmt.Fprintf(&buf, `{"path":%s`, strconv.Quote(result.Path))
+		if err := result.writeFuncsJSON(&buf); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('}')
+	}
+
+	buf.WriteString("]}")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+type (
+	// 値の種類数を推定するHyperLogLogのスケッチ
+	// 値はPLAINエンコーディングしたバイト列をxxHash64でハッシュして加える
+	// 同じ精度のスケッチ同士はマージでき、行グループ毎に求めたスケッチをシリアライズして保存しておくことができる
+	HyperLogLog struct {
+		precision uint8
+		registers []uint8 // ハッシュ値の上位precisionビットで選んだレジスタ毎の、残りのビットの先頭の0の数+1の最大値
+	}
+)
+
+const (
+	MinHyperLogLogPrecision     = 4
+	MaxHyperLogLogPrecision     = 18
+	DefaultHyperLogLogPrecision = 14 // レジスタは16384個で、相対標準誤差は約0.81%
+
+	hyperLogLogVersion = 1
+)
+
+// 2^precision個のレジスタを持つスケッチを作る
+func NewHyperLogLog(precision int) (*HyperLogLog, error) {
+	if precision < MinHyperLogLogPrecision || precision > MaxHyperLogLogPrecision {
+		return nil, fmt.Errorf("precision of HyperLogLog must be in [%d, %d], but got %d", MinHyperLogLogPrecision, MaxHyperLogLogPrecision, precision)
+	}
+
+	return &HyperLogLog{precision: uint8(precision), registers: make([]uint8, 1<<precision)}, nil
+}
+
+func (h *HyperLogLog) Precision() int {
+	return int(h.precision)
+}
+
+// PLAINエンコーディングされた値を加える
+func (h *HyperLogLog) Add(plain []byte) {
+	h.addHash(xxHash64(plain))
+}
+
+func (h *HyperLogLog) addHash(hash uint64) {
+	index := hash >> (64 - h.precision)
+	rank := uint8(bits.LeadingZeros64(hash<<h.precision|1<<(h.precision-1))) + 1
+
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// 他のスケッチに加えた値を、このスケッチにも加えたことにする
+func (h *HyperLogLog) Merge(other *HyperLogLog) error {
+	if h.precision != other.precision {
+		return fmt.Errorf("can not merge HyperLogLog of precision %d into %d", other.precision, h.precision)
+	}
+
+	for i, rank := range other.registers {
+		if rank > h.registers[i] {
+			h.registers[i] = rank
+		}
+	}
+
+	return nil
+}
+
+// 値の種類数の推定値
+// 推定値が小さい範囲では、空のレジスタの数から求めるLinear Countingに切り替える
+func (h *HyperLogLog) Estimate() uint64 {
+	m := float64(len(h.registers))
+
+	sum, zeros := 0.0, 0
+	for _, rank := range h.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	estimate := hyperLogLogAlpha(len(h.registers)) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(estimate + 0.5)
+}
+
+// 推定値の相対標準誤差
+func (h *HyperLogLog) StandardError() float64 {
+	return 1.04 / math.Sqrt(float64(len(h.registers)))
+}
+
+func hyperLogLogAlpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
+
+// バージョン(1バイト)、精度(1バイト)、レジスタの値(2^精度バイト)の順に並べたバイト列に変換する
+func (h *HyperLogLog) MarshalBinary() ([]byte, error) {
+	return append([]byte{hyperLogLogVersion, h.precision}, h.registers...), nil
+}
+
+func (h *HyperLogLog) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("HyperLogLog is too short(%d bytes)", len(data))
+	}
+	if data[0] != hyperLogLogVersion {
+		return fmt.Errorf("unsupported HyperLogLog version: %d", data[0])
+	}
+
+	precision := int(data[1])
+	if precision < MinHyperLogLogPrecision || precision > MaxHyperLogLogPrecision {
+		return fmt.Errorf("invalid precision of HyperLogLog: %d", precision)
+	}
+	if len(data) != 2+1<<precision {
+		return fmt.Errorf("HyperLogLog of precision %d must be %d bytes, but got %d bytes", precision, 2+1<<precision, len(data))
+	}
+
+	for _, rank := range data[2:] {
+		if int(rank) > 64-precision+1 {
+			return fmt.Errorf("invalid register value of HyperLogLog: %d", rank)
+		}
+	}
+
+	h.precision = uint8(precision)
+	h.registers = append([]uint8(nil), data[2:]...)
+	return nil
+}
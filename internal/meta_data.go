@@ -3,23 +3,41 @@ package internal
 import (
 	"github.com/murakmii/retsu/thrift/parquet"
 	"strings"
+	"sync"
 )
 
 // Parquetファイルの構造を表すための一連の構造体
 type (
 	MetaData struct {
 		SchemaTree *Schema     `json:"schema_tree"`
+		Leaves     []*Schema   `json:"-"` // スキーマ内での順序を保った葉の一覧
 		TotalRows  int64       `json:"total_rows"`
 		RowGroups  []*RowGroup `json:"row_groups"`
+		CreatedBy  *CreatedBy  `json:"created_by,omitempty"`
+
+		// ファイルを書き込んだライターに該当する既知の不具合(PARQUET-251等)
+		// 読み取り時には、これらの不具合を回避するように振る舞う
+		KnownDefects []string `json:"known_defects,omitempty"`
+
+		schemaElements []*parquet.SchemaElement // フッターに格納されていたスキーマそのもの
+		columnOrders   []*parquet.ColumnOrder   // 葉の順序に対応する、統計情報の最小値・最大値のソート順(無ければnil)
 	}
 
 	Schema struct {
 		Name           string                       `json:"name"`
+		Path           string                       `json:"-"`
 		Type           *parquet.Type                `json:"type,omitempty"`
 		TypeLength     *int32                       `json:"type_length,omitempty"`
+		ConvertedType  *parquet.ConvertedType       `json:"converted_type,omitempty"`
+		LogicalType    *parquet.LogicalType         `json:"logical_type,omitempty"`
+		Scale          *int32                       `json:"scale,omitempty"`     // DECIMALのスケール
+		Precision      *int32                       `json:"precision,omitempty"` // DECIMALの精度
 		RepetitionType *parquet.FieldRepetitionType `json:"repetition_type"`
 		Children       map[string]*Schema           `json:"children,omitempty"`
 		Depth          int                          `json:"depth"`
+
+		MaxDefinitionLevel int `json:"max_definition_level"`
+		MaxRepetitionLevel int `json:"max_repetition_level"`
 	}
 
 	RowGroup struct {
@@ -29,12 +47,59 @@ type (
 
 	ColumnChunk struct {
 		Path                  string                   `json:"path"`
+		Type                  parquet.Type             `json:"type"`
 		Codec                 parquet.CompressionCodec `json:"codec,omitempty"`
+		Encodings             []parquet.Encoding       `json:"encodings,omitempty"`
 		NumValues             int64                    `json:"num_values"`
 		TotalUncompressedSize int64                    `json:"total_uncompressed_size"`
 		TotalCompressedSize   int64                    `json:"total_compressed_size"`
 		DataPageOffset        int64                    `json:"data_page_offset"`
 		DictPageOffset        *int64                   `json:"dict_page_offset"`
+		BloomFilterOffset     *int64                   `json:"bloom_filter_offset,omitempty"`
+		BloomFilterLength     *int32                   `json:"bloom_filter_length,omitempty"`
+		ColumnIndexOffset     *int64                   `json:"column_index_offset,omitempty"`
+		ColumnIndexLength     *int32                   `json:"column_index_length,omitempty"`
+		OffsetIndexOffset     *int64                   `json:"offset_index_offset,omitempty"`
+		OffsetIndexLength     *int32                   `json:"offset_index_length,omitempty"`
+		Statistics            *Statistics              `json:"statistics,omitempty"`
+		SizeStatistics        *SizeStatistics          `json:"size_statistics,omitempty"`
+		PageIndex             *PageIndex               `json:"page_index,omitempty"`
+		Encrypted             bool                     `json:"encrypted,omitempty"`
+		RowGroupOrdinal       int16                    `json:"-"`
+		ColumnOrdinal         int16                    `json:"-"`
+
+		decryptor       *columnDecryptor             // 暗号化された列チャンクのうち、鍵が得られたもののみ設定される
+		encodingStats   []*parquet.PageEncodingStats // ページの種類とエンコーディング毎のページ数(無ければnil)
+		tailPadding     int64                        // ライターの不具合でサイズが不足している場合に、末尾として余分に見込むバイト数
+		sniffDict       bool                         // メタデータの辞書ページのオフセットを信用できないので、辞書ページの有無をページヘッダの種類で判定する
+		bloomFilter     *BloomFilter                 // 条件式の判定のために読み取ったブルームフィルタ(bloomFilterReadがtrueでnilなら無い)
+		bloomFilterRead bool
+		cacheMu         sync.Mutex // 読み取り時に保持するPageIndex及びブルームフィルタを、複数のgoroutineから読み書きするためのロック
+	}
+
+	// 列チャンク又はページのサイズに関する統計情報(Parquet 2.10以降)
+	// ヒストグラムのi番目の要素は、レベルがiである値の数を表す
+	SizeStatistics struct {
+		UnencodedByteArrayDataBytes *int64  `json:"unencoded_byte_array_data_bytes,omitempty"`
+		RepetitionLevelHistogram    []int64 `json:"repetition_level_histogram,omitempty"`
+		DefinitionLevelHistogram    []int64 `json:"definition_level_histogram,omitempty"`
+	}
+
+	// ページインデックス(ColumnIndex及びOffsetIndex)
+	PageIndex struct {
+		BoundaryOrder *parquet.BoundaryOrder `json:"boundary_order,omitempty"`
+		Pages         []*PageIndexEntry      `json:"pages"`
+	}
+
+	PageIndexEntry struct {
+		Offset             int64           `json:"offset"`
+		CompressedPageSize int32           `json:"compressed_page_size"`
+		FirstRowIndex      int64           `json:"first_row_index"`
+		NullPage           bool            `json:"null_page"`
+		NullCount          *int64          `json:"null_count,omitempty"`
+		Min                []byte          `json:"-"`
+		Max                []byte          `json:"-"`
+		SizeStatistics     *SizeStatistics `json:"size_statistics,omitempty"`
 	}
 )
 
@@ -70,12 +135,123 @@ func (s *MetaData) FindColumnChunk(path string) []*ColumnChunk {
 	return columns
 }
 
+// 列チャンクの値を復号した際に必要となるメモリ量を、SizeStatisticsから見積もる
+// 見積もりに必要な統計情報が無い場合は第二戻り値としてfalseを返す
+func (s *MetaData) EstimateDecodedSize(path string) (int64, bool) {
+	schema := s.FindSchema(path)
+	if schema == nil || !schema.IsLeaf() {
+		return 0, false
+	}
+
+	var total int64
+	for _, col := range s.FindColumnChunk(path) {
+		size, ok := col.estimateDecodedSize(schema)
+		if !ok {
+			return 0, false
+		}
+		total += size
+	}
+
+	return total, true
+}
+
+func (col *ColumnChunk) estimateDecodedSize(schema *Schema) (int64, bool) {
+	stats := col.SizeStatistics
+
+	switch *schema.Type {
+	case parquet.Type_BYTE_ARRAY:
+		// 可変長の値は、エンコード前のバイト数がそのまま分かる
+		if stats == nil || stats.UnencodedByteArrayDataBytes == nil {
+			return 0, false
+		}
+		return *stats.UnencodedByteArrayDataBytes, true
+
+	default:
+		// 固定長の値は、NULLでない値の数(定義レベルが最大である値の数)と型のサイズから求める
+		numValues := col.NumValues
+		if schema.HasDefinitionLevels() {
+			if stats == nil || len(stats.DefinitionLevelHistogram) == 0 {
+				return 0, false
+			}
+			numValues = stats.DefinitionLevelHistogram[len(stats.DefinitionLevelHistogram)-1]
+		}
+		return numValues * int64(schema.ValueSize()), true
+	}
+}
+
+// 統計情報の最小値・最大値のソート順が定義されているかどうか
+// column_ordersが無い場合は、型によって決まるソート順であるとみなす
+func (s *MetaData) columnOrderDefined(schema *Schema) bool {
+	if s.columnOrders == nil {
+		return true
+	}
+
+	for i, leaf := range s.Leaves {
+		if leaf == schema {
+			return i < len(s.columnOrders) && s.columnOrders[i].IsSetTYPE_ORDER()
+		}
+	}
+
+	return false
+}
+
 func (schema *Schema) IsLeaf() bool {
 	return schema.Type != nil
 }
 
+// 全てのデータページが辞書エンコーディングされていることが、メタデータから分かるかどうか
+// encoding_statsが無い場合はparquet-mrと同様にencodingsから判定するが、
+// RLE_DICTIONARYの場合は辞書ページのPLAINとフォールバックしたページのPLAINを区別できないので、falseを返す
+func (col *ColumnChunk) AllPagesDictEncoded() bool {
+	if col.encodingStats != nil {
+		for _, stats := range col.encodingStats {
+			dataPage := stats.PageType == parquet.PageType_DATA_PAGE || stats.PageType == parquet.PageType_DATA_PAGE_V2
+			dictEncoded := stats.Encoding == parquet.Encoding_PLAIN_DICTIONARY || stats.Encoding == parquet.Encoding_RLE_DICTIONARY
+			if dataPage && stats.Count > 0 && !dictEncoded {
+				return false
+			}
+		}
+		return true
+	}
+
+	plainDict := false
+	for _, encoding := range col.Encodings {
+		switch encoding {
+		case parquet.Encoding_PLAIN_DICTIONARY:
+			plainDict = true
+		case parquet.Encoding_RLE, parquet.Encoding_BIT_PACKED:
+			// レベルのエンコーディング
+		default:
+			return false
+		}
+	}
+
+	return plainDict
+}
+
+// メタデータ上、辞書ページを持つかどうか
+// 辞書ページのオフセットとして0や、データページ以降の位置を書き込むライターがあるので、そのような値は無視する
+// この場合も辞書ページ自体はデータページのオフセットに置かれているので、実際に辞書ページがあるかどうかはページヘッダの種類で判定する
+// オフセットを書き込まない不具合を持つライター(PARQUET-1850)や、created_byが無く不明なライターの場合も同様に判定する
 func (col *ColumnChunk) HasDict() bool {
-	return col.DictPageOffset != nil
+	return col.DictPageOffset != nil && *col.DictPageOffset > 0 && *col.DictPageOffset < col.DataPageOffset
+}
+
+func (col *ColumnChunk) HasBloomFilter() bool {
+	return col.BloomFilterOffset != nil
+}
+
+func (col *ColumnChunk) HasColumnIndex() bool {
+	return col.ColumnIndexOffset != nil
+}
+
+func (col *ColumnChunk) HasOffsetIndex() bool {
+	return col.OffsetIndexOffset != nil
+}
+
+// 列チャンクを読み取れるかどうか(暗号化されていないか、鍵が得られているか)
+func (col *ColumnChunk) Decryptable() bool {
+	return !col.Encrypted || col.decryptor != nil
 }
 
 func (col *ColumnChunk) PageHeadOffset() int64 {
@@ -88,16 +264,34 @@ func (col *ColumnChunk) PageHeadOffset() int64 {
 
 func (col *ColumnChunk) PageTailOffset() int64 {
 	if col.Codec == parquet.CompressionCodec_UNCOMPRESSED {
-		return col.PageHeadOffset() + col.TotalUncompressedSize
+		return col.PageHeadOffset() + col.TotalUncompressedSize + col.tailPadding
 	} else {
-		return col.PageHeadOffset() + col.TotalCompressedSize
+		return col.PageHeadOffset() + col.TotalCompressedSize + col.tailPadding
+	}
+}
+
+// 固定長の物理型について、値1つのバイト数を返す
+func (schema *Schema) ValueSize() int {
+	switch *schema.Type {
+	case parquet.Type_BOOLEAN:
+		return 1
+	case parquet.Type_INT32, parquet.Type_FLOAT:
+		return 4
+	case parquet.Type_INT64, parquet.Type_DOUBLE:
+		return 8
+	case parquet.Type_INT96:
+		return 12
+	case parquet.Type_FIXED_LEN_BYTE_ARRAY:
+		return int(*schema.TypeLength)
+	default:
+		return 0
 	}
 }
 
 func (schema *Schema) HasRepetitionLevels() bool {
-	return schema.Depth > 1
+	return schema.MaxRepetitionLevel > 0
 }
 
 func (schema *Schema) HasDefinitionLevels() bool {
-	return schema.RepetitionType != nil && *schema.RepetitionType != parquet.FieldRepetitionType_REQUIRED
+	return schema.MaxDefinitionLevel > 0
 }
@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+// 全ての列チャンクについてページインデックスを読み取り、メタデータに格納する
+func (par *Parquet) InspectPageIndex(ctx context.Context, meta *MetaData) error {
+	for i, row := range meta.RowGroups {
+		for _, col := range row.Columns {
+			// 鍵が得られない暗号化された列は、ページインデックスも読み取れないので飛ばす
+			if !col.Decryptable() {
+				continue
+			}
+
+			index, err := par.ReadPageIndex(ctx, col)
+			if err != nil {
+				return fmt.Errorf("failed to read page index of '%s' in row group %d: %w", col.Path, i, err)
+			}
+
+			col.cacheMu.Lock()
+			col.PageIndex = index
+			col.cacheMu.Unlock()
+		}
+	}
+
+	return nil
+}
+
+// 列チャンクのページインデックスを読み取る
+// OffsetIndexを持たない列チャンクの場合はnilを返す
+func (par *Parquet) ReadPageIndex(ctx context.Context, col *ColumnChunk) (*PageIndex, error) {
+	if !col.HasOffsetIndex() {
+		return nil, nil
+	}
+
+	offsetIndex := &parquet.OffsetIndex{}
+	if err := par.cursorAt(*col.OffsetIndexOffset).readColumnThrift(ctx, col, moduleOffsetIndex, -1, offsetIndex); err != nil {
+		return nil, fmt.Errorf("failed to read offset index: %w", err)
+	}
+
+	index := &PageIndex{Pages: make([]*PageIndexEntry, len(offsetIndex.PageLocations))}
+	for i, loc := range offsetIndex.PageLocations {
+		index.Pages[i] = &PageIndexEntry{
+			Offset:             loc.Offset,
+			CompressedPageSize: loc.CompressedPageSize,
+			FirstRowIndex:      loc.FirstRowIndex,
+		}
+
+		if len(offsetIndex.UnencodedByteArrayDataBytes) == len(index.Pages) {
+			index.Pages[i].SizeStatistics = &SizeStatistics{
+				UnencodedByteArrayDataBytes: &offsetIndex.UnencodedByteArrayDataBytes[i],
+			}
+		}
+	}
+
+	// ColumnIndexは任意なので、無ければOffsetIndexの情報のみを返す
+	if !col.HasColumnIndex() {
+		return index, nil
+	}
+
+	columnIndex := &parquet.ColumnIndex{}
+	if err := par.cursorAt(*col.ColumnIndexOffset).readColumnThrift(ctx, col, moduleColumnIndex, -1, columnIndex); err != nil {
+		return nil, fmt.Errorf("failed to read column index: %w", err)
+	}
+
+	numPages := len(index.Pages)
+	if len(columnIndex.NullPages) != numPages {
+		return nil, fmt.Errorf("column index has %d pages, but offset index has %d pages", len(columnIndex.NullPages), numPages)
+	}
+
+	index.BoundaryOrder = &columnIndex.BoundaryOrder
+	for i, page := range index.Pages {
+		page.NullPage = columnIndex.NullPages[i]
+		page.Min = columnIndex.MinValues[i]
+		page.Max = columnIndex.MaxValues[i]
+
+		if len(columnIndex.NullCounts) == numPages {
+			page.NullCount = &columnIndex.NullCounts[i]
+		}
+
+		// レベルのヒストグラムは全ページ分が1つのリストに連結されているので、ページ毎に切り出す
+		repHist := splitHistogram(columnIndex.RepetitionLevelHistograms, numPages, i)
+		defHist := splitHistogram(columnIndex.DefinitionLevelHistograms, numPages, i)
+		if repHist == nil && defHist == nil {
+			continue
+		}
+
+		if page.SizeStatistics == nil {
+			page.SizeStatistics = &SizeStatistics{}
+		}
+		page.SizeStatistics.RepetitionLevelHistogram = repHist
+		page.SizeStatistics.DefinitionLevelHistogram = defHist
+	}
+
+	return index, nil
+}
+
+func splitHistogram(histograms []int64, numPages int, page int) []int64 {
+	if numPages == 0 || len(histograms) == 0 || len(histograms)%numPages != 0 {
+		return nil
+	}
+
+	width := len(histograms) / numPages
+	return histograms[page*width : (page+1)*width]
+}
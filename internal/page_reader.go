@@ -0,0 +1,281 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+type (
+	// 列チャンク内のページを先頭から順に読み取る
+	pageReader struct {
+		cur            *cursor // 列チャンクを読み取る位置(pageReader毎に持つので、列チャンク毎に並行に読み取れる)
+		col            *ColumnChunk
+		verifyChecksum bool  // ページヘッダにCRCがあれば検証する
+		pages          int   // これまでに読み取ったページの数
+		dataPages      int16 // これまでに読み取ったデータページの数(暗号化時のAADに含めるページの序数)
+		dictPage       bool  // 辞書ページを読み取ったかどうか
+		next           int64 // 最後にヘッダと本体を読み取れたページの、次のページのオフセット
+		offset         int64 // 最後にヘッダを読み取ったページのオフセット
+		values         int64 // これまでに読み取ったデータページのヘッダにある値の数の合計
+	}
+
+	// ページのCRCが一致しない場合のエラー
+	PageCorruptionError struct {
+		Offset   int64  // ページヘッダのファイル内オフセット
+		RowGroup int16  // 行グループの序数
+		Path     string // 列のパス
+		Page     int    // 列チャンク内でのページの序数(辞書ページを含む)
+		Expected uint32 // ページヘッダに記録されたCRC
+		Actual   uint32 // 読み取ったページから計算したCRC
+	}
+)
+
+// 列チャンクの先頭から、ページを読み取る準備をする
+func newPageReader(par *Parquet, col *ColumnChunk, verifyChecksum bool) *pageReader {
+	return &pageReader{
+		cur:            par.cursorAt(col.PageHeadOffset()),
+		col:            col,
+		verifyChecksum: verifyChecksum,
+		next:           col.PageHeadOffset(),
+	}
+}
+
+func (e *PageCorruptionError) Error() string {
+	return fmt.Sprintf(
+		"page is corrupted(offset: %d, row group: %d, column: '%s', page: %d): crc32 mismatch(expected: %08x, actual: %08x)",
+		e.Offset, e.RowGroup, e.Path, e.Page, e.Expected, e.Actual,
+	)
+}
+
+// 列チャンクの先頭のページが辞書ページかどうか
+// メタデータの辞書ページのオフセットを信用できないライターの場合は、ページヘッダの種類で判定する
+// 暗号化された列チャンクでは、ヘッダの復号に辞書ページかどうかが必要になるのでメタデータに従う
+// 先読みには別のcursorを用いるので、位置は変わらない
+func (pr *pageReader) hasDict(ctx context.Context) bool {
+	if !pr.col.sniffDict || pr.col.Encrypted || pr.pages > 0 {
+		return pr.pages == 0 && pr.col.HasDict()
+	}
+
+	// ヘッダを読み取れない場合は、後続のデータページの読み取りでエラーとして扱う
+	header := &parquet.PageHeader{}
+	err := pr.cur.par.cursorAt(pr.cur.offset).readThrift(ctx, header)
+
+	return err == nil && header.Type == parquet.PageType_DICTIONARY_PAGE
+}
+
+// 辞書ページを読み取る
+func (pr *pageReader) readDictPage(ctx context.Context) (*parquet.PageHeader, []byte, error) {
+	pr.dictPage = true
+	return pr.read(ctx, moduleDictionaryPageHeader, moduleDictionaryPage, -1)
+}
+
+// データページを読み取る
+func (pr *pageReader) readDataPage(ctx context.Context) (*parquet.PageHeader, []byte, error) {
+	header, data, err := pr.read(ctx, moduleDataPageHeader, moduleDataPage, pr.dataPages)
+	if header != nil {
+		pr.dataPages++
+	}
+
+	return header, data, err
+}
+
+// データページのヘッダのみを読み取る
+// 続けてreadDataPageBody又はskipDataPageBodyを呼ぶこと
+func (pr *pageReader) readDataPageHeader(ctx context.Context) (*parquet.PageHeader, error) {
+	return pr.readHeader(ctx, moduleDataPageHeader, pr.dataPages)
+}
+
+// readDataPageHeaderで読み取ったヘッダに続く、データページの本体を読み取る
+func (pr *pageReader) readDataPageBody(header *parquet.PageHeader) ([]byte, error) {
+	data, err := pr.readBody(header, moduleDataPage, pr.dataPages)
+	pr.dataPages++
+
+	return data, err
+}
+
+// readDataPageHeaderで読み取ったヘッダに続く、データページの本体を読まずに飛ばす
+func (pr *pageReader) skipDataPageBody(header *parquet.PageHeader) error {
+	if err := pr.checkPageSize(header); err != nil {
+		return err
+	}
+	if err := pr.cur.skipColumnBytes(pr.col, int64(header.CompressedPageSize)); err != nil {
+		return err
+	}
+
+	pr.next = pr.cur.offset
+	pr.values += pageValues(header)
+	pr.pages++
+	pr.dataPages++
+	return nil
+}
+
+// OffsetIndexに従って、列チャンク内のordinal番目のデータページにシークする
+func (pr *pageReader) seekDataPage(ordinal int, offset int64) {
+	pr.cur.seek(offset)
+
+	pr.pages = ordinal
+	if pr.dictPage {
+		pr.pages++
+	}
+	pr.dataPages = int16(ordinal)
+	pr.next = offset
+}
+
+// 列チャンクの末尾まで読み取ったかどうか
+// 列チャンクのサイズが正しくないライターもあるので、列チャンクの値の数だけ読み取った時点でも終わりとする
+func (pr *pageReader) done() bool {
+	return pr.values >= pr.col.NumValues || pr.cur.offset >= pr.col.PageTailOffset()
+}
+
+// 次に読み取るページのオフセット
+func (pr *pageReader) position() int64 {
+	return pr.cur.offset
+}
+
+func (pr *pageReader) read(
+	ctx context.Context,
+	headerModule moduleType,
+	pageModule moduleType,
+	pageOrdinal int16,
+) (*parquet.PageHeader, []byte, error) {
+	header, err := pr.readHeader(ctx, headerModule, pageOrdinal)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := pr.readBody(header, pageModule, pageOrdinal)
+	if err != nil {
+		// CRCが一致しない場合でもページ本体は読み飛ばされているので、呼び出し元が次のページへ進めるようにヘッダは返す
+		if _, ok := err.(*PageCorruptionError); ok {
+			return header, nil, err
+		}
+		return nil, nil, err
+	}
+
+	return header, data, nil
+}
+
+func (pr *pageReader) readHeader(ctx context.Context, headerModule moduleType, pageOrdinal int16) (*parquet.PageHeader, error) {
+	offset := pr.cur.offset
+
+	header := &parquet.PageHeader{}
+	if err := pr.cur.readColumnThrift(ctx, pr.col, headerModule, pageOrdinal, header); err != nil {
+		return nil, err
+	}
+
+	pr.offset = offset
+	return header, nil
+}
+
+func (pr *pageReader) readBody(header *parquet.PageHeader, pageModule moduleType, pageOrdinal int16) ([]byte, error) {
+	if err := pr.checkPageSize(header); err != nil {
+		return nil, err
+	}
+
+	data, err := pr.cur.readColumnBytes(pr.col, pageModule, pageOrdinal, int64(header.CompressedPageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	pr.next = pr.cur.offset
+
+	pr.values += pageValues(header)
+
+	// CRCは圧縮後(暗号化前)のページ本体に対して計算されている
+	if pr.verifyChecksum && header.IsSetCrc() {
+		if actual := crc32.ChecksumIEEE(data); actual != uint32(*header.Crc) {
+			err := &PageCorruptionError{
+				Offset:   pr.offset,
+				RowGroup: pr.col.RowGroupOrdinal,
+				Path:     pr.col.Path,
+				Page:     pr.pages,
+				Expected: uint32(*header.Crc),
+				Actual:   actual,
+			}
+
+			pr.pages++
+			return nil, err
+		}
+	}
+
+	pr.pages++
+
+	// データページv2では、レベルは圧縮されずに値の前に置かれているので、値の部分のみを解凍する
+	if header.Type == parquet.PageType_DATA_PAGE_V2 && header.DataPageHeaderV2 != nil {
+		v2 := header.DataPageHeaderV2
+		levelsLen, err := levelsLength(v2, len(data))
+		if err != nil {
+			return nil, err
+		}
+
+		if !v2.IsCompressed {
+			return data, nil
+		}
+		if levelsLen > int(header.UncompressedPageSize) {
+			return nil, fmt.Errorf("levels length(%d) exceeds uncompressed page size(%d)", levelsLen, header.UncompressedPageSize)
+		}
+
+		values, err := decompress(pr.col.Codec, data[levelsLen:], int(header.UncompressedPageSize)-levelsLen)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(data[:levelsLen:levelsLen], values...), nil
+	}
+
+	return decompress(pr.col.Codec, data, int(header.UncompressedPageSize))
+}
+
+// ヘッダにあるページ本体のサイズが、列チャンクの残りに収まるかどうかを検証する
+// 暗号化されている場合、ページ本体の長さはモジュール自身が持つので検証しない
+func (pr *pageReader) checkPageSize(header *parquet.PageHeader) error {
+	if pr.col.Encrypted {
+		return nil
+	}
+
+	size, rest := int64(header.CompressedPageSize), pr.col.PageTailOffset()-pr.cur.offset
+	if size < 0 || size > rest {
+		return fmt.Errorf("page size(%d) is out of column chunk(remaining: %d bytes)", size, rest)
+	}
+
+	return nil
+}
+
+// データページv2の本体の先頭にある、圧縮されていないレベルのバイト数
+// レベルの長さが負であるか、ページ本体のサイズを超える場合はエラーにする
+func levelsLength(v2 *parquet.DataPageHeaderV2, size int) (int, error) {
+	repLen, defLen := int(v2.RepetitionLevelsByteLength), int(v2.DefinitionLevelsByteLength)
+	if repLen < 0 || defLen < 0 || repLen+defLen > size {
+		return 0, fmt.Errorf("levels length(repetition: %d, definition: %d) exceeds page size(%d)", repLen, defLen, size)
+	}
+
+	return repLen + defLen, nil
+}
+
+// データページのヘッダにある値の数(データページでなければ0)
+func pageValues(header *parquet.PageHeader) int64 {
+	switch {
+	case header.Type == parquet.PageType_DATA_PAGE && header.DataPageHeader != nil:
+		return int64(header.DataPageHeader.NumValues)
+	case header.Type == parquet.PageType_DATA_PAGE_V2 && header.DataPageHeaderV2 != nil:
+		return int64(header.DataPageHeaderV2.NumValues)
+	default:
+		return 0
+	}
+}
+
+// データページのヘッダから分かる、ページに含まれる行の数
+// 繰り返しのある列のデータページv1では、レベルをデコードしないと分からないのでfalseを返す
+func pageRows(header *parquet.PageHeader, schema *Schema) (int64, bool) {
+	switch {
+	case header.Type == parquet.PageType_DATA_PAGE_V2 && header.DataPageHeaderV2 != nil:
+		return int64(header.DataPageHeaderV2.NumRows), true
+	case header.Type == parquet.PageType_DATA_PAGE && header.DataPageHeader != nil && !schema.HasRepetitionLevels():
+		return int64(header.DataPageHeader.NumValues), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// n個のワーカー(goroutine)で、行グループ(Projectionでは列チャンク)毎の読み取りを並列に行う
+// ワーカーは同じParquetを共有し、それぞれオフセットを指定して読み取る
+// 途中結果はワーカーの数に関わらず行グループの順にマージするので、結果は常に同じになる
+// nが1以下なら並列にしない
+func WithWorkers(n int) ReaderOption {
+	return func(r *Reader) {
+		r.workers = n
+	}
+}
+
+// tasks個のタスクをワーカーで並列に実行し、結果をタスクの順に返す
+// ワーカーが無ければr自身で順に実行する
+// 各タスクはタスク毎のReaderで実行し、サルベージ・読み取りの記録はタスク毎に取って、全てのタスクを終えてからタスクの順にマージする
+// いずれかのタスクが失敗すると残りのタスクは実行せず、失敗したタスクのうち最も前のもののエラーを返す
+func runTasks[T any](ctx context.Context, r *Reader, tasks int, fn func(ctx context.Context, r *Reader, task int) (T, error)) ([]T, error) {
+	results := make([]T, tasks)
+
+	if r.workers <= 1 || tasks <= 1 {
+		for i := range results {
+			var err error
+			if results[i], err = fn(ctx, r, i); err != nil {
+				return nil, err
+			}
+		}
+		return results, nil
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, tasks)
+	readers := make([]*Reader, tasks)
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(r.workers, tasks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range next {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				readers[i] = r.forTask()
+				if results[i], errs[i] = fn(ctx, readers[i], i); errs[i] != nil {
+					cancel()
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < tasks; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	// 他のタスクの失敗による取り消しより、タスク自身のエラーを優先する
+	var first error
+	for _, err := range errs {
+		if err != nil && (first == nil || (errors.Is(first, context.Canceled) && !errors.Is(err, context.Canceled))) {
+			first = err
+		}
+	}
+	if first == nil {
+		first = parent.Err()
+	}
+	if first != nil {
+		return nil, first
+	}
+
+	for _, task := range readers {
+		r.salvage.merge(task.salvage)
+		r.explain.merge(task.explain)
+	}
+
+	return results, nil
+}
+
+// サルベージ・読み取りの記録を別に取るReaderを返す
+// タスクの中から更にタスクを実行する場合は、同じワーカーで順に実行する
+func (r *Reader) forTask() *Reader {
+	task := *r
+	task.workers = 0
+	if r.salvage != nil {
+		task.salvage = &SalvageReport{SkippedPages: make([]*SkippedPage, 0)}
+	}
+	task.explain = r.explain.fork()
+
+	return &task
+}
@@ -1,8 +1,10 @@
 package internal
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/apache/thrift/lib/go/thrift"
 	"github.com/murakmii/retsu/thrift/parquet"
@@ -12,9 +14,22 @@ import (
 
 type (
 	// Parquetファイル
+	// ファイル内の位置を持たず、全ての読み取りはオフセットを指定して行うので、複数のgoroutineから同時に読み取れる
 	Parquet struct {
-		r     io.ReadSeeker // TProtocolだけではシーク等ができないので元の ReadSeeker も保持
-		proto thrift.TProtocol
+		r    io.ReaderAt
+		size int64
+
+		decryption *DecryptionConfig // 暗号化されたファイルを読み取る場合の復号設定
+		decryptor  *fileDecryptor    // ファイルが暗号化されている場合のみ、Inspect時に設定される
+	}
+
+	// ファイル内の位置を持ち、そこから順に読み取る
+	// Thrift構造体はサイズが分からないので、読み取った分だけ位置を進めながら読み取る必要がある
+	// goroutine間では共有せず、列チャンク等を読み取る度に作る
+	cursor struct {
+		par    *Parquet
+		offset int64
+		proto  thrift.TProtocol
 	}
 
 	ThriftStruct interface {
@@ -22,49 +37,161 @@ type (
 	}
 )
 
-func NewParquet(r io.ReadSeeker) *Parquet {
-	return &Parquet{
-		r: r,
-		proto: thrift.NewTCompactProtocolConf(
-			&thrift.StreamTransport{Reader: r},
-			nil,
-		),
-	}
+var (
+	magic          = []byte("PAR1")
+	encryptedMagic = []byte("PARE") // フッターが暗号化されている場合のマジックナンバー
+)
+
+const (
+	// 先頭のマジックナンバー、フッター長、末尾のマジックナンバーの合計
+	minFileSize = 12
+
+	// 辞書ページのヘッダの最大サイズとして見込むバイト数
+	maxDictPageHeaderSize = 100
+)
+
+// sizeはファイルサイズ
+// Inspect以降、Parquetは読み取り専用なので複数のgoroutineから同時に使ってよい
+func NewParquet(r io.ReaderAt, size int64) *Parquet {
+	return &Parquet{r: r, size: size}
+}
+
+// 暗号化されたParquetファイルを、与えられた設定で復号しながら読み取る
+func NewEncryptedParquet(r io.ReaderAt, size int64, config *DecryptionConfig) *Parquet {
+	par := NewParquet(r, size)
+	par.decryption = config
+	return par
 }
 
 // Parquetファイルを解析し、スキーマ等のメタデータを返す
 func (par *Parquet) Inspect(ctx context.Context) (*MetaData, error) {
-	// ファイル末尾から8バイト戻った位置にある、フッター長を取得する
-	if _, err := par.r.Seek(-8, io.SeekEnd); err != nil {
-		return nil, fmt.Errorf("failed to seek to footer length: %w", err)
+	size := par.size
+
+	// 先頭と末尾のマジックナンバー、フッター長の分すら無いなら、途中で切り詰められている等でParquetファイルではない
+	if size < minFileSize {
+		return nil, fmt.Errorf("file is too small to be parquet file(size: %d)", size)
 	}
 
-	footerLen := make([]byte, 4)
-	if _, err := io.ReadFull(par.r, footerLen); err != nil {
+	// ファイル末尾の8バイトは、フッター長とマジックナンバー
+	tail, err := par.readRange(size-8, 8)
+	if err != nil {
 		return nil, fmt.Errorf("failed to read footer length: %w", err)
 	}
 
-	// フッター、フッター長、マジックナンバー分だけ末尾から先頭、つまりフッターの先頭にシークする
-	if _, err := par.r.Seek(-int64(binary.LittleEndian.Uint32(footerLen))-8, io.SeekEnd); err != nil {
-		return nil, fmt.Errorf("failed to seek to footer: %w", err)
+	tailMagic := tail[4:]
+	if !bytes.Equal(tailMagic, magic) && !bytes.Equal(tailMagic, encryptedMagic) {
+		return nil, fmt.Errorf("invalid magic number at end of file: %q", tailMagic)
+	}
+
+	// フッター、フッター長、マジックナンバー分だけ末尾から先頭、つまりフッターの先頭から読み取る
+	footerLen := int64(binary.LittleEndian.Uint32(tail))
+	if footerLen > size-minFileSize {
+		return nil, fmt.Errorf("footer length(%d) exceeds file size(%d)", footerLen, size)
+	}
+
+	data, err := par.readRange(size-8-footerLen, footerLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read footer: %w", err)
 	}
 
 	// フッターを読み取り、専用の構造体に変換していく
-	footer := &parquet.FileMetaData{}
-	if err := par.ReadThrift(ctx, footer); err != nil {
+	var footer *parquet.FileMetaData
+	if bytes.Equal(tailMagic, encryptedMagic) {
+		footer, err = par.readEncryptedFooter(ctx, data)
+	} else {
+		footer, err = par.readPlaintextFooter(ctx, data)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to read footer: %w", err)
 	}
 
-	return par.inspectFooter(ctx, footer)
+	return par.inspectFooter(ctx, footer, size-8-footerLen)
+}
+
+// 暗号化されたフッターの読み取り
+// フッターは、平文のFileCryptoMetaDataと暗号化されたFileMetaDataで構成される
+func (par *Parquet) readEncryptedFooter(ctx context.Context, data []byte) (*parquet.FileMetaData, error) {
+	if par.decryption == nil {
+		return nil, errors.New("footer is encrypted, but decryption config is not given")
+	}
+
+	cryptoMeta := &parquet.FileCryptoMetaData{}
+	encrypted, err := readThriftBytes(ctx, data, cryptoMeta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read crypto metadata: %w", err)
+	}
+
+	dec, err := newFileDecryptor(par.decryption, cryptoMeta.EncryptionAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := dec.footerKey(cryptoMeta.KeyMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := dec.decryptFooter(key, encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt footer: %w", err)
+	}
+
+	footer := &parquet.FileMetaData{}
+	if _, err := readThriftBytes(ctx, plain, footer); err != nil {
+		return nil, err
+	}
+
+	dec.footerKeyMetadata = cryptoMeta.KeyMetadata
+	par.decryptor = dec
+	return footer, nil
+}
+
+// 平文のフッターの読み取り
+// 列が暗号化されている場合(平文フッターモード)は、フッターの後ろに続く署名を検証する
+func (par *Parquet) readPlaintextFooter(ctx context.Context, data []byte) (*parquet.FileMetaData, error) {
+	footer := &parquet.FileMetaData{}
+	signature, err := readThriftBytes(ctx, data, footer)
+	if err != nil {
+		return nil, err
+	}
+
+	if !footer.IsSetEncryptionAlgorithm() {
+		return footer, nil
+	}
+
+	dec, err := newFileDecryptor(par.decryption, footer.EncryptionAlgorithm)
+	if err != nil {
+		// 復号設定が無くても平文の列は読み取れるので、設定が無い場合はエラーにしない
+		if par.decryption == nil {
+			return footer, nil
+		}
+		return nil, err
+	}
+
+	// 署名の検証にはフッターの鍵が必要なので、鍵が無い場合は検証しない
+	if key, err := dec.footerKey(footer.FooterSigningKeyMetadata); err == nil {
+		if err := dec.verifyFooterSignature(key, data[:len(data)-len(signature)], signature); err != nil {
+			return nil, err
+		}
+	}
+
+	dec.footerKeyMetadata = footer.FooterSigningKeyMetadata
+	par.decryptor = dec
+	return footer, nil
 }
 
 // フッターからのメタデータの取得
-func (par *Parquet) inspectFooter(ctx context.Context, footer *parquet.FileMetaData) (*MetaData, error) {
+// dataEndは列チャンクを置くことができる領域の末尾(フッターの先頭)
+func (par *Parquet) inspectFooter(ctx context.Context, footer *parquet.FileMetaData, dataEnd int64) (*MetaData, error) {
 	metaData := &MetaData{
 		TotalRows: footer.NumRows,
 		RowGroups: make([]*RowGroup, len(footer.RowGroups)),
+		CreatedBy: ParseCreatedBy(footer.CreatedBy),
 	}
-	metaData.SchemaTree, _ = inspectSchema(footer.Schema, 0) // スキーマ情報を変換
+	metaData.KnownDefects = metaData.CreatedBy.defects()
+	metaData.SchemaTree, _ = inspectSchema(footer.Schema, nil, &metaData.Leaves) // スキーマ情報を変換
+	metaData.schemaElements = footer.Schema
+	metaData.columnOrders = footer.ColumnOrders
 
 	// 行グループ毎に変換
 	for i := 0; i < len(footer.RowGroups); i++ {
@@ -73,41 +200,188 @@ func (par *Parquet) inspectFooter(ctx context.Context, footer *parquet.FileMetaD
 			Columns: make([]*ColumnChunk, len(footer.RowGroups[i].Columns)),
 		}
 
+		// 暗号化時のAADには、行グループの序数が用いられる
+		rowGroupOrdinal := int16(i)
+		if footer.RowGroups[i].IsSetOrdinal() {
+			rowGroupOrdinal = footer.RowGroups[i].GetOrdinal()
+		}
+
 		// 列チャンク毎に変換
 		for j := 0; j < len(footer.RowGroups[i].Columns); j++ {
-			col := footer.RowGroups[i].Columns[j]
-
-			metaData.RowGroups[i].Columns[j] = &ColumnChunk{
-				Path:                  strings.Join(col.MetaData.PathInSchema, "."),
-				Codec:                 col.MetaData.Codec,
-				NumValues:             col.MetaData.NumValues,
-				TotalUncompressedSize: col.MetaData.TotalUncompressedSize,
-				TotalCompressedSize:   col.MetaData.TotalCompressedSize,
-				DataPageOffset:        col.MetaData.DataPageOffset,
-				DictPageOffset:        col.MetaData.DictionaryPageOffset,
+			col, err := par.inspectColumnChunk(ctx, metaData, footer.RowGroups[i].Columns[j], rowGroupOrdinal, int16(j))
+			if err != nil {
+				return nil, fmt.Errorf("failed to inspect column chunk %d of row group %d: %w", j, i, err)
 			}
+
+			// メタデータを復号できなかった列チャンクについても、型はスキーマから補っておく
+			if col.Encrypted && col.decryptor == nil {
+				if schema := metaData.FindSchema(col.Path); schema != nil && schema.IsLeaf() {
+					col.Type = *schema.Type
+				}
+			}
+
+			// 辞書ページのオフセットが不正な値であるか、オフセットを書き込まない可能性があるライターの場合は、
+			// データページのオフセットに辞書ページが置かれているかもしれないので、ページヘッダの種類で判定する
+			if !col.HasDict() {
+				col.sniffDict = col.DictPageOffset != nil || metaData.CreatedBy == nil || metaData.hasDefect(defectDictPageOffsetUnset)
+			}
+
+			// PARQUET-816: 列チャンクのサイズに辞書ページのヘッダのサイズが含まれていない
+			// ヘッダのサイズは分からないので、十分な大きさを末尾に見込み、値の数を読み取った時点で列チャンクの終わりとする
+			if metaData.hasDefect(defectDictPageHeaderSize) && !col.Encrypted {
+				col.tailPadding = max(0, min(maxDictPageHeaderSize, dataEnd-col.PageTailOffset()))
+			}
+
+			metaData.RowGroups[i].Columns[j] = col
 		}
 	}
 
 	return metaData, nil
 }
 
+// 列チャンクのメタデータの変換
+// 列が暗号化されている場合は列の鍵を解決し、必要であれば暗号化されたメタデータを復号する
+func (par *Parquet) inspectColumnChunk(
+	ctx context.Context,
+	metaData *MetaData,
+	chunk *parquet.ColumnChunk,
+	rowGroupOrdinal int16,
+	columnOrdinal int16,
+) (*ColumnChunk, error) {
+	meta := chunk.MetaData
+	var dec *columnDecryptor
+
+	if chunk.IsSetCryptoMetadata() && par.decryptor != nil {
+		var key []byte
+		var err error
+
+		if chunk.CryptoMetadata.IsSetENCRYPTION_WITH_FOOTER_KEY() {
+			key, err = par.decryptor.footerKey(par.decryptor.footerKeyMetadata)
+		} else {
+			withColumnKey := chunk.CryptoMetadata.ENCRYPTION_WITH_COLUMN_KEY
+			key, err = par.decryptor.columnKey(strings.Join(withColumnKey.PathInSchema, "."), withColumnKey.KeyMetadata)
+		}
+
+		// 鍵が得られない列は読み取れないが、他の列は読み取れるのでエラーにはしない
+		if err == nil {
+			dec = &columnDecryptor{file: par.decryptor, key: key, rowGroup: rowGroupOrdinal, column: columnOrdinal}
+		}
+	}
+
+	// 列の鍵で暗号化されたメタデータは、鍵があれば復号して用いる
+	if dec != nil && chunk.IsSetEncryptedColumnMetadata() {
+		plain, err := dec.decrypt(moduleColumnMetaData, -1, chunk.EncryptedColumnMetadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt column metadata: %w", err)
+		}
+
+		meta = &parquet.ColumnMetaData{}
+		if _, err := readThriftBytes(ctx, plain, meta); err != nil {
+			return nil, fmt.Errorf("failed to read column metadata: %w", err)
+		}
+	}
+
+	// メタデータが暗号化されていて読み取れない場合は、パスのみを持つ列チャンクとする
+	if meta == nil {
+		if !chunk.IsSetCryptoMetadata() || !chunk.CryptoMetadata.IsSetENCRYPTION_WITH_COLUMN_KEY() {
+			return nil, errors.New("column metadata is missing")
+		}
+
+		return &ColumnChunk{
+			Path:            strings.Join(chunk.CryptoMetadata.ENCRYPTION_WITH_COLUMN_KEY.PathInSchema, "."),
+			Encrypted:       true,
+			RowGroupOrdinal: rowGroupOrdinal,
+			ColumnOrdinal:   columnOrdinal,
+		}, nil
+	}
+
+	path := strings.Join(meta.PathInSchema, ".")
+
+	return &ColumnChunk{
+		Path:                  path,
+		Type:                  meta.Type,
+		Codec:                 meta.Codec,
+		Encodings:             meta.Encodings,
+		NumValues:             meta.NumValues,
+		TotalUncompressedSize: meta.TotalUncompressedSize,
+		TotalCompressedSize:   meta.TotalCompressedSize,
+		DataPageOffset:        meta.DataPageOffset,
+		DictPageOffset:        meta.DictionaryPageOffset,
+		BloomFilterOffset:     meta.BloomFilterOffset,
+		BloomFilterLength:     meta.BloomFilterLength,
+		ColumnIndexOffset:     chunk.ColumnIndexOffset,
+		ColumnIndexLength:     chunk.ColumnIndexLength,
+		OffsetIndexOffset:     chunk.OffsetIndexOffset,
+		OffsetIndexLength:     chunk.OffsetIndexLength,
+		Statistics:            metaData.convertStatistics(path, meta.Statistics),
+		SizeStatistics:        convertSizeStatistics(meta.SizeStatistics),
+		Encrypted:             chunk.IsSetCryptoMetadata(),
+		RowGroupOrdinal:       rowGroupOrdinal,
+		ColumnOrdinal:         columnOrdinal,
+		decryptor:             dec,
+		encodingStats:         meta.EncodingStats,
+	}, nil
+}
+
+func convertSizeStatistics(stats *parquet.SizeStatistics) *SizeStatistics {
+	if stats == nil {
+		return nil
+	}
+
+	return &SizeStatistics{
+		UnencodedByteArrayDataBytes: stats.UnencodedByteArrayDataBytes,
+		RepetitionLevelHistogram:    stats.RepetitionLevelHistogram,
+		DefinitionLevelHistogram:    stats.DefinitionLevelHistogram,
+	}
+}
+
 // スキーマ情報の変換
 // リストに均された一連のスキーマ用構造体から、木構造のスキーマを復元して返す
 // 戻り値として、木構造に復元されたスキーマの親又は根となる単一の構造体と、
 // 木構造に復元されていない残りのリストを返す
-func inspectSchema(elements []*parquet.SchemaElement, depth int) (*Schema, []*parquet.SchemaElement) {
+// また、木構造の葉をスキーマ内での順序を保ったままleavesに追加していく
+func inspectSchema(elements []*parquet.SchemaElement, parent *Schema, leaves *[]*Schema) (*Schema, []*parquet.SchemaElement) {
 	// リストの先頭を木構造のノードとしてSchema構造体に
 	s := &Schema{
 		Name:           elements[0].Name,
 		Type:           elements[0].Type,
 		TypeLength:     elements[0].TypeLength,
+		ConvertedType:  elements[0].ConvertedType,
+		LogicalType:    elements[0].LogicalType,
+		Scale:          elements[0].Scale,
+		Precision:      elements[0].Precision,
 		RepetitionType: elements[0].RepetitionType,
-		Depth:          depth,
+	}
+
+	// 論理型のDECIMALがあれば、そのスケールと精度を優先する
+	if s.LogicalType != nil && s.LogicalType.IsSetDECIMAL() {
+		s.Scale = &s.LogicalType.DECIMAL.Scale
+		s.Precision = &s.LogicalType.DECIMAL.Precision
+	}
+
+	// 最大定義レベルは根からのREQUIREDでないノードの数、最大繰り返しレベルはREPEATEDなノードの数
+	// 根自体はレベルに影響しない
+	if parent != nil {
+		s.Path = s.Name
+		if parent.Path != "" {
+			s.Path = parent.Path + "." + s.Name
+		}
+
+		s.Depth = parent.Depth + 1
+		s.MaxDefinitionLevel = parent.MaxDefinitionLevel
+		s.MaxRepetitionLevel = parent.MaxRepetitionLevel
+
+		if s.RepetitionType != nil && *s.RepetitionType != parquet.FieldRepetitionType_REQUIRED {
+			s.MaxDefinitionLevel++
+		}
+		if s.RepetitionType != nil && *s.RepetitionType == parquet.FieldRepetitionType_REPEATED {
+			s.MaxRepetitionLevel++
+		}
 	}
 
 	// num_childrenが無いなら木構造の葉なので子については考えず、リストの先頭以外を未処理として返す
 	if !elements[0].IsSetNumChildren() {
+		*leaves = append(*leaves, s)
 		return s, elements[1:]
 	}
 
@@ -120,39 +394,144 @@ func inspectSchema(elements []*parquet.SchemaElement, depth int) (*Schema, []*pa
 	for i := int32(0); i < numChildren; i++ {
 		// 再帰的に処理した際、リストの要素のうちいくつが処理されるかは呼び出し時点では分からないので、
 		// 二番目の戻り値でリストを更新する
-		child, elements = inspectSchema(elements, depth+1)
+		child, elements = inspectSchema(elements, s, leaves)
 		s.Children[child.Name] = child
 	}
 
 	return s, elements
 }
 
-func (par *Parquet) Seek(offset int64) error {
-	if _, err := par.r.Seek(offset, io.SeekStart); err != nil {
-		return fmt.Errorf("failed to seek parquet file(offset: %d): %w)", offset, err)
+// ファイルサイズを返す
+func (par *Parquet) Size() int64 {
+	return par.size
+}
+
+// 指定したオフセットからsizeバイトを読み取る
+func (par *Parquet) readRange(offset int64, size int64) ([]byte, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("invalid size to read parquet file(offset: %d, size: %d)", offset, size)
+	}
+
+	buf := make([]byte, size)
+	// ReaderAtは、要求した分を読み取れた場合でもファイル末尾ではio.EOFを返し得る
+	if n, err := par.r.ReadAt(buf, offset); n < len(buf) {
+		return nil, fmt.Errorf("failed to read parquet file(offset: %d, size: %d): %w", offset, size, err)
 	}
 
+	return buf, nil
+}
+
+// 指定したオフセットから順に読み取るcursorを返す
+func (par *Parquet) cursorAt(offset int64) *cursor {
+	cur := &cursor{par: par, offset: offset}
+	cur.proto = thrift.NewTCompactProtocolConf(&thrift.StreamTransport{Reader: cur}, nil)
+	return cur
+}
+
+// io.Reader として、現在の位置から読み取って位置を進める
+func (cur *cursor) Read(p []byte) (int, error) {
+	n, err := cur.par.r.ReadAt(p, cur.offset)
+	cur.offset += int64(n)
+
+	// ReaderAtは要求より少なく読み取った場合に必ずエラーを返すが、Readerとしては読み取れた分を先に返す
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (cur *cursor) seek(offset int64) {
+	cur.offset = offset
+}
+
+func (cur *cursor) read(size int64) ([]byte, error) {
+	buf, err := cur.par.readRange(cur.offset, size)
+	if err != nil {
+		return nil, err
+	}
+
+	cur.offset += size
+	return buf, nil
+}
+
+func (cur *cursor) readThrift(ctx context.Context, t ThriftStruct) error {
+	return t.Read(ctx, cur.proto)
+}
+
+// 列チャンク内のモジュールをThrift構造体として読み取る
+// 列チャンクが暗号化されている場合は、復号してから読み取る
+func (cur *cursor) readColumnThrift(ctx context.Context, col *ColumnChunk, module moduleType, page int16, t ThriftStruct) error {
+	if !col.Encrypted {
+		return cur.readThrift(ctx, t)
+	}
+
+	plain, err := cur.readColumnModule(col, module, page)
+	if err != nil {
+		return err
+	}
+
+	_, err = readThriftBytes(ctx, plain, t)
+	return err
+}
+
+// 列チャンク内のモジュールをバイト列として読み取る
+// 列チャンクが暗号化されている場合は、復号してから返す(この場合、sizeはモジュール自身が持つ長さが優先される)
+func (cur *cursor) readColumnBytes(col *ColumnChunk, module moduleType, page int16, size int64) ([]byte, error) {
+	if !col.Encrypted {
+		return cur.read(size)
+	}
+
+	return cur.readColumnModule(col, module, page)
+}
+
+// 列チャンク内のモジュールを読まずに飛ばす
+// 列チャンクが暗号化されている場合は、モジュール自身が持つ長さだけ飛ばす
+func (cur *cursor) skipColumnBytes(col *ColumnChunk, size int64) error {
+	if col.Encrypted {
+		length, err := cur.read(4)
+		if err != nil {
+			return err
+		}
+		size = int64(binary.LittleEndian.Uint32(length))
+		if limit := cur.moduleLimit(col, moduleDataPage); size > limit {
+			return fmt.Errorf("encrypted module length exceeds its bounds(length: %d, limit: %d)", size+4, limit+4)
+		}
+	}
+
+	cur.offset += size
 	return nil
 }
 
-func (par *Parquet) CurrentOffset() (int64, error) {
-	offset, err := par.r.Seek(0, io.SeekCurrent)
+func (cur *cursor) readColumnModule(col *ColumnChunk, module moduleType, page int16) ([]byte, error) {
+	if col.decryptor == nil {
+		return nil, fmt.Errorf("'%s' column is encrypted, but its key is not given", col.Path)
+	}
+
+	encrypted, err := readModule(cur, cur.moduleLimit(col, module))
 	if err != nil {
-		return -1, fmt.Errorf("failed to get current offset of parquet file: %w)", err)
+		return nil, err
 	}
 
-	return offset, nil
+	return col.decryptor.decrypt(module, page, encrypted)
 }
 
-func (par *Parquet) ReadThrift(ctx context.Context, t ThriftStruct) error {
-	return t.Read(ctx, par.proto)
+// 現在の位置から読み取る暗号化モジュールの最大のバイト数
+// ページ及びページヘッダーは列チャンクの範囲、それ以外はファイルの範囲に収まらなければならない
+func (cur *cursor) moduleLimit(col *ColumnChunk, module moduleType) int64 {
+	switch module {
+	case moduleDataPage, moduleDictionaryPage, moduleDataPageHeader, moduleDictionaryPageHeader:
+		return col.PageTailOffset() - cur.offset
+	default:
+		return cur.par.size - cur.offset
+	}
 }
 
-func (par *Parquet) Read(size int64) ([]byte, error) {
-	buf := make([]byte, size)
-	if _, err := io.ReadFull(par.r, buf); err != nil {
-		return nil, fmt.Errorf("failed to read parquet file(size: %d): %w)", size, err)
+// メモリ上のバイト列からThrift構造体を読み取り、読み取られなかった残りのバイト列を返す
+func readThriftBytes(ctx context.Context, data []byte, t ThriftStruct) ([]byte, error) {
+	buf := &thrift.TMemoryBuffer{Buffer: bytes.NewBuffer(data)}
+	if err := t.Read(ctx, thrift.NewTCompactProtocolConf(buf, nil)); err != nil {
+		return nil, err
 	}
 
-	return buf, nil
+	return data[len(data)-buf.Len():], nil
 }
@@ -0,0 +1,401 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+type (
+	// 複数の列を行グループ毎にまとめて読み取り、行単位に揃えて返す
+	Projection struct {
+		reader  *Reader
+		columns []*projectedColumn
+	}
+
+	// 読み取った1行
+	Row struct {
+		Index  int64 // ファイル内での行の位置
+		Values []any // 列毎の値(Projection.Pathsと同じ順)
+
+		plain [][]byte // 列毎のPLAINエンコーディングした値(keepPlainの列のみ、nullはnil)
+	}
+
+	projectedColumn struct {
+		path   string
+		schema *Schema
+
+		// 繰り返しレベルk(1以上)のリストについて、
+		// listDefs[k]未満の定義レベルはリスト(又はその祖先)がnull、repDefs[k]未満の定義レベルは空のリストを表す
+		listDefs []int32
+		repDefs  []int32
+
+		keepPlain bool // 書式化した値に加えて、PLAINエンコーディングした値も保持する(繰り返しの無い列のみ)
+	}
+
+	// 読み取る行グループ(読み取る範囲の先頭からの位置)と列の組み合わせ
+	projectionTask struct {
+		rowGroup int
+		column   int
+	}
+
+	// 行グループ内の1列分の、行毎に組み立てた値
+	columnRows struct {
+		values []any
+		plain  [][]byte // keepPlainの場合の、行毎のPLAINエンコーディングした値
+		read   bitset   // 値を読み取れた行(サルベージモードで読み飛ばしたページの行は含まない)
+	}
+)
+
+// 読み取る列を指定して、行単位で読み取る準備をする
+// 繰り返しのある列の値は、最大繰り返しレベルの深さまで入れ子にした[]anyになる
+func (r *Reader) Project(paths []string) (*Projection, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no columns to read")
+	}
+
+	p := &Projection{reader: r, columns: make([]*projectedColumn, len(paths))}
+	for i, path := range paths {
+		col, err := newProjectedColumn(r.meta, path)
+		if err != nil {
+			return nil, err
+		}
+		p.columns[i] = col
+	}
+
+	return p, nil
+}
+
+// 列のパスから根までのスキーマを辿り、繰り返しレベル毎のリストの定義レベルを求める
+func newProjectedColumn(meta *MetaData, path string) (*projectedColumn, error) {
+	schema := meta.FindSchema(path)
+	if schema == nil || !schema.IsLeaf() {
+		return nil, fmt.Errorf("'%s' column does not exist", path)
+	}
+
+	col := &projectedColumn{path: path, schema: schema, listDefs: []int32{0}, repDefs: []int32{0}}
+	node, def := meta.SchemaTree, int32(0)
+
+	for _, name := range strings.Split(path, ".") {
+		node = node.Children[name]
+		if node.RepetitionType == nil {
+			continue
+		}
+
+		switch *node.RepetitionType {
+		case parquet.FieldRepetitionType_OPTIONAL:
+			def++
+		case parquet.FieldRepetitionType_REPEATED:
+			col.listDefs = append(col.listDefs, def)
+			def++
+			col.repDefs = append(col.repDefs, def)
+		}
+	}
+
+	return col, nil
+}
+
+// 読み取る列のパス
+func (p *Projection) Paths() []string {
+	paths := make([]string, len(p.columns))
+	for i, col := range p.columns {
+		paths[i] = col.path
+	}
+
+	return paths
+}
+
+// 行を先頭から順にfnに渡す
+// fnがエラーを返すと、読み取りを中断してそのエラーを返す
+func (p *Projection) Scan(ctx context.Context, fn func(*Row) error) error {
+	return p.scanRowGroups(ctx, func(rows []*Row) error {
+		for _, row := range rows {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 行をsize行ずつ(最後のバッチのみsize行未満になり得る)fnに渡す
+// バッチは行グループをまたぎ得る
+func (p *Projection) ScanBatches(ctx context.Context, size int, fn func([]*Row) error) error {
+	if size <= 0 {
+		return fmt.Errorf("batch size must be positive, but got %d", size)
+	}
+
+	batch := make([]*Row, 0, size)
+	err := p.scanRowGroups(ctx, func(rows []*Row) error {
+		for _, row := range rows {
+			batch = append(batch, row)
+			if len(batch) == size {
+				if err := fn(batch); err != nil {
+					return err
+				}
+				batch = make([]*Row, 0, size)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+// 行グループ毎に全ての列を読み取り、揃えた行をfnに渡す
+// 条件式(WithFilter)がある場合、条件式を満たす行のみを渡す
+// サルベージモードでは、いずれかの列で値を読み取れなかった行は渡さない
+// ワーカーがあれば、ワーカーの数ずつの行グループをまとめて読み取る
+func (p *Projection) scanRowGroups(ctx context.Context, fn func([]*Row) error) error {
+	rowGroups := p.reader.meta.RowGroups
+	window := max(p.reader.workers, 1)
+
+	var offset int64 // 行グループの先頭の、ファイル内での行の位置
+	for first := 0; first < len(rowGroups); first += window {
+		last := min(first+window, len(rowGroups))
+
+		batches, err := p.readRowGroups(ctx, first, last, offset)
+		if err != nil {
+			return err
+		}
+
+		for i, rows := range batches {
+			if len(rows) > 0 {
+				if err := fn(rows); err != nil {
+					return err
+				}
+			}
+
+			offset += rowGroups[first+i].NumRows
+		}
+	}
+
+	return nil
+}
+
+// [first, last)の行グループを読み取り、行グループ毎に揃えた行を返す
+// 行の選択は行グループ毎に、列の読み取りは列チャンク毎にタスクとして並列に行う
+func (p *Projection) readRowGroups(ctx context.Context, first int, last int, offset int64) ([][]*Row, error) {
+	r := p.reader
+	skipped := make([]bool, last-first) // 条件式を満たす行が無い行グループ
+
+	sels, err := runTasks(ctx, r, last-first, func(ctx context.Context, r *Reader, i int) (*rowSelection, error) {
+		ranges, err := r.RowRanges(ctx, first+i)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(ranges) == 0 {
+			skipped[i] = true
+			return nil, nil
+		}
+
+		sel, err := r.selectRows(ctx, first+i, ranges)
+		skipped[i] = sel != nil && sel.count() == 0
+		return sel, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []projectionTask
+	for i := range sels {
+		for j := range p.columns {
+			if !skipped[i] {
+				tasks = append(tasks, projectionTask{rowGroup: i, column: j})
+			}
+		}
+	}
+
+	read, err := runTasks(ctx, r, len(tasks), func(ctx context.Context, r *Reader, t int) (*columnRows, error) {
+		task := tasks[t]
+		row := r.meta.RowGroups[first+task.rowGroup]
+		pc := p.columns[task.column]
+
+		col := findColumn(row, pc.path)
+		if col == nil {
+			return nil, fmt.Errorf("'%s' column does not exist in row group", pc.path)
+		}
+
+		return r.readColumnRows(ctx, col, pc, row.NumRows, sels[task.rowGroup])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// タスクは行グループ毎に列の順に並んでいる
+	batches := make([][]*Row, last-first)
+	next := 0
+	for i := range batches {
+		row := r.meta.RowGroups[first+i]
+		if !skipped[i] {
+			batches[i] = p.stitch(row, offset, sels[i], read[next:next+len(p.columns)])
+			next += len(p.columns)
+		}
+		offset += row.NumRows
+	}
+
+	return batches, nil
+}
+
+// 列毎に読み取った値を、行毎に揃える
+func (p *Projection) stitch(row *RowGroup, offset int64, sel *rowSelection, columns []*columnRows) []*Row {
+	rows := make([]*Row, 0)
+	for index := int64(0); index < row.NumRows; index++ {
+		if sel != nil && !sel.has(index) {
+			continue
+		}
+
+		values := make([]any, len(columns))
+		var plain [][]byte
+		complete := true
+		for i, c := range columns {
+			if !c.read.has(int(index)) {
+				complete = false
+				break
+			}
+			values[i] = c.values[index]
+
+			if c.plain != nil {
+				if plain == nil {
+					plain = make([][]byte, len(columns))
+				}
+				plain[i] = c.plain[index]
+			}
+		}
+
+		if complete {
+			rows = append(rows, &Row{Index: offset + index, Values: values, plain: plain})
+		}
+	}
+
+	return rows
+}
+
+// 列チャンクを読み取り、繰り返しレベルが0の位置を行の先頭として値を行毎に組み立てる
+func (r *Reader) readColumnRows(ctx context.Context, col *ColumnChunk, pc *projectedColumn, numRows int64, sel *rowSelection) (*columnRows, error) {
+	rows := &columnRows{values: make([]any, numRows), read: newBitset(int(numRows))}
+	schema := pc.schema
+	maxRep := schema.MaxRepetitionLevel
+	if pc.keepPlain && maxRep == 0 {
+		rows.plain = make([][]byte, numRows)
+	}
+
+	// 組み立て中の行の、繰り返しレベル毎のリスト(lists[0]は使わない)
+	lists := make([]*[]any, maxRep+1)
+	current := int64(-1) // 組み立て中の行(読み取らない行なら-1)
+
+	err := r.scanColumnChunk(ctx, col, schema, scanOptions{sel: sel}, func(page *dataPage) error {
+		row, next := page.firstRow-1, 0
+
+		for i := 0; i < page.numValues; i++ {
+			rep, def := int32(0), page.maxDef
+			if page.repLevels != nil {
+				rep = page.repLevels[i]
+			}
+			if page.defLevels != nil {
+				def = page.defLevels[i]
+			}
+
+			var value any
+			var plain []byte
+			if def == page.maxDef {
+				plain = page.values.plain(next)
+				value = formatPlainValue(schema, plain)
+				next++
+			}
+
+			if rep == 0 {
+				row++
+				if current >= 0 {
+					rows.values[current] = unwrapLists(rows.values[current])
+				}
+
+				current = -1
+				if (sel == nil || sel.has(row)) && row < numRows {
+					current = row
+					rows.read.set(int(row))
+				}
+			}
+
+			if current < 0 || (rep > 0 && lists[rep] == nil) {
+				// 読み取らない行か、nullや空のリストに続く値(不正なレベル)
+				continue
+			}
+
+			if rows.plain != nil && plain != nil {
+				// 値はページのバッファを参照しているので、コピーして保持する
+				rows.plain[current] = bytes.Clone(plain)
+			}
+
+			pc.assemble(rows.values, current, lists, rep, def, value)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", pc.path, err)
+	}
+
+	if current >= 0 {
+		rows.values[current] = unwrapLists(rows.values[current])
+	}
+
+	return rows, nil
+}
+
+// 繰り返しレベルrep・定義レベルdefの値を、組み立て中の行に加える
+// repのリストに要素を1つ加え、それより深いリストは新たに作る
+// 定義レベルが途中のリストで止まっている場合は、そのリストをnullか空のリストとして終える
+func (pc *projectedColumn) assemble(values []any, row int64, lists []*[]any, rep int32, def int32, value any) {
+	maxRep := int32(len(lists) - 1)
+
+	put := func(level int32, v any) {
+		if level == 0 {
+			values[row] = v
+		} else {
+			*lists[level] = append(*lists[level], v)
+		}
+	}
+
+	for level := rep + 1; level <= maxRep; level++ {
+		if def < pc.repDefs[level] {
+			if def < pc.listDefs[level] {
+				put(level-1, nil)
+			} else {
+				put(level-1, []any{})
+			}
+
+			clear(lists[level:])
+			return
+		}
+
+		list := make([]any, 0)
+		put(level-1, &list)
+		lists[level] = &list
+	}
+
+	put(maxRep, value)
+}
+
+// 組み立て中に*[]anyで保持していたリストを[]anyに置き換える
+func unwrapLists(v any) any {
+	list, ok := v.(*[]any)
+	if !ok {
+		return v
+	}
+
+	for i, e := range *list {
+		(*list)[i] = unwrapLists(e)
+	}
+	return *list
+}
@@ -0,0 +1,524 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type (
+	// ParseQueryで解析したSELECT文
+	Query struct {
+		Select  []*SelectItem
+		Where   Expr // WHERE句が無ければnil
+		GroupBy []string
+		OrderBy []*OrderItem
+		Limit   int64 // LIMIT句が無ければ-1
+		Explain bool  // 先頭にEXPLAINを付けた(読み取りの記録を求める)
+	}
+
+	// SELECT句の項目
+	SelectItem struct {
+		Path  string        // 列のパス(*なら"*"、count(*)なら空)
+		Func  AggregateFunc // 集計でなければ0
+		Alias string
+	}
+
+	// ORDER BY句の項目
+	OrderItem struct {
+		Key      string // 結果の列の名前又は列のパス(Positionを指定した場合は空)
+		Position int    // 1から始まる結果の列の位置
+		Desc     bool
+	}
+
+	// SELECT文の結果
+	// 値は論理型に従って変換した値、集計は値の数ならint64、それ以外は*Number(値が無ければnil)
+	QueryResult struct {
+		Columns []string `json:"columns"`
+		Rows    [][]any  `json:"rows"`
+		Explain *Explain `json:"-"` // この問い合わせの読み取りの記録(WithExplainを指定していなければnil)
+	}
+
+	// ORDER BYの項目毎の、並べ替えに用いる結果の列と比較の方法
+	orderKey struct {
+		column     int
+		desc       bool
+		plain      bool        // 繰り返しの無い列の値なので、PLAINエンコーディングした値を列のソート順で比較する
+		comparator *Comparator // ソート順が定義されていない列ならnil(バイト列の順で比較する)
+	}
+)
+
+// 集計を含まない問い合わせで、LIMITの行数を読み取ったことを表す
+var errQueryLimit = errors.New("limit reached")
+
+// 結果の列の名前(別名が無ければcount(*)やsum(amount)等の表記、又は列のパス)
+func (item *SelectItem) Name() string {
+	switch {
+	case item.Alias != "":
+		return item.Alias
+	case item.Func != 0 && item.Path == "":
+		return "count(*)"
+	case item.Func != 0:
+		return fmt.Sprintf("%s(%s)", item.Func.Names()[0], item.Path)
+	default:
+		return item.Path
+	}
+}
+
+// SELECT文を実行する
+// WHERE句は条件式(WithFilter)と同様に、統計情報・ColumnIndex・辞書で読み飛ばせる行グループやページを除いてから行毎に判定する
+// Readerに条件式がある場合は、それとWHERE句の両方を満たす行のみを対象とする
+//
+// 集計もGROUP BYも無ければ選択した列のみを行単位で読み取り、ORDER BYが無ければLIMITの行数に達した時点で読み取りを終える
+// GROUP BYが無い集計は列毎にAggregateで求める(count・min・maxのみなら統計情報で済む行グループはページを読まない)
+// GROUP BYがあればGroupByで求める
+// 読み取りの記録は問い合わせ毎に取り、Readerの記録ではなくQueryResult.Explainに返す
+func (r *Reader) Query(ctx context.Context, q *Query) (*QueryResult, error) {
+	r, err := r.withFilter(q.Where)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := r.query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.explain != nil {
+		result.Explain = r.explain.summarize()
+	}
+	return result, nil
+}
+
+func (r *Reader) query(ctx context.Context, q *Query) (*QueryResult, error) {
+	aggregated := len(q.GroupBy) > 0
+	var items []*SelectItem
+	for _, item := range q.Select {
+		if item.Func != 0 {
+			aggregated = true
+		}
+
+		if item.Path != "*" || item.Func != 0 {
+			items = append(items, item)
+			continue
+		}
+
+		for _, leaf := range r.meta.Leaves {
+			items = append(items, &SelectItem{Path: leaf.Path})
+		}
+	}
+
+	if !aggregated {
+		return r.queryRows(ctx, q, items)
+	}
+
+	for _, item := range items {
+		if item.Func == 0 && !slices.Contains(q.GroupBy, item.Path) {
+			return nil, fmt.Errorf("'%s' must appear in GROUP BY or be used in an aggregate", item.Path)
+		}
+	}
+
+	var result *QueryResult
+	var plains [][][]byte
+	var err error
+	if len(q.GroupBy) == 0 {
+		result, err = r.queryAggregate(ctx, items)
+	} else {
+		result, plains, err = r.queryGroups(ctx, q.GroupBy, items)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := resolveOrder(items, q.OrderBy, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(items))
+	for i, item := range items {
+		if item.Func == 0 {
+			paths[i] = item.Path
+		}
+	}
+
+	sortQueryRows(result.Rows, plains, r.orderKeys(q.OrderBy, columns, paths))
+	if q.Limit >= 0 && int64(len(result.Rows)) > q.Limit {
+		result.Rows = result.Rows[:q.Limit]
+	}
+
+	return result, nil
+}
+
+// 選択した列(及びORDER BYのみに現れる列)を行単位で読み取る
+func (r *Reader) queryRows(ctx context.Context, q *Query, items []*SelectItem) (*QueryResult, error) {
+	result := &QueryResult{Columns: make([]string, len(items)), Rows: make([][]any, 0)}
+	paths := make([]string, len(items))
+	for i, item := range items {
+		result.Columns[i], paths[i] = item.Name(), item.Path
+	}
+
+	// 選択していない列による並べ替えは、その列も読み取ってから並べ替えた後に取り除く
+	columns, err := resolveOrder(items, q.OrderBy, func(path string) bool {
+		if schema := r.meta.FindSchema(path); schema != nil && schema.IsLeaf() {
+			paths = append(paths, path)
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Limit == 0 {
+		return result, nil
+	}
+
+	projection, err := r.Project(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := r.orderKeys(q.OrderBy, columns, paths)
+	for _, key := range keys {
+		if key.plain {
+			projection.columns[key.column].keepPlain = true
+		}
+	}
+
+	var plains [][][]byte
+	err = projection.Scan(ctx, func(row *Row) error {
+		result.Rows = append(result.Rows, row.Values)
+		plains = append(plains, row.plain)
+		if len(q.OrderBy) == 0 && int64(len(result.Rows)) == q.Limit {
+			return errQueryLimit
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errQueryLimit) {
+		return nil, err
+	}
+
+	sortQueryRows(result.Rows, plains, keys)
+	if q.Limit >= 0 && int64(len(result.Rows)) > q.Limit {
+		result.Rows = result.Rows[:q.Limit]
+	}
+
+	for i, row := range result.Rows {
+		result.Rows[i] = row[:len(items)]
+	}
+
+	return result, nil
+}
+
+// GROUP BYの無い集計を、列毎に1度ずつAggregateで求める
+func (r *Reader) queryAggregate(ctx context.Context, items []*SelectItem) (*QueryResult, error) {
+	paths, funcs := aggregatePaths(items)
+	results := make(map[string]*Aggregate, len(paths))
+
+	var rows int64
+	for _, path := range paths {
+		result, err := r.Aggregate(ctx, path, funcs[path])
+		if err != nil {
+			return nil, fmt.Errorf("failed to aggregate '%s': %w", path, err)
+		}
+
+		results[path], rows = result, result.Rows
+	}
+
+	if len(paths) == 0 {
+		var err error
+		if rows, err = r.countRows(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	row := make([]any, len(items))
+	for i, item := range items {
+		if item.Path == "" {
+			row[i] = rows
+		} else {
+			row[i] = aggregateValue(results[item.Path], item.Func)
+		}
+	}
+
+	return &QueryResult{Columns: selectNames(items), Rows: [][]any{row}}, nil
+}
+
+// GROUP BYのある集計を、GroupByで求める
+// 並べ替えのために、結果の行毎にキーの列のPLAINエンコーディングした値(それ以外の列はnil)も返す
+func (r *Reader) queryGroups(ctx context.Context, keys []string, items []*SelectItem) (*QueryResult, [][][]byte, error) {
+	paths, funcs := aggregatePaths(items)
+	aggs := make([]GroupAggregate, len(paths))
+	for i, path := range paths {
+		aggs[i] = GroupAggregate{Path: path, Funcs: funcs[path]}
+	}
+
+	grouped, err := r.GroupBy(ctx, keys, aggs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &QueryResult{Columns: selectNames(items), Rows: make([][]any, len(grouped.Groups))}
+	plains := make([][][]byte, len(grouped.Groups))
+	for i, g := range grouped.Groups {
+		row := make([]any, len(items))
+		plains[i] = make([][]byte, len(items))
+		for j, item := range items {
+			switch {
+			case item.Func == 0:
+				row[j] = g.Keys[slices.Index(keys, item.Path)]
+				plains[i][j] = g.keys[slices.Index(keys, item.Path)]
+			case item.Path == "":
+				row[j] = g.Rows
+			default:
+				row[j] = aggregateValue(g.Aggregates[slices.Index(paths, item.Path)], item.Func)
+			}
+		}
+		result.Rows[i] = row
+	}
+
+	return result, plains, nil
+}
+
+// 条件式を満たす行の数
+func (r *Reader) countRows(ctx context.Context) (int64, error) {
+	counts, err := runTasks(ctx, r, len(r.meta.RowGroups), func(ctx context.Context, r *Reader, i int) (int64, error) {
+		ranges, err := r.RowRanges(ctx, i)
+		if err != nil || len(ranges) == 0 {
+			return 0, err
+		}
+
+		sel, err := r.selectRows(ctx, i, ranges)
+		if err != nil {
+			return 0, err
+		}
+
+		if sel == nil {
+			return r.meta.RowGroups[i].NumRows, nil
+		}
+		return sel.count(), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var rows int64
+	for _, count := range counts {
+		rows += count
+	}
+
+	return rows, nil
+}
+
+// 集計する列のパス(現れた順)と、列毎に求める集計の組み合わせ
+func aggregatePaths(items []*SelectItem) ([]string, map[string]AggregateFunc) {
+	var paths []string
+	funcs := make(map[string]AggregateFunc)
+
+	for _, item := range items {
+		if item.Func == 0 || item.Path == "" {
+			continue
+		}
+
+		if _, ok := funcs[item.Path]; !ok {
+			paths = append(paths, item.Path)
+		}
+		funcs[item.Path] |= item.Func
+	}
+
+	return paths, funcs
+}
+
+func aggregateValue(result *Aggregate, fn AggregateFunc) any {
+	switch fn {
+	case AggregateCount:
+		return result.Count
+	case AggregateCountNull:
+		return result.CountNull
+	}
+
+	if n := result.number(fn); n != nil {
+		return n
+	}
+	return nil
+}
+
+func selectNames(items []*SelectItem) []string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.Name()
+	}
+
+	return names
+}
+
+// ORDER BYの項目毎に、並べ替えに用いる結果の列の位置を求める
+// 結果の列の名前、選択した列のパスの順に探し、見つからなければhiddenに渡して結果に無い列として追加できるか問い合わせる
+func resolveOrder(items []*SelectItem, order []*OrderItem, hidden func(path string) bool) ([]int, error) {
+	columns := make([]int, len(order))
+	extra := 0
+
+	for i, o := range order {
+		if o.Position > 0 {
+			if o.Position > len(items) {
+				return nil, fmt.Errorf("position %d of ORDER BY is out of range(1 to %d)", o.Position, len(items))
+			}
+			columns[i] = o.Position - 1
+			continue
+		}
+
+		columns[i] = -1
+		for j, item := range items {
+			if item.Name() == o.Key {
+				columns[i] = j
+				break
+			}
+		}
+
+		for j, item := range items {
+			if columns[i] < 0 && item.Func == 0 && item.Path == o.Key {
+				columns[i] = j
+			}
+		}
+
+		if columns[i] < 0 {
+			if hidden == nil || !hidden(o.Key) {
+				return nil, fmt.Errorf("'%s' in ORDER BY does not exist in result", o.Key)
+			}
+			columns[i] = len(items) + extra
+			extra++
+		}
+	}
+
+	return columns, nil
+}
+
+// ORDER BYの項目毎に、並べ替えに用いる結果の列と比較の方法を決める
+// pathsは結果の列毎の列のパス(集計値は空)で、繰り返しの無い列の値は書式化した値ではなくPLAINエンコーディングした値で比較する
+func (r *Reader) orderKeys(order []*OrderItem, columns []int, paths []string) []*orderKey {
+	keys := make([]*orderKey, len(order))
+	for i, o := range order {
+		key := &orderKey{column: columns[i], desc: o.Desc}
+		if path := paths[key.column]; path != "" {
+			if schema := r.meta.FindSchema(path); schema != nil && schema.IsLeaf() && !schema.HasRepetitionLevels() {
+				// INT96等のソート順が無い列は、バイト列の順にソートする
+				key.plain = true
+				key.comparator, _ = NewComparator(schema)
+			}
+		}
+		keys[i] = key
+	}
+
+	return keys
+}
+
+// 結果の行をORDER BYに従って並べ替える(並べ替えは安定で、nullは昇順・降順のいずれでも最後)
+// plainsは結果の行毎の、列のPLAINエンコーディングした値(PLAINエンコーディングした値で比較する列のみ)
+func sortQueryRows(rows [][]any, plains [][][]byte, keys []*orderKey) {
+	if len(keys) == 0 {
+		return
+	}
+
+	indices := make([]int, len(rows))
+	for i := range indices {
+		indices[i] = i
+	}
+
+	sort.SliceStable(indices, func(a, b int) bool {
+		a, b = indices[a], indices[b]
+		for _, key := range keys {
+			x, y := rows[a][key.column], rows[b][key.column]
+			switch {
+			case x == nil && y == nil:
+				continue
+			case x == nil:
+				return false
+			case y == nil:
+				return true
+			}
+
+			var c int
+			if key.plain {
+				c = comparePlainValues(key.comparator, plains[a][key.column], plains[b][key.column])
+			} else {
+				c = compareQueryValues(x, y)
+			}
+			if key.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	sorted := make([][]any, len(rows))
+	for i, index := range indices {
+		sorted[i] = rows[index]
+	}
+	copy(rows, sorted)
+}
+
+// nullでない結果の値を比較する
+// 種類の異なる値は、真偽値・数値・文字列・その他(リスト等)の順とする
+func compareQueryValues(a, b any) int {
+	ka, kb := queryValueKind(a), queryValueKind(b)
+	if ka != kb {
+		return ka - kb
+	}
+
+	switch ka {
+	case 0:
+		x, y := a.(bool), b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		default:
+			return 1
+		}
+
+	case 1:
+		return toNumber(a).compare(toNumber(b))
+
+	case 2:
+		return strings.Compare(a.(string), b.(string))
+
+	default:
+		x, _ := json.Marshal(a)
+		y, _ := json.Marshal(b)
+		return strings.Compare(string(x), string(y))
+	}
+}
+
+func queryValueKind(v any) int {
+	switch v.(type) {
+	case bool:
+		return 0
+	case int64, uint64, *Number:
+		return 1
+	case string:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func toNumber(v any) *Number {
+	switch v := v.(type) {
+	case int64:
+		return &Number{unscaled: big.NewInt(v)}
+	case uint64:
+		return &Number{unscaled: new(big.Int).SetUint64(v)}
+	default:
+		return v.(*Number)
+	}
+}
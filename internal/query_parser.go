@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+var queryKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "ORDER": true, "BY": true,
+	"ASC": true, "DESC": true, "LIMIT": true, "AS": true, "EXPLAIN": true,
+}
+
+func init() {
+	for keyword := range filterKeywords {
+		queryKeywords[keyword] = true
+	}
+}
+
+// SQLのSELECT文のサブセットを解析する
+//
+//	SELECT category, count(*), sum(amount) AS total
+//	FROM t
+//	WHERE price >= 100 AND name LIKE 'a%'
+//	GROUP BY category
+//	ORDER BY total DESC, 1
+//	LIMIT 10
+//
+// 読み取るファイルは別に指定するので、FROM句の表の名前は省略でき、指定しても無視する
+// 集計はcount(*)と、count・count_null・sum・min・max・avg・varianceに列のパスを指定したもの
+// ORDER BYには結果の列の名前(別名又はsum(amount)等の表記)、選択した列のパス、又は1から始まる結果の列の位置を指定する
+// WHERE句の表記はParseFilterと同じ
+// 先頭にEXPLAINを付けるとQuery.Explainがtrueになる(実行時に読み取りの記録を取るかどうかは呼び出し側で決める)
+func ParseQuery(s string) (*Query, error) {
+	tokens, err := tokenize(s, queryKeywords, "end of query")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	q := &Query{Limit: -1}
+	q.Explain = p.accept("EXPLAIN")
+
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		q.Select = append(q.Select, item)
+
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	if p.accept("FROM") {
+		if t := p.next(); t.kind != tokenIdent {
+			return nil, fmt.Errorf("expected table name, but got '%s' at %d", t.text, t.pos)
+		}
+	}
+
+	if p.accept("WHERE") {
+		if q.Where, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.accept("GROUP") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+
+		for {
+			t := p.next()
+			if t.kind != tokenIdent {
+				return nil, fmt.Errorf("expected column path, but got '%s' at %d", t.text, t.pos)
+			}
+			q.GroupBy = append(q.GroupBy, t.text)
+
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	if p.accept("ORDER") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+
+		for {
+			item, err := p.parseOrderItem()
+			if err != nil {
+				return nil, err
+			}
+			q.OrderBy = append(q.OrderBy, item)
+
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	if p.accept("LIMIT") {
+		t := p.next()
+		limit, ok := t.value.(int64)
+		if t.kind != tokenLiteral || !ok || limit < 0 {
+			return nil, fmt.Errorf("expected non-negative integer for LIMIT, but got '%s' at %d", t.text, t.pos)
+		}
+		q.Limit = limit
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected '%s' at %d", t.text, t.pos)
+	}
+
+	return q, nil
+}
+
+// *、列のパス、又は集計(count(*)等)に、ASで別名を付けたもの
+func (p *filterParser) parseSelectItem() (*SelectItem, error) {
+	if p.accept("*") {
+		return &SelectItem{Path: "*"}, nil
+	}
+
+	t := p.next()
+	if t.kind != tokenIdent {
+		return nil, fmt.Errorf("expected column path or aggregate, but got '%s' at %d", t.text, t.pos)
+	}
+
+	item := &SelectItem{Path: t.text}
+	if p.accept("(") {
+		fn, err := ParseAggregateFuncs(strings.ToLower(t.text))
+		if err != nil {
+			return nil, fmt.Errorf("unknown aggregate function '%s' at %d", t.text, t.pos)
+		}
+		item.Func = fn
+
+		arg := p.next()
+		switch {
+		case arg.kind == tokenSymbol && arg.text == "*" && fn == AggregateCount:
+			item.Path = ""
+		case arg.kind == tokenIdent:
+			item.Path = arg.text
+		default:
+			return nil, fmt.Errorf("expected column path, but got '%s' at %d", arg.text, arg.pos)
+		}
+
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.accept("AS") {
+		alias := p.next()
+		if alias.kind != tokenIdent {
+			return nil, fmt.Errorf("expected alias, but got '%s' at %d", alias.text, alias.pos)
+		}
+		item.Alias = alias.text
+	}
+
+	return item, nil
+}
+
+// 結果の列の名前又は位置に、ASC又はDESCを付けたもの
+func (p *filterParser) parseOrderItem() (*OrderItem, error) {
+	item := &OrderItem{}
+
+	t := p.next()
+	switch position, ok := t.value.(int64); {
+	case t.kind == tokenLiteral && ok:
+		if position < 1 {
+			return nil, fmt.Errorf("position of ORDER BY must be positive, but got %d at %d", position, t.pos)
+		}
+		item.Position = int(position)
+
+	case t.kind == tokenIdent:
+		item.Key = t.text
+
+		// 集計の表記(sum(amount)等)は、結果の列の名前として扱う
+		if p.accept("(") {
+			arg := p.next()
+			if arg.kind != tokenIdent && !(arg.kind == tokenSymbol && arg.text == "*") {
+				return nil, fmt.Errorf("expected column path, but got '%s' at %d", arg.text, arg.pos)
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			item.Key = fmt.Sprintf("%s(%s)", strings.ToLower(t.text), arg.text)
+		}
+
+	default:
+		return nil, fmt.Errorf("expected column name or position, but got '%s' at %d", t.text, t.pos)
+	}
+
+	if p.accept("DESC") {
+		item.Desc = true
+	} else {
+		p.accept("ASC")
+	}
+
+	return item, nil
+}
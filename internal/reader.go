@@ -4,168 +4,505 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
-	"github.com/DataDog/zstd"
+	"math/bits"
+	"time"
+
 	"github.com/murakmii/retsu/thrift/parquet"
 )
 
 type (
+	// Parquetファイルの読み取り
+	// 全ての読み取りは列チャンク毎の位置を持って行うので、複数のgoroutineから同時に使ってよい
+	// その場合、サルベージ・読み取りの記録は全ての読み取りの合計になる
 	Reader struct {
-		par  *Parquet
-		meta *MetaData
+		par            *Parquet
+		meta           *MetaData
+		verifyChecksum bool
+		salvage        *SalvageReport // サルベージモードでなければnil
+		filter         Expr
+		predicate      predicate // スキーマと対応付けたfilter(filterが無ければnil)
+		explain        *Explain  // WithExplainを指定していなければnil
+
+		workers int // 並列に読み取るワーカーの数(1以下なら並列にしない)
+	}
+
+	ReaderOption func(*Reader)
+
+	// 列チャンクの読み取り方
+	scanOptions struct {
+		sel         *rowSelection // 選択した行(nilなら全ての行)
+		dictIndices bool          // 辞書エンコーディングされたページの値を辞書から引かず、インデックスのまま渡す
+
+		// nilでなければ、辞書エンコーディングされたページの値はインデックスも渡さず、readRLEのコールバックでこのビットセットを引いた結果を渡す
+		// ビットセットはonDictで作ることを想定し、データページを読み取る時点の値を用いる
+		dictMatch *bitset
+
+		// 辞書ページを読み取った後に呼ばれ、falseを返すとデータページを読まずに終える
+		onDict func(dict *Values) bool
 	}
 )
 
-func NewReader(ctx context.Context, par *Parquet) (*Reader, error) {
+func NewReader(ctx context.Context, par *Parquet, opts ...ReaderOption) (*Reader, error) {
 	meta, err := par.Inspect(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Reader{par: par, meta: meta}, nil
+	r := &Reader{par: par, meta: meta}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.filter != nil {
+		if r.predicate, err = r.filter.bind(meta); err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+	}
+
+	if r.explain != nil {
+		r.explain = newExplain(meta, r.filter)
+	}
+
+	return r, nil
 }
 
-func (r *Reader) SumInt64(ctx context.Context, path string) (int64, error) {
-	schema := r.meta.FindSchema(path)
-	if schema == nil || !schema.IsLeaf() {
-		return 0, fmt.Errorf("'%s' column does not exist", path)
+// ページ読み取り時に、ページヘッダに記録されたCRCを検証する
+// CRCが一致しない場合は *PageCorruptionError を返す
+func WithChecksumVerification() ReaderOption {
+	return func(r *Reader) {
+		r.verifyChecksum = true
 	}
+}
 
-	var sum int64
-	for _, col := range r.meta.FindColumnChunk(path) {
-		if err := r.par.Seek(col.PageHeadOffset()); err != nil {
-			return 0, err
-		}
+// 壊れたページがあっても読み取りを中断せず、そのページを読み飛ばして処理を続ける
+// 読み飛ばしたページは SalvageReport で確認できる
+// ページ本体の破損を確実に検出するには、WithChecksumVerification も併せて指定する
+func WithSalvage() ReaderOption {
+	return func(r *Reader) {
+		r.salvage = &SalvageReport{SkippedPages: make([]*SkippedPage, 0)}
+	}
+}
 
-		var err error
-		var dict []int64
+// 条件式を満たす行のみを読み取る
+// 列チャンクの統計情報とColumnIndexから条件式を満たし得ない行グループ・ページを読み飛ばした上で、
+// 残った範囲の条件式の列をデコードして1行ずつ判定する
+func WithFilter(expr Expr) ReaderOption {
+	return func(r *Reader) {
+		r.filter = expr
+	}
+}
 
-		if col.HasDict() {
-			dict, err = r.readDict(ctx, col)
-			if err != nil {
-				return 0, fmt.Errorf("failed to read dictionary page: %w", err)
-			}
-		}
+// 条件式を追加したReaderを返す(既に条件式があれば、両方を満たす行のみを読み取る)
+// ファイル及びメタデータは元のReaderと共有する
+// 読み取りの記録は元のReaderと共有せず、条件式毎に取る(同じReaderで同時に読み取る、他の条件式の記録と混ざらないように)
+func (r *Reader) withFilter(expr Expr) (*Reader, error) {
+	clone := *r
 
-		for {
-			offset, err := r.par.CurrentOffset()
-			if err != nil {
-				return 0, err
-			}
+	if expr != nil {
+		if r.filter != nil {
+			expr = AllOf(r.filter, expr)
+		}
 
-			if offset == col.PageTailOffset() {
-				break
-			}
+		predicate, err := expr.bind(r.meta)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+		clone.filter, clone.predicate = expr, predicate
+	}
 
-			s, err := r.readDataPage(ctx, schema, col.Codec, dict)
-			if err != nil {
-				return 0, fmt.Errorf("failed to read data page: %w", err)
-			}
+	if r.explain != nil {
+		clone.explain = newExplain(r.meta, clone.filter)
+	}
+	return &clone, nil
+}
 
-			sum += s
+// 条件式を満たす行を含み得る行グループのインデックスを返す
+// 条件式が無ければ全ての行グループを返す
+func (r *Reader) RowGroups() []int {
+	indices := make([]int, 0, len(r.meta.RowGroups))
+	for i, row := range r.meta.RowGroups {
+		if r.mightMatch(row) {
+			indices = append(indices, i)
 		}
 	}
 
-	return sum, nil
+	return indices
+}
+
+func (r *Reader) mightMatch(row *RowGroup) bool {
+	return r.predicate == nil || r.predicate.mightMatch(row)
+}
+
+// サルベージモードで読み飛ばしたデータの記録を返す
+// サルベージモードでなければnilを返す
+func (r *Reader) SalvageReport() *SalvageReport {
+	return r.salvage
 }
 
-func (r *Reader) readDict(ctx context.Context, col *ColumnChunk) ([]int64, error) {
-	header, data, err := r.readCurrentPage(ctx, col.Codec)
+// 条件式を満たす行が存在し得る、行グループ内の行の範囲を返す
+// 列チャンクの統計情報に加えて、条件式の列がColumnIndexを持っていればページ単位で範囲を絞り込む
+// 条件式が無ければ行グループの全ての行を返す
+func (r *Reader) RowRanges(ctx context.Context, rowGroup int) (RowRanges, error) {
+	if rowGroup < 0 || rowGroup >= len(r.meta.RowGroups) {
+		return nil, fmt.Errorf("row group %d does not exist", rowGroup)
+	}
+
+	row := r.meta.RowGroups[rowGroup]
+	if r.predicate == nil {
+		return allRows(row.NumRows), nil
+	}
+	explain := r.explainRowGroup(rowGroup)
+	if !r.predicate.mightMatch(row) {
+		explain.prune(prunedByStatistics)
+		return RowRanges{}, nil
+	}
+
+	contained, err := r.predicate.mightContain(ctx, r, row)
 	if err != nil {
 		return nil, err
 	}
+	if !contained {
+		explain.prune(prunedByBloomFilter)
+		return RowRanges{}, nil
+	}
+
+	indexes := make(map[string]*PageIndex)
+	for _, path := range r.predicate.paths() {
+		col := findColumn(row, path)
+		if col == nil || !col.HasColumnIndex() {
+			continue
+		}
 
-	dict := make([]int64, header.DictionaryPageHeader.NumValues)
-	for i := 0; i < len(dict); i++ {
-		dict[i] = int64(binary.LittleEndian.Uint64(data))
-		data = data[8:]
+		index, err := r.pageIndex(ctx, col)
+		if err != nil {
+			return nil, err
+		}
+		indexes[path] = index
 	}
 
-	return dict, nil
+	ranges := r.predicate.rowRanges(row, indexes)
+	if len(ranges) == 0 {
+		explain.prune(prunedByPageIndex)
+	}
+	explain.candidates(ranges.Rows())
+
+	return ranges, nil
 }
 
-func (r *Reader) readCurrentPage(ctx context.Context, codec parquet.CompressionCodec) (*parquet.PageHeader, []byte, error) {
-	header := &parquet.PageHeader{}
-	if err := r.par.ReadThrift(ctx, header); err != nil {
-		return nil, nil, err
+// 列チャンクのブルームフィルタを返す(読み取ったブルームフィルタはメタデータに保持する)
+// サルベージモードでは、ブルームフィルタが壊れていれば無いものとして扱う
+func (r *Reader) bloomFilter(ctx context.Context, col *ColumnChunk) (*BloomFilter, error) {
+	col.cacheMu.Lock()
+	defer col.cacheMu.Unlock()
+
+	if col.bloomFilterRead || !col.Decryptable() {
+		return col.bloomFilter, nil
+	}
+
+	bf, err := r.par.ReadBloomFilter(ctx, col)
+	if err != nil {
+		if r.salvage != nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read bloom filter of '%s' in row group %d: %w", col.Path, col.RowGroupOrdinal, err)
 	}
 
-	var size int32
-	if codec == parquet.CompressionCodec_UNCOMPRESSED {
-		size = header.UncompressedPageSize
-	} else {
-		size = header.CompressedPageSize
+	col.bloomFilter, col.bloomFilterRead = bf, true
+	return bf, nil
+}
+
+// 列チャンクのページインデックスを返す(読み取ったページインデックスはメタデータに保持する)
+// サルベージモードでは、ページインデックスが壊れていれば無いものとして扱う
+func (r *Reader) pageIndex(ctx context.Context, col *ColumnChunk) (*PageIndex, error) {
+	col.cacheMu.Lock()
+	defer col.cacheMu.Unlock()
+
+	if col.PageIndex != nil || !col.HasOffsetIndex() || !col.Decryptable() {
+		return col.PageIndex, nil
 	}
 
-	data, err := r.par.Read(int64(size))
+	index, err := r.par.ReadPageIndex(ctx, col)
 	if err != nil {
-		return nil, nil, err
+		if r.salvage != nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read page index of '%s' in row group %d: %w", col.Path, col.RowGroupOrdinal, err)
+	}
+
+	col.PageIndex = index
+	return index, nil
+}
+
+// 列チャンクのデータページを先頭から順にデコードし、fnに渡す
+// 行を選択している場合は、選択した行を含むページのみをデコードする(値の絞り込みはfnがselectRowsで行う)
+// その際OffsetIndexがあれば選択した行を含むページのみにシークして読み取り、他のページはヘッダも読まない
+// OffsetIndexが無ければ、ヘッダから行数が分かるページについては本体を読まずに飛ばす
+// サルベージモードでは、デコードできないページを読み飛ばして続ける(fnが返したエラーでは中断する)
+func (r *Reader) scanColumnChunk(ctx context.Context, col *ColumnChunk, schema *Schema, opts scanOptions, fn func(*dataPage) error) error {
+	sel := opts.sel
+	if sel != nil && sel.count() == 0 {
+		return nil
 	}
+	if sel != nil && sel.all() {
+		sel = nil
+		opts.sel = nil
+	}
+
+	var index *PageIndex
+	var err error
+	if sel != nil {
+		if index, err = r.pageIndex(ctx, col); err != nil {
+			return err
+		}
+	}
+
+	pages := newPageReader(r.par, col, r.verifyChecksum)
+	explain := r.explainColumnChunk(col)
+
+	var dict *Values
+
+	if pages.hasDict(ctx) {
+		start := pages.position()
+
+		dict, err = r.readDict(ctx, pages, schema)
+		if err != nil {
+			if r.salvage == nil {
+				return fmt.Errorf("failed to read dictionary page: %w", err)
+			}
+
+			r.salvage.skipColumnChunk(col, err)
+			r.salvage.skipValues(col.NumValues)
+			return nil
+		}
+
+		end := pages.position()
+		explain.read(1, end-start)
+
+		if opts.onDict != nil && !opts.onDict(dict) {
+			explain.skipDataPages(col, end)
+			return nil
+		}
+	}
+
+	if index != nil {
+		return r.scanIndexedPages(ctx, pages, index, schema, dict, opts, fn)
+	}
+
+	var numValues, first int64
+	for {
+		if pages.done() {
+			break
+		}
+
+		start := pages.position()
+		header, err := pages.readDataPageHeader(ctx)
+		if err == nil && sel != nil {
+			if rows, ok := pageRows(header, schema); ok && !sel.any(first, first+rows) {
+				page := int(pages.dataPages)
+				if err = pages.skipDataPageBody(header); err == nil {
+					explain.skip(page, start, pages.position()-start, sel.skipReason(first, first+rows))
+
+					numValues += pageValues(header)
+					first += rows
+					continue
+				}
+			}
+		}
+
+		var page *dataPage
+		if err == nil {
+			page, err = r.readDataPageBody(pages, header, schema, dict, opts)
+		}
+
+		if err != nil {
+			if r.salvage == nil {
+				return fmt.Errorf("failed to read data page: %w", err)
+			}
+
+			// 次のページの位置と、読み飛ばすページの行数が分からないと、以降のページの行の位置も分からない
+			// ヘッダと本体を読み取れていて、ヘッダから行数が分かる場合のみ読み続ける
+			var rows int64
+			ok := false
+			if header != nil && pages.next > start {
+				rows, ok = pageRows(header, schema)
+			}
+			if !ok {
+				r.salvage.skipRest(col, start, err)
+				break
+			}
+
+			r.salvage.skipPage(pages, start, err)
 
-	switch codec {
-	case parquet.CompressionCodec_ZSTD:
-		data, err = zstd.Decompress(nil, data)
+			numValues += pageValues(header)
+			r.salvage.skipValues(pageValues(header))
+			first += rows
+			continue
+		}
+
+		explain.read(1, pages.position()-start)
 
-	case parquet.CompressionCodec_UNCOMPRESSED:
-	// nop
-	default:
-		return nil, nil, fmt.Errorf("unsupported compression codec %s", codec)
+		numValues += int64(page.numValues)
+		page.firstRow = first
+		first += page.rows()
+
+		if err := fn(page); err != nil {
+			return err
+		}
 	}
 
-	return header, data, nil
+	if r.salvage != nil && numValues < col.NumValues {
+		r.salvage.skipValues(col.NumValues - numValues)
+	}
+
+	return nil
 }
 
-func (r *Reader) readDataPage(
+// OffsetIndexのページのうち、選択した行を含むページのみをシークして読み取る
+func (r *Reader) scanIndexedPages(
 	ctx context.Context,
+	pages *pageReader,
+	index *PageIndex,
 	schema *Schema,
-	codec parquet.CompressionCodec,
-	dict []int64,
-) (int64, error) {
-	header, data, err := r.readCurrentPage(ctx, codec)
+	dict *Values,
+	opts scanOptions,
+	fn func(*dataPage) error,
+) error {
+	sel := opts.sel
+	explain := r.explainColumnChunk(pages.col)
+
+	for i, loc := range index.Pages {
+		to := sel.numRows
+		if i+1 < len(index.Pages) {
+			to = index.Pages[i+1].FirstRowIndex
+		}
+
+		if !sel.any(loc.FirstRowIndex, to) {
+			explain.skip(i, loc.Offset, int64(loc.CompressedPageSize), sel.skipReason(loc.FirstRowIndex, to))
+			continue
+		}
+
+		pages.seekDataPage(i, loc.Offset)
+
+		page, err := r.readDataPage(ctx, pages, schema, dict, opts)
+		if err != nil {
+			if r.salvage == nil {
+				return fmt.Errorf("failed to read data page: %w", err)
+			}
+
+			// ページの位置は分かっているので、次のページはそのまま読み取れる
+			r.salvage.skipIndexedPage(pages.col, loc, err)
+			if !schema.HasRepetitionLevels() {
+				r.salvage.skipValues(to - loc.FirstRowIndex)
+			}
+			continue
+		}
+
+		explain.read(1, int64(loc.CompressedPageSize))
+
+		page.firstRow = loc.FirstRowIndex
+		if err := fn(page); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 指定した列に値が含まれている可能性があるかどうかを、ブルームフィルタを用いて判定する
+// falseの場合、ファイル内のいずれの行グループにも値は確実に含まれていない
+func (r *Reader) MightContain(ctx context.Context, path string, value any) (bool, error) {
+	rowGroups, err := r.RowGroupsMightContain(ctx, path, value)
 	if err != nil {
-		return 0, err
+		return false, err
 	}
 
-	if header.DataPageHeader.RepetitionLevelEncoding != parquet.Encoding_RLE {
-		return 0, fmt.Errorf("unsupported repetition level encoding: %s", header.DataPageHeader.RepetitionLevelEncoding)
+	return len(rowGroups) > 0, nil
+}
+
+// 指定した列に値が含まれている可能性がある行グループのインデックスを返す
+// ブルームフィルタを持たない列チャンクの行グループは、常に値を含む可能性があるものとして扱う
+func (r *Reader) RowGroupsMightContain(ctx context.Context, path string, value any) ([]int, error) {
+	schema := r.meta.FindSchema(path)
+	if schema == nil || !schema.IsLeaf() {
+		return nil, fmt.Errorf("'%s' column does not exist", path)
 	}
-	if header.DataPageHeader.DefinitionLevelEncoding != parquet.Encoding_RLE {
-		return 0, fmt.Errorf("unsupported definition level encoding: %s", header.DataPageHeader.DefinitionLevelEncoding)
+
+	plain, err := encodePlainValue(schema, value)
+	if err != nil {
+		return nil, err
 	}
 
-	if schema.HasRepetitionLevels() {
-		data = skipLevel(data)
+	rowGroups := make([]int, 0)
+	for i, row := range r.meta.RowGroups {
+		for _, col := range row.Columns {
+			if col.Path != path {
+				continue
+			}
+
+			bf, err := r.bloomFilter(ctx, col)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read bloom filter of row group %d: %w", i, err)
+			}
+
+			if bf == nil || bf.MightContain(plain) {
+				rowGroups = append(rowGroups, i)
+			}
+		}
 	}
-	if schema.HasDefinitionLevels() {
-		data = skipLevel(data)
+
+	return rowGroups, nil
+}
+
+func (r *Reader) readDict(ctx context.Context, pages *pageReader, schema *Schema) (*Values, error) {
+	header, data, err := pages.readDictPage(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	var sum int64
+	defer r.explainColumnChunk(pages.col).decoded(time.Now())
+	return decodeDictPage(header, data, schema)
+}
+
+func (r *Reader) readDataPage(ctx context.Context, pages *pageReader, schema *Schema, dict *Values, opts scanOptions) (*dataPage, error) {
+	header, data, err := pages.readDataPage(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	switch header.DataPageHeader.Encoding {
-	case parquet.Encoding_RLE_DICTIONARY:
-		bitWidth := data[0]
-		readRLE(data[1:], uint32(bitWidth), func(index uint32, repeated uint64) {
-			sum += dict[index] * int64(repeated)
-		})
+	defer r.explainColumnChunk(pages.col).decoded(time.Now())
+	return decodeDataPage(header, data, schema, dict, opts)
+}
 
-	default:
-		return 0, fmt.Errorf("unsupported page encoding: %s", header.DataPageHeader.Encoding)
+func (r *Reader) readDataPageBody(pages *pageReader, header *parquet.PageHeader, schema *Schema, dict *Values, opts scanOptions) (*dataPage, error) {
+	data, err := pages.readDataPageBody(header)
+	if err != nil {
+		return nil, err
 	}
 
-	return sum, nil
+	defer r.explainColumnChunk(pages.col).decoded(time.Now())
+	return decodeDataPage(header, data, schema, dict, opts)
 }
 
-func readRLE(data []byte, bitWidth uint32, callback func(uint32, uint64)) {
-	mask := uint32(1<<bitWidth) - 1
+func readRLE(data []byte, bitWidth uint32, callback func(uint32, uint64)) error {
+	mask := uint64(1)<<bitWidth - 1
 	byteWidth := int((bitWidth + 7) / 8)
 	var header uint64
+	var err error
 
 	for len(data) > 0 {
-		header, data = readULEB128(data)
+		header, data, err = readULEB128(data)
+		if err != nil {
+			return err
+		}
+
 		isBitPacked := (header & 0x01) == 1
 		header >>= 1
 
 		if !isBitPacked {
+			if len(data) < byteWidth {
+				return fmt.Errorf("rle run is truncated")
+			}
+
 			var runLenValue uint32
 			for i := 0; i < byteWidth; i++ {
 				runLenValue |= uint32(data[i]) << (i * 8)
@@ -176,25 +513,43 @@ func readRLE(data []byte, bitWidth uint32, callback func(uint32, uint64)) {
 			continue
 		}
 
-		var unpacked, unpackedBits uint32
+		// ビットパッキングされた値は8個単位なので、header*bitWidthバイトを占める
+		if uint64(len(data)) < header*uint64(bitWidth) {
+			return fmt.Errorf("bit-packed run is truncated")
+		}
+
+		if bitWidth == 0 {
+			callback(0, header*8)
+			continue
+		}
+
+		// ビット幅は最大32なので、取り出す前の値を溜めるには64ビット必要になる
+		var unpacked uint64
+		var unpackedBits uint32
 		for i := header * 8; i > 0; {
-			unpacked |= uint32(data[0]) << unpackedBits
+			unpacked |= uint64(data[0]) << unpackedBits
 			unpackedBits += 8
 			data = data[1:]
 
-			for ; unpackedBits >= bitWidth; unpackedBits -= bitWidth {
-				callback(unpacked&mask, 1)
+			for ; unpackedBits >= bitWidth && i > 0; unpackedBits -= bitWidth {
+				callback(uint32(unpacked&mask), 1)
 				unpacked >>= bitWidth
 				i--
 			}
 		}
 	}
+
+	return nil
 }
 
-func readULEB128(data []byte) (uint64, []byte) {
+func readULEB128(data []byte) (uint64, []byte, error) {
 	var ret uint64
 
 	for i := 0; ; i++ {
+		if len(data) == 0 || i >= 10 {
+			return 0, nil, fmt.Errorf("invalid uleb128")
+		}
+
 		b := data[0]
 		data = data[1:]
 		ret |= uint64(b&0x7F) << uint(i*7)
@@ -203,10 +558,36 @@ func readULEB128(data []byte) (uint64, []byte) {
 		}
 	}
 
-	return ret, data
+	return ret, data, nil
 }
 
-func skipLevel(data []byte) []byte {
+// データページv1の、長さを先頭に持つレベルのリストをnum個分読み取り、残りのバイト列と共に返す
+func readLevels(data []byte, maxLevel int, num int) ([]int32, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("levels are truncated")
+	}
+
 	levelLen := binary.LittleEndian.Uint32(data)
-	return data[4+levelLen:]
+	if int(levelLen) > len(data)-4 {
+		return nil, nil, fmt.Errorf("levels are truncated(length: %d, remaining: %d)", levelLen, len(data)-4)
+	}
+
+	levels, err := decodeLevels(data[4:4+levelLen], maxLevel, num)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return levels, data[4+levelLen:], nil
+}
+
+// RLE/ビットパッキングのハイブリッドでエンコーディングされたレベルをnum個分読み取る
+func decodeLevels(data []byte, maxLevel int, num int) ([]int32, error) {
+	levels := make([]int32, 0, num)
+	err := readRLE(data, uint32(bits.Len(uint(maxLevel))), func(level uint32, repeated uint64) {
+		for i := uint64(0); i < repeated && len(levels) < num; i++ {
+			levels = append(levels, int32(level))
+		}
+	})
+
+	return levels, err
 }
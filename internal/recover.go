@@ -0,0 +1,442 @@
+package internal
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+type (
+	// フッターの復元に用いる情報
+	RecoveryOptions struct {
+		Schema       []*parquet.SchemaElement  // フッターに格納されるのと同じ、平坦化されたスキーマ
+		Codec        *parquet.CompressionCodec // nilならページの内容から推測する
+		RowsPerGroup int64                     // 行グループ毎の行数の目安(0なら辞書ページの位置のみで列チャンクを区切るので、辞書ページを持たない列チャンクがあるとエラーになる)
+	}
+
+	// フッターの復元結果
+	RecoveryResult struct {
+		Footer      *parquet.FileMetaData // 復元されたフッター
+		MetaData    *MetaData             // 復元されたフッターから得たメタデータ
+		DataEnd     int64                 // 復元できた最後の行グループの末尾のオフセット
+		ScannedEnd  int64                 // ページヘッダを読み取れた最後の位置
+		DroppedRows int64                 // 書き込みが完了していない行グループに含まれていた行数(第1列から推定)
+	}
+
+	// 走査中の列チャンク
+	recoveredChunk struct {
+		meta      *parquet.ColumnMetaData
+		head      int64
+		numRows   int64
+		encodings map[parquet.Encoding]struct{}
+	}
+
+	// 走査中の行グループ
+	recoveredRowGroup struct {
+		chunks []*recoveredChunk
+		end    int64
+	}
+
+	// 走査の状態
+	recoveryScan struct {
+		par          *Parquet
+		size         int64                     // ファイルサイズ
+		codec        *parquet.CompressionCodec // 与えられた、又は推測した圧縮形式
+		codecChecked bool                      // 圧縮形式で最初のページを解凍できることを確認したか
+	}
+)
+
+// 書き込みが中断された等でフッターが無いファイルについて、先頭からページヘッダを辿りフッターを復元する
+// 全ての列チャンクが揃っている行グループのみを復元し、途中で途切れている行グループは捨てる
+func (par *Parquet) Recover(ctx context.Context, opts *RecoveryOptions) (*RecoveryResult, error) {
+	if len(opts.Schema) == 0 {
+		return nil, errors.New("schema is required to recover footer")
+	}
+
+	size := par.Size()
+
+	head, err := par.readRange(0, int64(len(magic)))
+	if err != nil {
+		return nil, err
+	}
+	if string(head) != string(magic) {
+		return nil, fmt.Errorf("file does not start with magic number(encrypted files can't be recovered): %q", head)
+	}
+
+	var leaves []*Schema
+	inspectSchema(opts.Schema, nil, &leaves)
+	for _, leaf := range leaves {
+		if !leaf.IsLeaf() {
+			return nil, fmt.Errorf("leaf '%s' in schema has no type", leaf.Path)
+		}
+	}
+
+	scan := &recoveryScan{par: par, size: size, codec: opts.Codec}
+	result := &RecoveryResult{DataEnd: int64(len(magic)), ScannedEnd: int64(len(magic))}
+	rowGroups := make([]*recoveredRowGroup, 0)
+
+	offset := int64(len(magic))
+	for {
+		rowGroup := &recoveredRowGroup{chunks: make([]*recoveredChunk, 0, len(leaves))}
+		rowsTarget := opts.RowsPerGroup
+
+		for i, leaf := range leaves {
+			chunk, next, err := scan.recoverColumnChunk(ctx, leaf, offset, rowsTarget, i > 0)
+			if err != nil {
+				return nil, err
+			}
+			if chunk == nil {
+				break
+			}
+
+			// 行数の目安が無いと、辞書ページを持たない列チャンクとの境界が分からず、
+			// その列チャンク自身か、直前の列チャンクが後続のページまで取り込んでしまう
+			if opts.RowsPerGroup <= 0 && chunk.meta.DictionaryPageOffset == nil && len(leaves) > 1 {
+				return nil, fmt.Errorf("column chunk of '%s' at %d has no dictionary page, so rows per row group is required to split it", leaf.Path, chunk.head)
+			}
+
+			rowGroup.chunks = append(rowGroup.chunks, chunk)
+			offset = next
+			result.ScannedEnd = next
+
+			// 行グループ内の2列目以降は、1列目と同じ行数で区切る
+			rowsTarget = chunk.numRows
+		}
+
+		if len(rowGroup.chunks) < len(leaves) || !rowGroup.consistent() {
+			if len(rowGroup.chunks) > 0 {
+				result.DroppedRows = rowGroup.chunks[0].numRows
+			}
+			break
+		}
+
+		rowGroup.end = offset
+		rowGroups = append(rowGroups, rowGroup)
+		result.DataEnd = offset
+	}
+
+	result.Footer = buildRecoveredFooter(opts.Schema, rowGroups, scan.codec)
+	result.MetaData, err = par.inspectFooter(ctx, result.Footer, result.DataEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// 復元に必要なスキーマ、圧縮形式、行グループ毎の行数を、同じ書き手が書いた別のファイルから得る
+func RecoveryOptionsFromMetaData(meta *MetaData) *RecoveryOptions {
+	opts := &RecoveryOptions{Schema: meta.schemaElements}
+
+	if len(meta.RowGroups) > 0 {
+		opts.RowsPerGroup = meta.RowGroups[0].NumRows
+		if len(meta.RowGroups[0].Columns) > 0 {
+			codec := meta.RowGroups[0].Columns[0].Codec
+			opts.Codec = &codec
+		}
+	}
+
+	return opts
+}
+
+// 復元したフッターを付与したファイルを書き出す
+// 元のファイルのうち、復元できた行グループまでのバイト列をそのままコピーする
+func (par *Parquet) WriteRecovered(ctx context.Context, w io.Writer, result *RecoveryResult) error {
+	if _, err := io.CopyN(w, io.NewSectionReader(par.r, 0, result.DataEnd), result.DataEnd); err != nil {
+		return fmt.Errorf("failed to copy data pages: %w", err)
+	}
+
+	serializer := thrift.NewTSerializer()
+	serializer.Protocol = thrift.NewTCompactProtocolConf(serializer.Transport, nil)
+	footer, err := serializer.Write(ctx, result.Footer)
+	if err != nil {
+		return fmt.Errorf("failed to serialize footer: %w", err)
+	}
+
+	tail := binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	tail = append(tail, magic...)
+	if _, err := w.Write(tail); err != nil {
+		return fmt.Errorf("failed to write footer: %w", err)
+	}
+
+	return nil
+}
+
+// 指定した位置から1つの列チャンク分のページを辿る
+// rowsTargetが正の値なら、その行数に達した時点で列チャンクを区切る
+// exactがtrueなら、rowsTargetちょうどの行数を持つ列チャンクのみを完全なものとみなす
+// 完全な列チャンクが得られなかった場合はnilを返す
+func (scan *recoveryScan) recoverColumnChunk(
+	ctx context.Context,
+	leaf *Schema,
+	offset int64,
+	rowsTarget int64,
+	exact bool,
+) (*recoveredChunk, int64, error) {
+	chunk := &recoveredChunk{
+		meta: &parquet.ColumnMetaData{
+			Type:         *leaf.Type,
+			PathInSchema: splitPath(leaf.Path),
+		},
+		head:      offset,
+		encodings: make(map[parquet.Encoding]struct{}),
+	}
+
+	for rowsTarget <= 0 || chunk.numRows < rowsTarget {
+		header, headerLen, ok := scan.par.readPlausiblePageHeader(ctx, offset, scan.size)
+		if !ok {
+			break
+		}
+
+		pageEnd := offset + headerLen + int64(header.CompressedPageSize)
+		isDict := header.Type == parquet.PageType_DICTIONARY_PAGE
+
+		// データページの後に辞書ページが現れたら、次の列チャンクが始まっている
+		if isDict && chunk.meta.NumValues > 0 {
+			break
+		}
+
+		if !scan.codecChecked {
+			if err := scan.checkCodec(header, offset+headerLen); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		switch header.Type {
+		case parquet.PageType_DICTIONARY_PAGE:
+			chunk.meta.DictionaryPageOffset = ptr(offset)
+			chunk.encodings[header.DictionaryPageHeader.Encoding] = struct{}{}
+
+		case parquet.PageType_DATA_PAGE, parquet.PageType_DATA_PAGE_V2:
+			rows, err := scan.countPageRows(header, leaf, offset+headerLen)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			if chunk.meta.NumValues == 0 {
+				chunk.meta.DataPageOffset = offset
+			}
+
+			if header.Type == parquet.PageType_DATA_PAGE {
+				chunk.meta.NumValues += int64(header.DataPageHeader.NumValues)
+				chunk.encodings[header.DataPageHeader.Encoding] = struct{}{}
+			} else {
+				chunk.meta.NumValues += int64(header.DataPageHeaderV2.NumValues)
+				chunk.encodings[header.DataPageHeaderV2.Encoding] = struct{}{}
+			}
+			chunk.encodings[parquet.Encoding_RLE] = struct{}{}
+			chunk.numRows += rows
+		}
+
+		chunk.meta.TotalCompressedSize += headerLen + int64(header.CompressedPageSize)
+		chunk.meta.TotalUncompressedSize += headerLen + int64(header.UncompressedPageSize)
+		offset = pageEnd
+	}
+
+	// データページが1つも無いか、行数が他の列チャンクと一致しない列チャンクは不完全
+	if chunk.meta.NumValues == 0 || (exact && chunk.numRows != rowsTarget) {
+		return nil, offset, nil
+	}
+
+	return chunk, offset, nil
+}
+
+// 指定した位置のページヘッダを読み取り、ページヘッダとして妥当なものであればヘッダ長と共に返す
+func (par *Parquet) readPlausiblePageHeader(ctx context.Context, offset int64, size int64) (*parquet.PageHeader, int64, bool) {
+	if offset >= size {
+		return nil, 0, false
+	}
+
+	cur := par.cursorAt(offset)
+	header := &parquet.PageHeader{}
+	if err := cur.readThrift(ctx, header); err != nil {
+		return nil, 0, false
+	}
+
+	end := cur.offset
+
+	if !plausiblePageHeader(header, size-end) {
+		return nil, 0, false
+	}
+
+	return header, end - offset, true
+}
+
+// 書き込み途中で途切れたバイト列や、ゴミをページヘッダと誤認しないように、最低限の妥当性を確認する
+func plausiblePageHeader(header *parquet.PageHeader, remaining int64) bool {
+	if header.CompressedPageSize < 0 || header.UncompressedPageSize < 0 || int64(header.CompressedPageSize) > remaining {
+		return false
+	}
+
+	switch header.Type {
+	case parquet.PageType_DICTIONARY_PAGE:
+		return header.DictionaryPageHeader != nil && header.DictionaryPageHeader.NumValues >= 0
+	case parquet.PageType_DATA_PAGE:
+		return header.DataPageHeader != nil && header.DataPageHeader.NumValues > 0
+	case parquet.PageType_DATA_PAGE_V2:
+		v2 := header.DataPageHeaderV2
+		if v2 == nil || v2.NumValues <= 0 || v2.NumRows <= 0 {
+			return false
+		}
+		_, err := levelsLength(v2, int(header.CompressedPageSize))
+		return err == nil
+	default:
+		return false
+	}
+}
+
+// データページに含まれる行数を数える
+// 繰り返しレベルを持つ列のデータページv1の場合は、ページを解凍して繰り返しレベルが0である値を数える
+func (scan *recoveryScan) countPageRows(header *parquet.PageHeader, leaf *Schema, bodyOffset int64) (int64, error) {
+	if header.Type == parquet.PageType_DATA_PAGE_V2 {
+		return int64(header.DataPageHeaderV2.NumRows), nil
+	}
+
+	numValues := int(header.DataPageHeader.NumValues)
+	if !leaf.HasRepetitionLevels() {
+		return int64(numValues), nil
+	}
+
+	data, err := scan.readPageBody(header, bodyOffset)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err = decompress(*scan.codec, data, int(header.UncompressedPageSize))
+	if err != nil {
+		return 0, err
+	}
+
+	levels, _, err := readLevels(data, leaf.MaxRepetitionLevel, numValues)
+	if err != nil {
+		return 0, err
+	}
+
+	var rows int64
+	for _, level := range levels {
+		if level == 0 {
+			rows++
+		}
+	}
+
+	return rows, nil
+}
+
+// 最初のページ本体を解凍してみて、与えられた圧縮形式が正しいか確認する
+// 圧縮形式が与えられていないか、正しくない場合は、解凍後のサイズが一致する圧縮形式を探す
+// 非圧縮は他の圧縮形式で解凍できなかった場合のみ、サイズが一致していれば採用する
+func (scan *recoveryScan) checkCodec(header *parquet.PageHeader, bodyOffset int64) error {
+	data, err := scan.readPageBody(header, bodyOffset)
+	if err != nil {
+		return err
+	}
+
+	// データページv2のレベルは圧縮されていないので、値の部分のみを解凍してみる
+	size := int(header.UncompressedPageSize)
+	if v2 := header.DataPageHeaderV2; header.Type == parquet.PageType_DATA_PAGE_V2 && v2 != nil {
+		levelsLen, err := levelsLength(v2, min(len(data), size))
+		if err != nil {
+			return fmt.Errorf("invalid page at %d: %w", bodyOffset, err)
+		}
+
+		data, size = data[levelsLen:], size-levelsLen
+	}
+
+	scan.codecChecked = true
+	if scan.codec != nil {
+		decompressed, err := decompress(*scan.codec, data, size)
+		if err == nil && len(decompressed) == size {
+			return nil
+		}
+	}
+
+	for _, candidate := range supportedCodecs {
+		if candidate == parquet.CompressionCodec_UNCOMPRESSED {
+			continue
+		}
+
+		decompressed, err := decompress(candidate, data, size)
+		if err == nil && len(decompressed) == size {
+			scan.codec = &candidate
+			return nil
+		}
+	}
+
+	if header.CompressedPageSize == header.UncompressedPageSize {
+		scan.codec = ptr(parquet.CompressionCodec_UNCOMPRESSED)
+		return nil
+	}
+
+	return fmt.Errorf("failed to detect compression codec of page at %d", bodyOffset)
+}
+
+func (scan *recoveryScan) readPageBody(header *parquet.PageHeader, bodyOffset int64) ([]byte, error) {
+	return scan.par.readRange(bodyOffset, int64(header.CompressedPageSize))
+}
+
+// 全ての列チャンクの行数が一致しているか
+func (rg *recoveredRowGroup) consistent() bool {
+	for _, chunk := range rg.chunks {
+		if chunk.numRows != rg.chunks[0].numRows {
+			return false
+		}
+	}
+
+	return true
+}
+
+func buildRecoveredFooter(
+	schema []*parquet.SchemaElement,
+	rowGroups []*recoveredRowGroup,
+	codec *parquet.CompressionCodec,
+) *parquet.FileMetaData {
+	createdBy := "retsu (footer recovered)"
+	footer := &parquet.FileMetaData{
+		Version:   1,
+		Schema:    schema,
+		RowGroups: make([]*parquet.RowGroup, len(rowGroups)),
+		CreatedBy: &createdBy,
+	}
+
+	// ページが1つも無ければ圧縮形式は推測できないが、列チャンクも無いので用いられない
+	if codec == nil {
+		codec = ptr(parquet.CompressionCodec_UNCOMPRESSED)
+	}
+
+	for i, rg := range rowGroups {
+		row := &parquet.RowGroup{
+			Columns:             make([]*parquet.ColumnChunk, len(rg.chunks)),
+			NumRows:             rg.chunks[0].numRows,
+			FileOffset:          ptr(rg.chunks[0].head),
+			TotalCompressedSize: ptr(rg.end - rg.chunks[0].head),
+			Ordinal:             ptr(int16(i)),
+		}
+
+		for j, chunk := range rg.chunks {
+			chunk.meta.Codec = *codec
+			for encoding := range chunk.encodings {
+				chunk.meta.Encodings = append(chunk.meta.Encodings, encoding)
+			}
+			sort.Slice(chunk.meta.Encodings, func(a, b int) bool { return chunk.meta.Encodings[a] < chunk.meta.Encodings[b] })
+
+			row.Columns[j] = &parquet.ColumnChunk{FileOffset: chunk.head, MetaData: chunk.meta}
+			row.TotalByteSize += chunk.meta.TotalUncompressedSize
+		}
+
+		footer.RowGroups[i] = row
+		footer.NumRows += row.NumRows
+	}
+
+	return footer
+}
+
+func splitPath(path string) []string {
+	return strings.Split(path, ".")
+}
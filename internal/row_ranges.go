@@ -0,0 +1,102 @@
+package internal
+
+type (
+	// 行グループ内の行の範囲[From, To)(行グループの先頭を0とする)
+	RowRange struct {
+		From int64 `json:"from"`
+		To   int64 `json:"to"`
+	}
+
+	// 昇順に並んだ、互いに重ならず隣接もしない行の範囲の集合
+	RowRanges []RowRange
+)
+
+// 行グループの全ての行
+func allRows(numRows int64) RowRanges {
+	if numRows <= 0 {
+		return RowRanges{}
+	}
+
+	return RowRanges{{From: 0, To: numRows}}
+}
+
+// 範囲を末尾に加える(範囲は昇順に加えること)
+// 直前の範囲と重なるか隣接する場合は、1つの範囲にまとめる
+func (ranges RowRanges) add(from, to int64) RowRanges {
+	if from >= to {
+		return ranges
+	}
+
+	if n := len(ranges); n > 0 && ranges[n-1].To >= from {
+		ranges[n-1].To = max(ranges[n-1].To, to)
+		return ranges
+	}
+
+	return append(ranges, RowRange{From: from, To: to})
+}
+
+// 範囲に含まれる行の数
+func (ranges RowRanges) Rows() int64 {
+	var rows int64
+	for _, r := range ranges {
+		rows += r.To - r.From
+	}
+
+	return rows
+}
+
+// [from, to)が、いずれかの範囲と重なるかどうか
+func (ranges RowRanges) overlaps(from, to int64) bool {
+	for _, r := range ranges {
+		if r.From < to && from < r.To {
+			return true
+		}
+	}
+
+	return false
+}
+
+// [from, to)の全ての行が、範囲に含まれるかどうか
+func (ranges RowRanges) covers(from, to int64) bool {
+	for _, r := range ranges {
+		if r.From <= from && to <= r.To {
+			return true
+		}
+	}
+
+	return from >= to
+}
+
+func (ranges RowRanges) union(other RowRanges) RowRanges {
+	out := make(RowRanges, 0, len(ranges)+len(other))
+	i, j := 0, 0
+
+	for i < len(ranges) || j < len(other) {
+		if j >= len(other) || i < len(ranges) && ranges[i].From <= other[j].From {
+			out = out.add(ranges[i].From, ranges[i].To)
+			i++
+		} else {
+			out = out.add(other[j].From, other[j].To)
+			j++
+		}
+	}
+
+	return out
+}
+
+func (ranges RowRanges) intersect(other RowRanges) RowRanges {
+	out := make(RowRanges, 0)
+	i, j := 0, 0
+
+	for i < len(ranges) && j < len(other) {
+		out = out.add(max(ranges[i].From, other[j].From), min(ranges[i].To, other[j].To))
+
+		if ranges[i].To < other[j].To {
+			i++
+		} else {
+			j++
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"sync"
+)
+
+type (
+	// サルベージモードで読み飛ばしたデータの記録
+	SalvageReport struct {
+		SkippedPages  []*SkippedPage `json:"skipped_pages"`
+		SkippedChunks int            `json:"skipped_column_chunks"` // 途中から末尾までを読み飛ばした列チャンクの数
+		SkippedValues int64          `json:"skipped_values"`        // 読み飛ばした値の数(列チャンクの値の数と、読み取れた値の数の差)
+		SkippedBytes  int64          `json:"skipped_bytes"`
+
+		mu sync.Mutex
+	}
+
+	// 読み取りに失敗したページ
+	SkippedPage struct {
+		Offset    int64  `json:"offset"`
+		RowGroup  int16  `json:"row_group"`
+		Column    string `json:"column"`
+		Error     string `json:"error"`
+		Action    string `json:"action"`
+		ResumedAt *int64 `json:"resumed_at,omitempty"` // 読み取りを再開したオフセット
+	}
+)
+
+// 読み取りに失敗したページの扱い
+const (
+	salvageSkipPage        = "skip_page"         // ページの範囲は分かっているので、次のページから再開した
+	salvageSkipColumnChunk = "skip_column_chunk" // 次のページの位置か以降の行の位置が分からないので、列チャンクの残りを読み飛ばした
+)
+
+// 並列に読み取ったタスクの記録を加える
+func (report *SalvageReport) merge(other *SalvageReport) {
+	if report == nil || other == nil {
+		return
+	}
+
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	report.SkippedPages = append(report.SkippedPages, other.SkippedPages...)
+	report.SkippedChunks += other.SkippedChunks
+	report.SkippedValues += other.SkippedValues
+	report.SkippedBytes += other.SkippedBytes
+}
+
+// 読み飛ばしたページを記録する
+// 複数のgoroutineが同じReaderで読み取っている場合があるので、記録は全てロックして行う
+func (report *SalvageReport) add(page *SkippedPage, chunks int, bytes int64) {
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	report.SkippedPages = append(report.SkippedPages, page)
+	report.SkippedChunks += chunks
+	report.SkippedBytes += bytes
+}
+
+// 読み飛ばした値の数を記録する
+func (report *SalvageReport) skipValues(n int64) {
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	report.SkippedValues += n
+}
+
+// ヘッダと本体は読み取れたが内容が壊れていたページを記録し、次のページへシークする
+func (report *SalvageReport) skipPage(pages *pageReader, start int64, cause error) {
+	pages.cur.seek(pages.next)
+
+	report.add(&SkippedPage{
+		Offset:    start,
+		RowGroup:  pages.col.RowGroupOrdinal,
+		Column:    pages.col.Path,
+		Error:     cause.Error(),
+		Action:    salvageSkipPage,
+		ResumedAt: ptr(pages.next),
+	}, 0, pages.next-start)
+}
+
+// 辞書ページが読み取れない場合、後続のデータページも復元できないので列チャンクごと読み飛ばす
+func (report *SalvageReport) skipColumnChunk(col *ColumnChunk, cause error) {
+	report.add(&SkippedPage{
+		Offset:   col.PageHeadOffset(),
+		RowGroup: col.RowGroupOrdinal,
+		Column:   col.Path,
+		Error:    cause.Error(),
+		Action:   salvageSkipColumnChunk,
+	}, 1, col.TotalCompressedSize)
+}
+
+// 読み取りに失敗したページ以降の、列チャンクの残りを読み飛ばす
+func (report *SalvageReport) skipRest(col *ColumnChunk, start int64, cause error) {
+	report.add(&SkippedPage{
+		Offset:   start,
+		RowGroup: col.RowGroupOrdinal,
+		Column:   col.Path,
+		Error:    cause.Error(),
+		Action:   salvageSkipColumnChunk,
+	}, 1, col.PageTailOffset()-start)
+}
+
+// OffsetIndexで位置が分かっているページの読み取りに失敗した場合は、そのページのみを読み飛ばす
+func (report *SalvageReport) skipIndexedPage(col *ColumnChunk, loc *PageIndexEntry, cause error) {
+	report.add(&SkippedPage{
+		Offset:   loc.Offset,
+		RowGroup: col.RowGroupOrdinal,
+		Column:   col.Path,
+		Error:    cause.Error(),
+		Action:   salvageSkipPage,
+	}, 0, int64(loc.CompressedPageSize))
+}
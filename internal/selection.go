@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"context"
+	"math/bits"
+)
+
+type (
+	// 行グループ内で読み取る行の集合(行グループの先頭を0とする行の位置のビットマップ)
+	// 列を読み取る際に共通して用い、条件式を満たす行の値のみを集計等に渡す
+	rowSelection struct {
+		numRows int64
+		bits    bitset
+		ranges  RowRanges // 条件式の列をデコードする前に、統計情報やColumnIndexで絞り込んだ行の範囲(不明ならnil)
+	}
+
+	// 0から始まる整数(行の位置や辞書のインデックス)の集合
+	bitset []uint64
+)
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+func (b bitset) has(i int) bool {
+	return i >= 0 && i/64 < len(b) && b[i/64]&(1<<(i%64)) != 0
+}
+
+// 1つ以上の整数を含むかどうか
+func (b bitset) any() bool {
+	for _, word := range b {
+		if word != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b bitset) count() int {
+	n := 0
+	for _, word := range b {
+		n += bits.OnesCount64(word)
+	}
+
+	return n
+}
+
+// 行を1つも含まない選択を作る
+func newRowSelection(numRows int64) *rowSelection {
+	return &rowSelection{numRows: numRows, bits: newBitset(int(numRows))}
+}
+
+// 行の範囲に含まれる行を選択する
+func selectRanges(numRows int64, ranges RowRanges) *rowSelection {
+	sel := newRowSelection(numRows)
+	sel.ranges = ranges
+	for _, r := range ranges {
+		for row := max(r.From, 0); row < min(r.To, numRows); row++ {
+			sel.set(row)
+		}
+	}
+
+	return sel
+}
+
+func (sel *rowSelection) set(row int64) {
+	sel.bits.set(int(row))
+}
+
+func (sel *rowSelection) has(row int64) bool {
+	return row < sel.numRows && sel.bits.has(int(row))
+}
+
+// 選択した行の数
+func (sel *rowSelection) count() int64 {
+	return int64(sel.bits.count())
+}
+
+// 全ての行を選択しているかどうか
+func (sel *rowSelection) all() bool {
+	return sel.count() == sel.numRows
+}
+
+// [from, to)のいずれかの行を選択しているかどうか
+func (sel *rowSelection) any(from, to int64) bool {
+	from, to = max(from, 0), min(to, sel.numRows)
+	for row := from; row < to; {
+		word := sel.bits[row/64] >> (row % 64)
+		if n := min(64-row%64, to-row); n < 64 {
+			word &= 1<<n - 1
+		}
+		if word != 0 {
+			return true
+		}
+		row += 64 - row%64
+	}
+
+	return false
+}
+
+// [from, to)の行を1つも選択していないために、ページを読み飛ばす理由
+// ColumnIndexで絞り込んだ範囲の外ならpage_index、範囲内で条件式の列をデコードして除いた行ならrows
+func (sel *rowSelection) skipReason(from, to int64) string {
+	if sel.ranges != nil && !sel.ranges.overlaps(from, to) {
+		return prunedByPageIndex
+	}
+
+	return prunedByRows
+}
+
+// 両方で選択している行のみを選択する
+func (sel *rowSelection) and(other *rowSelection) *rowSelection {
+	out := newRowSelection(sel.numRows)
+	out.ranges = sel.ranges
+	for i := range out.bits {
+		out.bits[i] = sel.bits[i] & other.bits[i]
+	}
+
+	return out
+}
+
+// いずれかで選択している行を選択する
+func (sel *rowSelection) or(other *rowSelection) *rowSelection {
+	out := newRowSelection(sel.numRows)
+	out.ranges = sel.ranges
+	for i := range out.bits {
+		out.bits[i] = sel.bits[i] | other.bits[i]
+	}
+
+	return out
+}
+
+// otherで選択している行を除く
+func (sel *rowSelection) andNot(other *rowSelection) *rowSelection {
+	out := newRowSelection(sel.numRows)
+	out.ranges = sel.ranges
+	for i := range out.bits {
+		out.bits[i] = sel.bits[i] &^ other.bits[i]
+	}
+
+	return out
+}
+
+// 行グループ内で条件式を満たす行を選択する
+// RowRangesで絞り込んだ範囲について、条件式の列の値をデコードして1行ずつ判定する
+// 条件式が無ければnil(全ての行)を返す
+func (r *Reader) selectRows(ctx context.Context, rowGroup int, ranges RowRanges) (*rowSelection, error) {
+	if r.predicate == nil {
+		return nil, nil
+	}
+
+	row := r.meta.RowGroups[rowGroup]
+	sel := selectRanges(row.NumRows, ranges)
+	if len(ranges) == 0 {
+		return sel, nil
+	}
+
+	sel, err := r.predicate.filterRows(ctx, r, row, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	r.explainRowGroup(rowGroup).selected(sel.count())
+	return sel, nil
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+type (
+	// 列チャンクの統計情報
+	// 最小値・最大値はPLAINエンコーディングされた値で、無いか信用できない場合はnilになる
+	Statistics struct {
+		NullCount     *int64 `json:"null_count,omitempty"`
+		DistinctCount *int64 `json:"distinct_count,omitempty"`
+		Min           []byte `json:"-"`
+		Max           []byte `json:"-"`
+		MinExact      bool   `json:"min_exact,omitempty"` // 最小値が実際の値か(切り詰められた値等ではないか)
+		MaxExact      bool   `json:"max_exact,omitempty"`
+		Untrusted     string `json:"untrusted,omitempty"` // 最小値・最大値を信用できない場合、その理由
+	}
+
+	// 列の値のソート順
+	sortOrder int
+)
+
+const (
+	sortOrderSigned sortOrder = iota
+	sortOrderUnsigned
+	sortOrderUnknown
+)
+
+// フッターの統計情報を変換する
+// ライターの既知の不具合等で最小値・最大値が信用できない場合は、それらを除いて返す
+func (meta *MetaData) convertStatistics(path string, stats *parquet.Statistics) *Statistics {
+	if stats == nil {
+		return nil
+	}
+
+	s := &Statistics{NullCount: stats.NullCount, DistinctCount: stats.DistinctCount}
+
+	schema := meta.FindSchema(path)
+	if schema == nil || !schema.IsLeaf() {
+		return s
+	}
+
+	if reason := meta.untrustedStatistics(schema, stats); reason != "" {
+		s.Untrusted = reason
+		return s
+	}
+
+	if stats.IsSetMinValue() || stats.IsSetMaxValue() {
+		s.Min, s.Max = stats.MinValue, stats.MaxValue
+	} else {
+		s.Min, s.Max = stats.Min, stats.Max
+	}
+
+	// 浮動小数点数の最小値・最大値にNaNが書き込まれている場合、他の値の範囲は分からない
+	if comparator, err := NewComparator(schema); err != nil || comparator.IsNaN(s.Min) || comparator.IsNaN(s.Max) {
+		s.Min, s.Max = nil, nil
+		s.Untrusted = "NaN in min/max"
+		if err != nil {
+			s.Untrusted = err.Error()
+		}
+		return s
+	}
+
+	// バイト列の最小値・最大値は切り詰められていることがあるので、実際の値であると明示されている場合のみ信用する
+	binary := *schema.Type == parquet.Type_BYTE_ARRAY || *schema.Type == parquet.Type_FIXED_LEN_BYTE_ARRAY
+	s.MinExact = s.Min != nil && (stats.IsSetIsMinValueExact() && *stats.IsMinValueExact || !stats.IsSetIsMinValueExact() && !binary)
+	s.MaxExact = s.Max != nil && (stats.IsSetIsMaxValueExact() && *stats.IsMaxValueExact || !stats.IsSetIsMaxValueExact() && !binary)
+
+	return s
+}
+
+// 列の論理型、又は物理型から値のソート順を決める
+func columnSortOrder(schema *Schema) sortOrder {
+	if logical := schema.LogicalType; logical != nil {
+		switch {
+		case logical.IsSetSTRING(), logical.IsSetENUM(), logical.IsSetJSON(), logical.IsSetBSON(), logical.IsSetUUID():
+			return sortOrderUnsigned
+		case logical.IsSetINTEGER():
+			if logical.INTEGER.IsSigned {
+				return sortOrderSigned
+			}
+			return sortOrderUnsigned
+		case logical.IsSetDECIMAL(), logical.IsSetDATE(), logical.IsSetTIME(), logical.IsSetTIMESTAMP(), logical.IsSetFLOAT16():
+			return sortOrderSigned
+		case logical.IsSetUNKNOWN():
+			return sortOrderUnknown
+		}
+	}
+
+	if converted := schema.ConvertedType; converted != nil {
+		switch *converted {
+		case parquet.ConvertedType_UTF8, parquet.ConvertedType_ENUM, parquet.ConvertedType_JSON, parquet.ConvertedType_BSON,
+			parquet.ConvertedType_UINT_8, parquet.ConvertedType_UINT_16, parquet.ConvertedType_UINT_32, parquet.ConvertedType_UINT_64:
+			return sortOrderUnsigned
+		case parquet.ConvertedType_INTERVAL:
+			return sortOrderUnknown
+		case parquet.ConvertedType_DECIMAL, parquet.ConvertedType_DATE,
+			parquet.ConvertedType_TIME_MILLIS, parquet.ConvertedType_TIME_MICROS,
+			parquet.ConvertedType_TIMESTAMP_MILLIS, parquet.ConvertedType_TIMESTAMP_MICROS,
+			parquet.ConvertedType_INT_8, parquet.ConvertedType_INT_16, parquet.ConvertedType_INT_32, parquet.ConvertedType_INT_64:
+			return sortOrderSigned
+		}
+	}
+
+	switch *schema.Type {
+	case parquet.Type_BYTE_ARRAY, parquet.Type_FIXED_LEN_BYTE_ARRAY:
+		return sortOrderUnsigned
+	case parquet.Type_INT96:
+		return sortOrderUnknown
+	default:
+		return sortOrderSigned
+	}
+}
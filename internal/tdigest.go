@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"math"
+	"sort"
+)
+
+type (
+	// 分位数を推定するt-digest(Merging Digest)
+	// 値は重心(平均と重み)の列に要約し、分布の両端ほど重心を細かく保つので、p99等の裾の分位数を精度良く推定できる
+	// 同じ圧縮率のものに限らず、t-digest同士はマージできる
+	TDigest struct {
+		compression float64
+		centroids   []centroid // 平均の昇順
+		buffer      []centroid // まだ要約していない値
+		count       float64
+		min, max    float64
+	}
+
+	centroid struct {
+		mean   float64
+		weight float64
+	}
+)
+
+// 圧縮率が大きいほど重心が多くなり、推定の精度が上がる
+const DefaultTDigestCompression = 100
+
+func NewTDigest(compression float64) *TDigest {
+	if compression < 10 {
+		compression = 10
+	}
+
+	return &TDigest{compression: compression, min: math.Inf(1), max: math.Inf(-1)}
+}
+
+// 値を加える(NaNは無視する)
+func (t *TDigest) Add(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+
+	t.addCentroid(centroid{mean: v, weight: 1})
+	t.min, t.max = math.Min(t.min, v), math.Max(t.max, v)
+}
+
+func (t *TDigest) addCentroid(c centroid) {
+	t.buffer = append(t.buffer, c)
+	t.count += c.weight
+
+	if len(t.buffer) >= int(8*t.compression) {
+		t.compress()
+	}
+}
+
+// 他のt-digestに加えた値を、このt-digestにも加えたことにする
+func (t *TDigest) Merge(other *TDigest) {
+	for _, c := range other.centroids {
+		t.addCentroid(c)
+	}
+	for _, c := range other.buffer {
+		t.addCentroid(c)
+	}
+
+	if other.count > 0 {
+		t.min, t.max = math.Min(t.min, other.min), math.Max(t.max, other.max)
+	}
+}
+
+// 加えた値の数
+func (t *TDigest) Count() int64 {
+	return int64(t.count)
+}
+
+// 重心と未要約の値を平均の順に並べ、隣り合うものを重みの上限4・n・q(1-q)/δ(qは重心の中央の分位)を超えない範囲でまとめる
+// 上限は分布の両端ほど小さいので、端の重心は少数の値のみを表す
+func (t *TDigest) compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+
+	all := append(t.centroids, t.buffer...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := make([]centroid, 0, int(t.compression))
+	current := all[0]
+	cumulative := 0.0 // currentより前の重みの合計
+
+	for _, c := range all[1:] {
+		weight := current.weight + c.weight
+		q := (cumulative + weight/2) / t.count
+		if weight <= 4*t.count*q*(1-q)/t.compression {
+			current.mean += (c.mean - current.mean) * c.weight / weight
+			current.weight = weight
+			continue
+		}
+
+		merged = append(merged, current)
+		cumulative += current.weight
+		current = c
+	}
+
+	t.centroids = append(merged, current)
+	t.buffer = t.buffer[:0]
+}
+
+// q(0以上1以下)分位数を推定する(値が無ければNaN)
+// 各重心の値はその平均の前後に一様に分布しているとみなし、隣り合う重心の平均の間を線形補間する
+func (t *TDigest) Quantile(q float64) float64 {
+	t.compress()
+
+	if len(t.centroids) == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return t.min
+	}
+	if q >= 1 {
+		return t.max
+	}
+
+	target := q * t.count
+	first := t.centroids[0]
+	if target < first.weight/2 {
+		// 最小値と最初の重心の平均の間
+		if first.weight == 1 {
+			return t.min
+		}
+		return t.min + (first.mean-t.min)*target/(first.weight/2)
+	}
+
+	cumulative := first.weight / 2 // 重心の平均の位置までの重み
+	for i := 1; i < len(t.centroids); i++ {
+		prev, c := t.centroids[i-1], t.centroids[i]
+		between := (prev.weight + c.weight) / 2
+
+		if target < cumulative+between {
+			// 重みが1の重心は値そのものなので、補間しない
+			if prev.weight == 1 && target-cumulative < 0.5 {
+				return prev.mean
+			}
+			if c.weight == 1 && cumulative+between-target <= 0.5 {
+				return c.mean
+			}
+			return prev.mean + (c.mean-prev.mean)*(target-cumulative)/between
+		}
+		cumulative += between
+	}
+
+	last := t.centroids[len(t.centroids)-1]
+	if last.weight == 1 {
+		return t.max
+	}
+	return last.mean + (t.max-last.mean)*(target-cumulative)/(last.weight/2)
+}
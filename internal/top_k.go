@@ -0,0 +1,288 @@
+package internal
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+)
+
+type (
+	// 列で出現頻度の高い値
+	TopK struct {
+		Path      string           `json:"path"`
+		Values    []*FrequentValue `json:"values"`     // 出現回数の降順(同じ回数なら値の昇順)
+		Count     int64            `json:"count"`      // nullでない値の数
+		NullCount int64            `json:"null_count"` // nullの数
+		Exact     bool             `json:"exact"`      // 全ての値を数えたか(falseならSpace-Savingによる推定)
+
+		ScannedRowGroups int `json:"scanned_row_groups"` // ページを読み取った行グループの数
+		PrunedRowGroups  int `json:"pruned_row_groups"`  // 条件式を満たす行を含まないため、読み飛ばした行グループの数
+	}
+
+	FrequentValue struct {
+		Value any   `json:"value"` // 論理型に従って変換した値
+		Count int64 `json:"count"`
+		Error int64 `json:"error,omitempty"` // Countが実際の出現回数を上回っている可能性のある数の上限
+	}
+
+	// 値毎の出現回数を数え、値の種類が容量を超えたらSpace-Savingに切り替える
+	// Space-Savingでは出現回数の最も少ない値を新しい値に置き換え、置き換えた値の出現回数を誤差として引き継ぐ
+	// 出現回数が全体の1/容量を超える値は、必ず残る
+	frequencyCounter struct {
+		capacity int
+		counters map[string]*frequencyCounterEntry
+		heap     frequencyHeap // 出現回数の最も少ない値を探すためのヒープ
+		evicted  bool          // 値を置き換えたことがあるか
+	}
+
+	frequencyCounterEntry struct {
+		value []byte
+		count int64
+		error int64
+		index int // ヒープ内の位置
+	}
+
+	frequencyHeap []*frequencyCounterEntry
+
+	// 行グループ毎に数えた出現回数
+	topKPart struct {
+		counter   *frequencyCounter
+		count     int64
+		nullCount int64
+	}
+)
+
+// 出現頻度の高い値をk個求める
+// 辞書エンコーディングされたページでは辞書のインデックス毎に数え、列チャンクの終わりに辞書の値毎に1度だけまとめて加える
+// 値の種類がkの10倍(少なくとも1000)を超えた場合は、Space-Savingによる推定値になる
+// 行グループ毎に数えた結果をマージするので、行グループを並列に読み取れる
+// 繰り返しのある列では、全ての位置の値を対象とする
+// 条件式(WithFilter)がある場合、条件式を満たす行の値のみを対象とする
+func (r *Reader) TopK(ctx context.Context, path string, k int) (*TopK, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("k must be positive, but got %d", k)
+	}
+
+	schema := r.meta.FindSchema(path)
+	if schema == nil || !schema.IsLeaf() {
+		return nil, fmt.Errorf("'%s' column does not exist", path)
+	}
+
+	// ワーカーの数に依らず同じ結果になるよう、行グループ毎に数えた結果を行グループの順にマージする
+	capacity := max(10*k, 1000)
+	parts, err := runTasks(ctx, r, len(r.meta.RowGroups), func(ctx context.Context, r *Reader, i int) (*topKPart, error) {
+		return r.countRowGroup(ctx, i, schema, capacity)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counter := newFrequencyCounter(capacity)
+	result := &TopK{Path: path}
+	for _, part := range parts {
+		if part == nil {
+			result.PrunedRowGroups++
+			continue
+		}
+		result.ScannedRowGroups++
+
+		counter.merge(part.counter)
+		result.Count += part.count
+		result.NullCount += part.nullCount
+	}
+
+	comparator, _ := NewComparator(schema)
+	entries := append([]*frequencyCounterEntry(nil), counter.heap...)
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a].count != entries[b].count {
+			return entries[a].count > entries[b].count
+		}
+		return comparePlainValues(comparator, entries[a].value, entries[b].value) < 0
+	})
+
+	result.Values = make([]*FrequentValue, 0, k)
+	for _, entry := range entries[:min(k, len(entries))] {
+		result.Values = append(result.Values, &FrequentValue{
+			Value: formatPlainValue(schema, entry.value),
+			Count: entry.count,
+			Error: entry.error,
+		})
+	}
+	result.Exact = !counter.evicted
+
+	return result, nil
+}
+
+// 行グループ内の選択した行について、値の出現回数を数える
+// 条件式を満たす行が無ければnilを返す
+func (r *Reader) countRowGroup(ctx context.Context, rowGroup int, schema *Schema, capacity int) (*topKPart, error) {
+	ranges, err := r.RowRanges(ctx, rowGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+
+	sel, err := r.selectRows(ctx, rowGroup, ranges)
+	if err != nil {
+		return nil, err
+	}
+
+	if sel != nil && sel.count() == 0 {
+		return nil, nil
+	}
+
+	path := schema.Path
+	col := findColumn(r.meta.RowGroups[rowGroup], path)
+	if col == nil {
+		return nil, fmt.Errorf("'%s' column does not exist in row group", path)
+	}
+
+	part := &topKPart{counter: newFrequencyCounter(capacity)}
+	var dict *Values
+	var dictCounts []int64 // 辞書のインデックス毎の出現回数
+
+	opts := scanOptions{
+		sel:         sel,
+		dictIndices: true,
+		onDict: func(d *Values) bool {
+			dict, dictCounts = d, make([]int64, d.Len())
+			return true
+		},
+	}
+
+	err = r.scanColumnChunk(ctx, col, schema, opts, func(page *dataPage) error {
+		page = page.selectRows(sel)
+		part.nullCount += int64(page.nulls())
+
+		if page.values == nil {
+			for _, index := range page.indices {
+				dictCounts[index]++
+			}
+			part.count += int64(len(page.indices))
+			return nil
+		}
+
+		for j := 0; j < page.values.Len(); j++ {
+			part.counter.add(page.values.plain(j), 1)
+		}
+		part.count += int64(page.values.Len())
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count values of '%s': %w", path, err)
+	}
+
+	for index, count := range dictCounts {
+		if count > 0 {
+			part.counter.add(dict.plain(index), count)
+		}
+	}
+
+	return part, nil
+}
+
+func newFrequencyCounter(capacity int) *frequencyCounter {
+	return &frequencyCounter{capacity: capacity, counters: make(map[string]*frequencyCounterEntry)}
+}
+
+// 値の出現回数をcountだけ加える
+func (c *frequencyCounter) add(v []byte, count int64) {
+	if entry, ok := c.counters[string(v)]; ok {
+		entry.count += count
+		heap.Fix(&c.heap, entry.index)
+		return
+	}
+
+	// 値はページのバッファを参照しているので、コピーして保持する
+	s := string(v)
+
+	if len(c.heap) < c.capacity {
+		entry := &frequencyCounterEntry{value: []byte(s), count: count}
+		c.counters[s] = entry
+		heap.Push(&c.heap, entry)
+		return
+	}
+
+	// 出現回数の最も少ない値を置き換える
+	entry := c.heap[0]
+	delete(c.counters, string(entry.value))
+
+	entry.value, entry.error = []byte(s), entry.count
+	entry.count += count
+	c.counters[s] = entry
+	heap.Fix(&c.heap, 0)
+	c.evicted = true
+}
+
+// otherで数えた出現回数を加える
+// 置き換えが起きた側で残っていない値は、その側の最小の出現回数まで出現した可能性があるので、出現回数と誤差の両方にそれを加える
+// まとめた値の種類が容量を超えれば、出現回数の多い順(同じなら値の順)に容量分だけ残す
+func (c *frequencyCounter) merge(other *frequencyCounter) {
+	floor := func(counter *frequencyCounter) int64 {
+		if !counter.evicted || len(counter.heap) == 0 {
+			return 0
+		}
+		return counter.heap[0].count
+	}
+	selfFloor, otherFloor := floor(c), floor(other)
+
+	merged := make([]*frequencyCounterEntry, 0, len(c.heap)+len(other.heap))
+	for _, entry := range c.heap {
+		count, overestimate := otherFloor, otherFloor
+		if o, ok := other.counters[string(entry.value)]; ok {
+			count, overestimate = o.count, o.error
+		}
+		merged = append(merged, &frequencyCounterEntry{value: entry.value, count: entry.count + count, error: entry.error + overestimate})
+	}
+	for _, entry := range other.heap {
+		if _, ok := c.counters[string(entry.value)]; !ok {
+			merged = append(merged, &frequencyCounterEntry{value: entry.value, count: entry.count + selfFloor, error: entry.error + selfFloor})
+		}
+	}
+
+	c.evicted = c.evicted || other.evicted
+	if len(merged) > c.capacity {
+		sort.Slice(merged, func(a, b int) bool {
+			if merged[a].count != merged[b].count {
+				return merged[a].count > merged[b].count
+			}
+			return bytes.Compare(merged[a].value, merged[b].value) < 0
+		})
+		merged = merged[:c.capacity]
+		c.evicted = true
+	}
+
+	c.counters = make(map[string]*frequencyCounterEntry, len(merged))
+	c.heap = merged
+	for i, entry := range merged {
+		entry.index = i
+		c.counters[string(entry.value)] = entry
+	}
+	heap.Init(&c.heap)
+}
+
+func (h frequencyHeap) Len() int           { return len(h) }
+func (h frequencyHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h frequencyHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *frequencyHeap) Push(x any) {
+	entry := x.(*frequencyCounterEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *frequencyHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,280 @@
+package internal
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+	"unicode/utf8"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+// Goの値を、列の物理型に従ってPLAINエンコーディングしたバイト列に変換する
+// BYTE_ARRAYについては長さを含まない値そのもののバイト列を返す(ブルームフィルタや統計情報と同じ表現)
+// 整数は列の範囲(符号無し整数の列なら0以上)に収まらなければエラーにする
+func encodePlainValue(schema *Schema, value any) ([]byte, error) {
+	unsigned := columnSortOrder(schema) == sortOrderUnsigned
+
+	switch *schema.Type {
+	case parquet.Type_BOOLEAN:
+		if b, ok := value.(bool); ok {
+			if b {
+				return []byte{1}, nil
+			}
+			return []byte{0}, nil
+		}
+
+	case parquet.Type_INT32:
+		if i, ok := toInt64(value); ok {
+			if !unsigned && (i < math.MinInt32 || i > math.MaxInt32) || unsigned && (i < 0 || i > math.MaxUint32) {
+				return nil, fmt.Errorf("value %v overflows INT32", value)
+			}
+			return binary.LittleEndian.AppendUint32(nil, uint32(i)), nil
+		}
+		if _, ok := toUint64(value); ok {
+			return nil, fmt.Errorf("value %v overflows INT32", value)
+		}
+
+	case parquet.Type_INT64:
+		if i, ok := toInt64(value); ok {
+			if unsigned && i < 0 {
+				return nil, fmt.Errorf("value %v overflows INT64", value)
+			}
+			return binary.LittleEndian.AppendUint64(nil, uint64(i)), nil
+		}
+		if u, ok := toUint64(value); ok {
+			if !unsigned {
+				return nil, fmt.Errorf("value %v overflows INT64", value)
+			}
+			return binary.LittleEndian.AppendUint64(nil, u), nil
+		}
+
+	case parquet.Type_FLOAT:
+		if f, ok := toFloat64(value); ok {
+			return binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(f))), nil
+		}
+
+	case parquet.Type_DOUBLE:
+		if f, ok := toFloat64(value); ok {
+			return binary.LittleEndian.AppendUint64(nil, math.Float64bits(f)), nil
+		}
+
+	case parquet.Type_BYTE_ARRAY, parquet.Type_FIXED_LEN_BYTE_ARRAY, parquet.Type_INT96:
+		var b []byte
+		switch v := value.(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		default:
+			return nil, fmt.Errorf("unsupported value %v(%T) for %s column", value, value, schema.Type)
+		}
+
+		if *schema.Type == parquet.Type_INT96 && len(b) != 12 {
+			return nil, fmt.Errorf("INT96 value must be 12 bytes, but got %d bytes", len(b))
+		}
+		if *schema.Type == parquet.Type_FIXED_LEN_BYTE_ARRAY && schema.TypeLength != nil && int32(len(b)) != *schema.TypeLength {
+			return nil, fmt.Errorf("FIXED_LEN_BYTE_ARRAY value must be %d bytes, but got %d bytes", *schema.TypeLength, len(b))
+		}
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value %v(%T) for %s column", value, value, schema.Type)
+}
+
+func toInt64(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint:
+		if uint64(v) <= math.MaxInt64 {
+			return int64(v), true
+		}
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), true
+		}
+	}
+
+	return 0, false
+}
+
+// int64に収まらない符号無し整数
+func toUint64(value any) (uint64, bool) {
+	switch v := value.(type) {
+	case uint:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	}
+
+	return 0, false
+}
+
+func toFloat64(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+
+	if i, ok := toInt64(value); ok {
+		return float64(i), true
+	}
+
+	return 0, false
+}
+
+// PLAINエンコーディングされた値を、列の論理型に従って表示やJSONの出力に適したGoの値に変換する(nilはnull)
+// 整数はint64(符号無し整数はuint64)、浮動小数点数及びDECIMALは*Number、文字列はstringとし、
+// 日付・時刻はUTCで書式化した文字列、UUIDは標準の表記にする
+// 論理型の無いバイト列は、UTF-8として正しければ文字列、そうでなければ16進数の表記にする
+func formatPlainValue(schema *Schema, v []byte) any {
+	if v == nil {
+		return nil
+	}
+
+	logical := schema.LogicalType
+	if logical == nil {
+		logical = &parquet.LogicalType{}
+	}
+	converted := parquet.ConvertedType(-1)
+	if schema.ConvertedType != nil {
+		converted = *schema.ConvertedType
+	}
+
+	decimal := logical.IsSetDECIMAL() || converted == parquet.ConvertedType_DECIMAL
+	scale := int32(0)
+	if decimal && schema.Scale != nil {
+		scale = *schema.Scale
+	}
+
+	switch *schema.Type {
+	case parquet.Type_BOOLEAN:
+		if len(v) == 1 {
+			return v[0] != 0
+		}
+
+	case parquet.Type_INT32:
+		if len(v) != 4 {
+			break
+		}
+
+		i := int32(binary.LittleEndian.Uint32(v))
+		switch {
+		case decimal:
+			return &Number{unscaled: big.NewInt(int64(i)), scale: scale}
+		case logical.IsSetDATE() || converted == parquet.ConvertedType_DATE:
+			return time.Unix(int64(i)*86400, 0).UTC().Format("2006-01-02")
+		case logical.IsSetTIME() || converted == parquet.ConvertedType_TIME_MILLIS:
+			return formatTimeOfDay(int64(i) * int64(time.Millisecond))
+		case columnSortOrder(schema) == sortOrderUnsigned:
+			return uint64(uint32(i))
+		default:
+			return int64(i)
+		}
+
+	case parquet.Type_INT64:
+		if len(v) != 8 {
+			break
+		}
+
+		i := int64(binary.LittleEndian.Uint64(v))
+		switch {
+		case decimal:
+			return &Number{unscaled: big.NewInt(i), scale: scale}
+		case logical.IsSetTIMESTAMP():
+			return formatTimestamp(i, timeUnitNanos(logical.TIMESTAMP.Unit))
+		case converted == parquet.ConvertedType_TIMESTAMP_MILLIS:
+			return formatTimestamp(i, int64(time.Millisecond))
+		case converted == parquet.ConvertedType_TIMESTAMP_MICROS:
+			return formatTimestamp(i, int64(time.Microsecond))
+		case logical.IsSetTIME():
+			return formatTimeOfDay(i * timeUnitNanos(logical.TIME.Unit))
+		case converted == parquet.ConvertedType_TIME_MICROS:
+			return formatTimeOfDay(i * int64(time.Microsecond))
+		case columnSortOrder(schema) == sortOrderUnsigned:
+			return uint64(i)
+		default:
+			return i
+		}
+
+	case parquet.Type_INT96:
+		// 先頭8バイトが日中のナノ秒、後続の4バイトがユリウス日
+		if len(v) == 12 {
+			nanos := int64(binary.LittleEndian.Uint64(v[:8]))
+			days := int64(binary.LittleEndian.Uint32(v[8:])) - 2440588 // 1970-01-01のユリウス日
+			return time.Unix(days*86400, nanos).UTC().Format(time.RFC3339Nano)
+		}
+
+	case parquet.Type_FLOAT:
+		if len(v) == 4 {
+			return &Number{float: float64(math.Float32frombits(binary.LittleEndian.Uint32(v)))}
+		}
+
+	case parquet.Type_DOUBLE:
+		if len(v) == 8 {
+			return &Number{float: math.Float64frombits(binary.LittleEndian.Uint64(v))}
+		}
+
+	default:
+		switch {
+		case decimal:
+			return &Number{unscaled: signedBytesToBig(v), scale: scale}
+		case logical.IsSetFLOAT16() && len(v) == 2:
+			return &Number{float: float16ToFloat64(binary.LittleEndian.Uint16(v))}
+		case logical.IsSetUUID() && len(v) == 16:
+			return fmt.Sprintf("%x-%x-%x-%x-%x", v[:4], v[4:6], v[6:8], v[8:10], v[10:])
+		case logical.IsSetSTRING() || logical.IsSetENUM() || logical.IsSetJSON() ||
+			converted == parquet.ConvertedType_UTF8 || converted == parquet.ConvertedType_ENUM || converted == parquet.ConvertedType_JSON:
+			return string(v)
+		case utf8.Valid(v):
+			return string(v)
+		}
+	}
+
+	return "0x" + hex.EncodeToString(v)
+}
+
+// 時刻の単位のナノ秒数
+func timeUnitNanos(unit *parquet.TimeUnit) int64 {
+	switch {
+	case unit == nil:
+		return 1
+	case unit.IsSetMILLIS():
+		return int64(time.Millisecond)
+	case unit.IsSetMICROS():
+		return int64(time.Microsecond)
+	default:
+		return 1
+	}
+}
+
+// Unixエポックからの経過時間(単位はunitナノ秒)を、UTCの日時として書式化する
+func formatTimestamp(v int64, unit int64) string {
+	perSecond := int64(time.Second) / unit
+	return time.Unix(v/perSecond, v%perSecond*unit).UTC().Format(time.RFC3339Nano)
+}
+
+// 0時からの経過時間(ナノ秒)を、時刻として書式化する
+func formatTimeOfDay(nanos int64) string {
+	return time.Unix(0, nanos).UTC().Format("15:04:05.999999999")
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+type (
+	// 列の値の並び
+	// 物理型に対応するいずれか1つのスライスのみを用いる
+	// BYTE_ARRAY、FIXED_LEN_BYTE_ARRAY及びINT96の値はBytesに格納する
+	Values struct {
+		Type    parquet.Type
+		Boolean []bool
+		Int32   []int32
+		Int64   []int64
+		Float   []float32
+		Double  []float64
+		Bytes   [][]byte
+	}
+)
+
+func newValues(typ parquet.Type, capacity int) *Values {
+	v := &Values{Type: typ}
+	switch typ {
+	case parquet.Type_BOOLEAN:
+		v.Boolean = make([]bool, 0, capacity)
+	case parquet.Type_INT32:
+		v.Int32 = make([]int32, 0, capacity)
+	case parquet.Type_INT64:
+		v.Int64 = make([]int64, 0, capacity)
+	case parquet.Type_FLOAT:
+		v.Float = make([]float32, 0, capacity)
+	case parquet.Type_DOUBLE:
+		v.Double = make([]float64, 0, capacity)
+	default:
+		v.Bytes = make([][]byte, 0, capacity)
+	}
+
+	return v
+}
+
+// 値の数
+func (v *Values) Len() int {
+	switch v.Type {
+	case parquet.Type_BOOLEAN:
+		return len(v.Boolean)
+	case parquet.Type_INT32:
+		return len(v.Int32)
+	case parquet.Type_INT64:
+		return len(v.Int64)
+	case parquet.Type_FLOAT:
+		return len(v.Float)
+	case parquet.Type_DOUBLE:
+		return len(v.Double)
+	default:
+		return len(v.Bytes)
+	}
+}
+
+// 辞書のインデックスから値を引いて、値の並びを作る
+func (v *Values) lookup(indices []uint32) (*Values, error) {
+	size := v.Len()
+	for _, index := range indices {
+		if int(index) >= size {
+			return nil, fmt.Errorf("dictionary index(%d) is out of range(dictionary size: %d)", index, size)
+		}
+	}
+
+	out := &Values{Type: v.Type}
+	switch v.Type {
+	case parquet.Type_BOOLEAN:
+		out.Boolean = gather(v.Boolean, indices)
+	case parquet.Type_INT32:
+		out.Int32 = gather(v.Int32, indices)
+	case parquet.Type_INT64:
+		out.Int64 = gather(v.Int64, indices)
+	case parquet.Type_FLOAT:
+		out.Float = gather(v.Float, indices)
+	case parquet.Type_DOUBLE:
+		out.Double = gather(v.Double, indices)
+	default:
+		out.Bytes = gather(v.Bytes, indices)
+	}
+
+	return out, nil
+}
+
+func gather[T any](values []T, indices []uint32) []T {
+	out := make([]T, len(indices))
+	for i, index := range indices {
+		out[i] = values[index]
+	}
+
+	return out
+}
+
+// keepがtrueである位置の値のみを残した、値の並びを作る
+func (v *Values) filter(keep []bool) *Values {
+	out := &Values{Type: v.Type}
+	switch v.Type {
+	case parquet.Type_BOOLEAN:
+		out.Boolean = filterSlice(v.Boolean, keep)
+	case parquet.Type_INT32:
+		out.Int32 = filterSlice(v.Int32, keep)
+	case parquet.Type_INT64:
+		out.Int64 = filterSlice(v.Int64, keep)
+	case parquet.Type_FLOAT:
+		out.Float = filterSlice(v.Float, keep)
+	case parquet.Type_DOUBLE:
+		out.Double = filterSlice(v.Double, keep)
+	default:
+		out.Bytes = filterSlice(v.Bytes, keep)
+	}
+
+	return out
+}
+
+func filterSlice[T any](values []T, keep []bool) []T {
+	out := make([]T, 0, len(values))
+	for i, v := range values {
+		if keep[i] {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
+
+// i番目の値を、PLAINエンコーディングした値(BYTE_ARRAYは長さを含まない値そのもの)として返す
+func (v *Values) plain(i int) []byte {
+	switch v.Type {
+	case parquet.Type_BOOLEAN:
+		if v.Boolean[i] {
+			return []byte{1}
+		}
+		return []byte{0}
+	case parquet.Type_INT32:
+		return binary.LittleEndian.AppendUint32(nil, uint32(v.Int32[i]))
+	case parquet.Type_INT64:
+		return binary.LittleEndian.AppendUint64(nil, uint64(v.Int64[i]))
+	case parquet.Type_FLOAT:
+		return binary.LittleEndian.AppendUint32(nil, math.Float32bits(v.Float[i]))
+	case parquet.Type_DOUBLE:
+		return binary.LittleEndian.AppendUint64(nil, math.Float64bits(v.Double[i]))
+	default:
+		return v.Bytes[i]
+	}
+}
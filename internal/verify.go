@@ -0,0 +1,301 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/murakmii/retsu/thrift/parquet"
+)
+
+type (
+	// ファイルの構造の検証結果
+	VerifyReport struct {
+		Valid    bool             `json:"valid"`
+		Problems []*VerifyProblem `json:"problems"`
+	}
+
+	// 検証で見つかった問題
+	VerifyProblem struct {
+		Check    string `json:"check"`
+		RowGroup *int   `json:"row_group,omitempty"`
+		Column   string `json:"column,omitempty"`
+		Offset   *int64 `json:"offset,omitempty"`
+		Message  string `json:"message"`
+	}
+
+	// 列チャンクが占めるバイト範囲
+	chunkRange struct {
+		rowGroup int
+		col      *ColumnChunk
+		head     int64
+		tail     int64
+	}
+)
+
+// 検証項目
+const (
+	checkMagic                 = "magic"
+	checkFooterLength          = "footer_length"
+	checkFooter                = "footer"
+	checkColumnChunkRange      = "column_chunk_range"
+	checkColumnChunkOverlap    = "column_chunk_overlap"
+	checkPage                  = "page"
+	checkPageChecksum          = "page_checksum"
+	checkNumValues             = "num_values"
+	checkTotalCompressedSize   = "total_compressed_size"
+	checkTotalUncompressedSize = "total_uncompressed_size"
+	checkRowCount              = "row_count"
+	checkTotalRows             = "total_rows"
+)
+
+// ファイル全体の構造を検証する
+// 見つかった問題はレポートとして返し、ファイルの読み取り自体に失敗した場合のみエラーを返す
+func (par *Parquet) Verify(ctx context.Context) (*VerifyReport, error) {
+	report := &VerifyReport{Problems: make([]*VerifyProblem, 0)}
+
+	footerStart, ok, err := par.verifyFileLayout(report)
+	if err != nil {
+		return nil, err
+	}
+
+	// マジックナンバーやフッター長が不正なら、それ以降の検証はできない
+	if !ok {
+		return report.finish(), nil
+	}
+
+	meta, err := par.Inspect(ctx)
+	if err != nil {
+		report.add(checkFooter, nil, "", nil, "failed to read footer: %v", err)
+		return report.finish(), nil
+	}
+
+	// 列チャンクがフッターより前に収まっているか、互いに重なっていないか
+	ranges := make([]*chunkRange, 0)
+	for i, row := range meta.RowGroups {
+		for _, col := range row.Columns {
+			if !col.Decryptable() {
+				continue
+			}
+
+			head := col.PageHeadOffset()
+			tail := head + col.TotalCompressedSize
+			if head < int64(len(magic)) || tail > footerStart || col.TotalCompressedSize <= 0 {
+				report.add(checkColumnChunkRange, &i, col.Path, &head,
+					"column chunk [%d, %d) is out of data area [%d, %d)", head, tail, len(magic), footerStart)
+				continue
+			}
+
+			ranges = append(ranges, &chunkRange{rowGroup: i, col: col, head: head, tail: tail})
+		}
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].head < ranges[j].head })
+	for i := 1; i < len(ranges); i++ {
+		prev, cur := ranges[i-1], ranges[i]
+		if cur.head < prev.tail {
+			report.add(checkColumnChunkOverlap, &cur.rowGroup, cur.col.Path, &cur.head,
+				"column chunk [%d, %d) overlaps with column chunk '%s' of row group %d [%d, %d)",
+				cur.head, cur.tail, prev.col.Path, prev.rowGroup, prev.head, prev.tail)
+		}
+	}
+
+	// 範囲が正しい列チャンクについて、ページを辿って各種の値を検証する
+	rowCounts := make(map[*ColumnChunk]int64)
+	for _, r := range ranges {
+		rows, ok, err := par.verifyColumnChunk(ctx, report, meta, r)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rowCounts[r.col] = rows
+		}
+	}
+
+	var totalRows int64
+	for i, row := range meta.RowGroups {
+		totalRows += row.NumRows
+
+		for _, col := range row.Columns {
+			rows, ok := rowCounts[col]
+			if ok && rows != row.NumRows {
+				report.add(checkRowCount, &i, col.Path, nil,
+					"column chunk has %d rows, but row group has %d rows", rows, row.NumRows)
+			}
+		}
+	}
+
+	if totalRows != meta.TotalRows {
+		report.add(checkTotalRows, nil, "", nil,
+			"sum of rows in row groups is %d, but footer says %d rows", totalRows, meta.TotalRows)
+	}
+
+	return report.finish(), nil
+}
+
+// マジックナンバーとフッター長を検証し、フッターの開始位置を返す
+func (par *Parquet) verifyFileLayout(report *VerifyReport) (int64, bool, error) {
+	size := par.Size()
+
+	if size < minFileSize {
+		report.add(checkMagic, nil, "", nil, "file is too small to be parquet file(size: %d)", size)
+		return 0, false, nil
+	}
+
+	head, err := par.readRange(0, int64(len(magic)))
+	if err != nil {
+		return 0, false, err
+	}
+
+	tail, err := par.readRange(size-8, 8)
+	if err != nil {
+		return 0, false, err
+	}
+
+	ok := true
+	if !bytes.Equal(head, magic) && !bytes.Equal(head, encryptedMagic) {
+		report.add(checkMagic, nil, "", ptr(int64(0)), "invalid magic number at start of file: %q", head)
+		ok = false
+	}
+	if !bytes.Equal(tail[4:], magic) && !bytes.Equal(tail[4:], encryptedMagic) {
+		report.add(checkMagic, nil, "", ptr(size-4), "invalid magic number at end of file: %q", tail[4:])
+		ok = false
+	}
+	if ok && !bytes.Equal(head, tail[4:]) {
+		report.add(checkMagic, nil, "", nil, "magic number at start(%q) and end(%q) of file are different", head, tail[4:])
+		ok = false
+	}
+	if !ok {
+		return 0, false, nil
+	}
+
+	footerLen := int64(binary.LittleEndian.Uint32(tail))
+	if footerLen == 0 || footerLen > size-minFileSize {
+		report.add(checkFooterLength, nil, "", ptr(size-8),
+			"footer length(%d) is out of bounds(1 to %d)", footerLen, size-minFileSize)
+		return 0, false, nil
+	}
+
+	return size - 8 - footerLen, true, nil
+}
+
+// 列チャンク内のページを辿り、値の数やサイズを検証した上で列チャンクの行数を返す
+// 行数を数えられなかった場合は第二戻り値としてfalseを返す
+func (par *Parquet) verifyColumnChunk(ctx context.Context, report *VerifyReport, meta *MetaData, r *chunkRange) (int64, bool, error) {
+	col := r.col
+	schema := meta.FindSchema(col.Path)
+	if schema == nil || !schema.IsLeaf() {
+		report.add(checkColumnChunkRange, &r.rowGroup, col.Path, &r.head, "column chunk has no corresponding leaf in schema")
+		return 0, false, nil
+	}
+
+	pages := newPageReader(par, col, true)
+
+	var numValues, numRows, compressed, uncompressed int64
+	countable := true
+
+	for readDict := pages.hasDict(ctx); numValues < col.NumValues; readDict = false {
+		start := pages.position()
+		if start >= r.tail {
+			break
+		}
+
+		var header *parquet.PageHeader
+		var data []byte
+		var err error
+		if readDict {
+			header, data, err = pages.readDictPage(ctx)
+		} else {
+			header, data, err = pages.readDataPage(ctx)
+		}
+
+		var corrupted *PageCorruptionError
+		if errors.As(err, &corrupted) {
+			// CRCが一致しないページも、ヘッダが読み取れていれば後続のページの検証は続けられる
+			report.add(checkPageChecksum, &r.rowGroup, col.Path, &start, "%v", err)
+			countable = false
+		} else if err != nil {
+			report.add(checkPage, &r.rowGroup, col.Path, &start, "failed to read page: %v", err)
+			return 0, false, nil
+		}
+
+		end := pages.position()
+		compressed += end - start
+		uncompressed += end - start - int64(header.CompressedPageSize) + int64(header.UncompressedPageSize)
+
+		switch header.Type {
+		case parquet.PageType_DATA_PAGE:
+			numValues += int64(header.DataPageHeader.NumValues)
+
+			// 繰り返しレベルが無ければ値の数がそのまま行数になるが、あればレベルが0である値の数が行数になる
+			if !schema.HasRepetitionLevels() {
+				numRows += int64(header.DataPageHeader.NumValues)
+			} else if data != nil {
+				levels, _, err := readLevels(data, schema.MaxRepetitionLevel, int(header.DataPageHeader.NumValues))
+				if err != nil {
+					report.add(checkPage, &r.rowGroup, col.Path, &start, "failed to read repetition levels: %v", err)
+					countable = false
+					continue
+				}
+
+				for _, level := range levels {
+					if level == 0 {
+						numRows++
+					}
+				}
+			}
+
+		case parquet.PageType_DATA_PAGE_V2:
+			numValues += int64(header.DataPageHeaderV2.NumValues)
+			numRows += int64(header.DataPageHeaderV2.NumRows)
+		}
+	}
+
+	if numValues != col.NumValues {
+		report.add(checkNumValues, &r.rowGroup, col.Path, &r.head,
+			"sum of values in pages is %d, but column chunk has %d values", numValues, col.NumValues)
+		countable = false
+	}
+	// PARQUET-816の不具合を持つライターは、辞書ページのヘッダのサイズを列チャンクのサイズに含めていない
+	if meta.hasDefect(defectDictPageHeaderSize) {
+		return numRows, countable, nil
+	}
+
+	if compressed != col.TotalCompressedSize {
+		report.add(checkTotalCompressedSize, &r.rowGroup, col.Path, &r.head,
+			"sum of compressed page sizes is %d, but column chunk says %d", compressed, col.TotalCompressedSize)
+	}
+	if uncompressed != col.TotalUncompressedSize {
+		report.add(checkTotalUncompressedSize, &r.rowGroup, col.Path, &r.head,
+			"sum of uncompressed page sizes is %d, but column chunk says %d", uncompressed, col.TotalUncompressedSize)
+	}
+
+	return numRows, countable, nil
+}
+
+func (report *VerifyReport) add(check string, rowGroup *int, column string, offset *int64, format string, args ...any) {
+	var rg *int
+	if rowGroup != nil {
+		rg = ptr(*rowGroup)
+	}
+
+	report.Problems = append(report.Problems, &VerifyProblem{
+		Check:    check,
+		RowGroup: rg,
+		Column:   column,
+		Offset:   offset,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (report *VerifyReport) finish() *VerifyReport {
+	report.Valid = len(report.Problems) == 0
+	return report
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
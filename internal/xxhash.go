@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// ブルームフィルタで用いられるハッシュ関数 XXH64 の実装
+// https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md
+const (
+	xxhPrime1 uint64 = 11400714785074694791
+	xxhPrime2 uint64 = 14029467366897019727
+	xxhPrime3 uint64 = 1609587929392839161
+	xxhPrime4 uint64 = 9650029242287828579
+	xxhPrime5 uint64 = 2870177450012600261
+)
+
+// シード値0でXXH64ハッシュ値を計算する(Parquetのブルームフィルタはシード値0を用いる)
+func xxHash64(data []byte) uint64 {
+	n := len(data)
+	var h uint64
+
+	if n >= 32 {
+		// 定数のままでは桁あふれでコンパイルできないため、変数経由で計算する
+		p1, p2 := xxhPrime1, xxhPrime2
+		v1 := p1 + p2
+		v2 := p2
+		v3 := uint64(0)
+		v4 := -p1
+
+		for len(data) >= 32 {
+			v1 = xxhRound(v1, binary.LittleEndian.Uint64(data[0:]))
+			v2 = xxhRound(v2, binary.LittleEndian.Uint64(data[8:]))
+			v3 = xxhRound(v3, binary.LittleEndian.Uint64(data[16:]))
+			v4 = xxhRound(v4, binary.LittleEndian.Uint64(data[24:]))
+			data = data[32:]
+		}
+
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxhMergeRound(h, v1)
+		h = xxhMergeRound(h, v2)
+		h = xxhMergeRound(h, v3)
+		h = xxhMergeRound(h, v4)
+	} else {
+		h = xxhPrime5
+	}
+
+	h += uint64(n)
+
+	for ; len(data) >= 8; data = data[8:] {
+		h ^= xxhRound(0, binary.LittleEndian.Uint64(data))
+		h = bits.RotateLeft64(h, 27)*xxhPrime1 + xxhPrime4
+	}
+
+	if len(data) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(data)) * xxhPrime1
+		h = bits.RotateLeft64(h, 23)*xxhPrime2 + xxhPrime3
+		data = data[4:]
+	}
+
+	for ; len(data) > 0; data = data[1:] {
+		h ^= uint64(data[0]) * xxhPrime5
+		h = bits.RotateLeft64(h, 11) * xxhPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxhPrime2
+	h ^= h >> 29
+	h *= xxhPrime3
+	h ^= h >> 32
+
+	return h
+}
+
+func xxhRound(acc, input uint64) uint64 {
+	acc += input * xxhPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxhPrime1
+}
+
+func xxhMergeRound(acc, val uint64) uint64 {
+	val = xxhRound(0, val)
+	acc ^= val
+	return acc*xxhPrime1 + xxhPrime4
+}